@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/compose"
 	"github.com/curtisnewbie/miso-agent/agents"
 	"github.com/curtisnewbie/miso/errs"
@@ -29,11 +30,19 @@ type agentOps struct {
 	compaction                   bool
 	compactPreserveRecentTokens  int
 	compactBuffer                int // derived from compactionThreshold * MaxTokens
+	compactor                    Compactor
+	compactionModel              model.BaseChatModel
 	maxTokens                    int // model context window size (0 = unknown)
 	toolOffloadTokenLimit        int // 0 = disabled
 	toolOffloadResultsPathPrefix string
+	toolOffloadSummaryModel      model.BaseChatModel
+	clearToolResultsAfterRounds  int
+	clearToolResultsKeepTokens   int
 	enableFileTool               bool
 	enableTodoTool               bool
+	enableAskUserTool            bool
+	enableSkillTool              bool
+	finalAnswerOnMaxSteps        bool
 	enableToolOffload            bool
 	enableTrace                  bool
 }
@@ -41,9 +50,17 @@ type agentOps struct {
 type ctxKey int
 
 var (
-	agentCtxKey    ctxKey = 0
-	toolArgsCtxKey ctxKey = 1
-	tokenAccCtxKey ctxKey = 2
+	agentCtxKey     ctxKey = 0
+	toolArgsCtxKey  ctxKey = 1
+	tokenAccCtxKey  ctxKey = 2
+	eventSinkCtxKey ctxKey = 3
+
+	suspensionCtxKey       ctxKey = 4
+	toolApprovedCtxKey     ctxKey = 5
+	toolLimiterCtxKey      ctxKey = 6
+	runProgressCtxKey      ctxKey = 7
+	tokenCalibrationCtxKey ctxKey = 8
+	skillActivationCtxKey  ctxKey = 9
 )
 
 // Agent is a ReAct (Reasoning + Acting) agent that can process tasks using tools and skills.
@@ -58,6 +75,7 @@ type Agent struct {
 	ops           agentOps
 	tools         *ToolRegistry
 	tokenizer     Tokenizer
+	modelName     string // name of config.Model if it implements agents.ModelNamer; keys TokenUsage.ByModel
 	graph         compose.Runnable[taskInput, taskOutput]
 	middleware    []Middleware
 	logPromptOnce sync.Once
@@ -104,21 +122,43 @@ func NewAgent(config AgentConfig, optCtx ...context.Context) (*Agent, error) {
 		logInputs:                   boolOrDefault(config.LogInputs, false),
 		logOutputs:                  boolOrDefault(config.LogOutputs, true),
 		toolEventCallback:           config.ToolEventCallback,
-		compaction:                  boolOrDefault(config.Compaction, false),
+		compaction:                  boolOrDefault(config.Compaction, config.Compactor != nil),
 		compactPreserveRecentTokens: config.CompactPreserveRecentTokens,
 		enableTrace:                 boolOrDefault(config.EnableTrace, false),
 	}
 
+	var modelName string
+	if namer, ok := config.Model.(agents.ModelNamer); ok {
+		modelName = namer.ModelName()
+	}
+
+	// Auto-detect the model price from model name if not explicitly set.
+	if config.ModelPrice == nil && modelName != "" {
+		if p, found := agents.LookupModelPrice(rail, modelName, config.EnableModelsFetch); found {
+			config.ModelPrice = &p
+			rail.Infof("Model %v price detected: input $%v, output $%v, cache read $%v per 1M tokens", modelName, p.Input, p.Output, p.CacheRead)
+		}
+	}
+
 	// Auto-detect MaxTokens from model name if not explicitly set.
 	if config.MaxTokens < 1 {
-		if namer, ok := config.Model.(agents.ModelNamer); ok {
-			if ctx, found := agents.LookupModelContextWindow(rail, namer.ModelName(), config.EnableModelsFetch); found {
+		if modelName != "" {
+			if ctx, found := agents.LookupModelContextWindow(rail, modelName, config.EnableModelsFetch); found {
 				config.MaxTokens = ctx
-				rail.Infof("Model %v max token detected: %v", namer.ModelName(), config.MaxTokens)
+				rail.Infof("Model %v max token detected: %v", modelName, config.MaxTokens)
 			}
 		}
 	}
 
+	ops.compactionModel = config.CompactionModel
+	if ops.compactionModel == nil {
+		ops.compactionModel = config.Model
+	}
+	ops.compactor = config.Compactor
+	if ops.compactor == nil {
+		ops.compactor = NewSummaryCompactor(nil)
+	}
+
 	// Propagate MaxTokens into ops so trace callbacks can report context occupation.
 	ops.maxTokens = config.MaxTokens
 
@@ -141,8 +181,14 @@ func NewAgent(config AgentConfig, optCtx ...context.Context) (*Agent, error) {
 		ops.toolOffloadTokenLimit = *config.ToolOffloadTokenLimit
 	}
 	ops.toolOffloadResultsPathPrefix = config.ToolOffloadResultsPathPrefix
+	ops.toolOffloadSummaryModel = config.ToolOffloadSummaryModel
+	ops.clearToolResultsAfterRounds = max(0, config.ClearToolResultsAfterRounds)
+	ops.clearToolResultsKeepTokens = max(0, config.ClearToolResultsKeepTokens)
 	ops.enableFileTool = boolOrDefault(config.EnableFileTool, true)
 	ops.enableTodoTool = boolOrDefault(config.EnableTodoTool, false)
+	ops.enableAskUserTool = boolOrDefault(config.EnableAskUserTool, false)
+	ops.enableSkillTool = boolOrDefault(config.EnableSkillTool, false)
+	ops.finalAnswerOnMaxSteps = boolOrDefault(config.FinalAnswerOnMaxSteps, false)
 
 	// Disable offloading when file tools are unavailable (read_file would be inaccessible).
 	ops.enableToolOffload = boolOrDefault(config.EnableToolOffload, true)
@@ -173,7 +219,10 @@ func NewAgent(config AgentConfig, optCtx ...context.Context) (*Agent, error) {
 	}
 
 	// Initialize tokenizer for token counting
-	tokenizer := NewTokenizer()
+	tokenizer := config.Tokenizer
+	if tokenizer == nil {
+		tokenizer = NewTokenizer()
+	}
 
 	// Initialize tools
 	toolRegistry := NewToolRegistry()
@@ -182,6 +231,8 @@ func NewAgent(config AgentConfig, optCtx ...context.Context) (*Agent, error) {
 	builtinTools := BuiltinTools(
 		WithEnableFileTool(ops.enableFileTool),
 		WithEnableTodoTool(ops.enableTodoTool),
+		WithEnableAskUserTool(ops.enableAskUserTool),
+		WithEnableSkillTool(ops.enableSkillTool),
 	)
 	toolRegistry.Merge(builtinTools)
 
@@ -211,6 +262,7 @@ func NewAgent(config AgentConfig, optCtx ...context.Context) (*Agent, error) {
 		ops:        ops,
 		tools:      toolRegistry,
 		tokenizer:  tokenizer,
+		modelName:  modelName,
 		middleware: config.Middleware,
 	}
 
@@ -239,15 +291,76 @@ type AgentContext struct {
 type AgentRequest struct {
 	// SessionId is an optional identifier for this execution.
 	// If empty, a unique ID is generated automatically with the prefix "sess_".
-	SessionId           string
-	UserInput           string
+	SessionId string
+	UserInput string
+
+	// Resume continues the run of SessionId from its last checkpoint instead of starting a new one.
+	// Messages, todos, artifacts, metadata and token usage are restored from the checkpoint;
+	// UserInput may be left empty. Requires AgentConfig.CheckpointStore. See also [Agent.Resume].
+	Resume bool
+
+	// Conversation continues a previous conversation: its messages are placed between the
+	// system prompt and UserInput, and its compaction summary and token calibration are carried over.
+	// Use TaskOutput.Conversation of the previous turn. Ignored when Resume is set.
+	Conversation *Conversation
+
+	// ApprovalDecisions answers every tool call listed in TaskOutput.PendingApprovals when
+	// resuming a run stopped with StopReasonPendingApproval. See [NewToolApprovalMiddleware].
+	ApprovalDecisions []ApprovalDecision
+
+	// Answer is the user's answer to TaskOutput.Question when resuming a run stopped with
+	// StopReasonNeedsInput. It is returned to the model as the result of the ask_user call.
+	Answer string
+
+	// Budget overrides AgentConfig.Budget for this execution.
+	Budget *Budget
+
 	PreloadBackendFiles func(store FileStore) error                       // Optional callback to preload files into the backend before execution
 	ArtifactCallback    func(store FileStore, artifacts []Artifact) error // Optional callback for artifacts
 }
 
 // Execute runs the agent with the given request.
+//
+// TaskOutput.StopReason tells why the run stopped. When the run fails, the error is returned
+// together with the response, artifacts, todos and metadata collected so far, and StopReason is
+// StopReasonCancelled, StopReasonMaxSteps or StopReasonError.
 func (a *Agent) Execute(rail flow.Rail, req AgentRequest) (TaskOutput, error) {
+	return a.execute(rail, req, nil)
+}
+
+// execute runs the agent; typed is the expected JSON output of [ExecuteTyped], or nil.
+func (a *Agent) execute(rail flow.Rail, req AgentRequest, typed *typedOutput) (TaskOutput, error) {
 	rail = rail.NextSpanId()
+
+	// Load the checkpoint before anything else so a missing checkpoint fails fast.
+	var resume *Checkpoint
+	if req.Resume {
+		if a.config.CheckpointStore == nil {
+			return TaskOutput{}, errs.NewErrf("cannot resume session %q: CheckpointStore is not configured", req.SessionId)
+		}
+		if req.SessionId == "" {
+			return TaskOutput{}, errs.NewErrf("cannot resume: SessionId is required")
+		}
+		cp, ok, err := a.config.CheckpointStore.Load(rail, a.config.Name, req.SessionId)
+		if err != nil {
+			return TaskOutput{}, errs.Wrapf(err, "failed to load checkpoint")
+		}
+		if !ok {
+			return TaskOutput{}, errs.NewErrf("no checkpoint found for session %q", req.SessionId)
+		}
+		if len(cp.PendingApprovals) > 0 && len(req.ApprovalDecisions) == 0 {
+			return TaskOutput{}, errs.NewErrf("session %q is awaiting approval of %d tool calls, ApprovalDecisions is required", req.SessionId, len(cp.PendingApprovals))
+		}
+		if cp.PendingQuestion != nil && req.Answer == "" {
+			return TaskOutput{}, errs.NewErrf("session %q is awaiting an answer to %q, Answer is required", req.SessionId, cp.PendingQuestion.Question)
+		}
+		resume = cp
+		if req.UserInput == "" {
+			req.UserInput = cp.UserInput
+		}
+		rail.Infof("Resume agent %q, SessionId: %q, from cycle %d (%d messages)", a.config.Name, req.SessionId, cp.CycleCount, len(cp.Messages))
+	}
+
 	if req.SessionId == "" {
 		req.SessionId = idutil.Id("sess_")
 	}
@@ -290,6 +403,15 @@ func (a *Agent) Execute(rail flow.Rail, req AgentRequest) (TaskOutput, error) {
 	// Initialize metadata store (fresh on each execution)
 	metadataStore := NewMetadataStore()
 
+	// Restore per-execution state from the checkpoint when resuming.
+	if resume != nil {
+		todoManager.FromState(resume.Todos)
+		artifactManager.FromState(resume.Artifacts)
+		for k, v := range resume.Metadata {
+			metadataStore.Set(k, v)
+		}
+	}
+
 	agentCtxVal := AgentContext{
 		SessionId: req.SessionId,
 		UserInput: req.UserInput,
@@ -317,27 +439,75 @@ func (a *Agent) Execute(rail flow.Rail, req AgentRequest) (TaskOutput, error) {
 		}
 	}
 
+	budget := a.config.Budget
+	if req.Budget != nil {
+		budget = *req.Budget
+	}
+	if budget.MaxCost > 0 && a.config.ModelPrice == nil {
+		rail.Warnf("[%v] Budget.MaxCost is set but the model price is unknown, cost budget is not enforced", a.config.Name)
+	}
+
 	// Prepare input with backend and skills
 	taskInput := taskInput{
 		task:   req.UserInput,
 		skills: skills,
 		store:  backend,
+		resume: resume,
+
+		conversation: req.Conversation,
+		approvals:    req.ApprovalDecisions,
+		answer:       req.Answer,
+		budget:       budget,
+		typed:        typed,
 	}
 
 	// Execute graph with agent-specific trace callback (always registered to collect token usage)
-	acc := &tokenAccumulator{}
+	acc := &tokenAccumulator{price: a.config.ModelPrice, model: a.modelName, fetchPrices: a.config.EnableModelsFetch}
+	if resume != nil {
+		acc.merge(resume.TokenUsage)
+	}
 	var traceAcc *traceAccumulator
 	if a.ops.enableTrace {
 		traceAcc = &traceAccumulator{}
 	}
 	rail = rail.WithCtxVal(tokenAccCtxKey, acc)
-	invokeOpts := []compose.Option{withAgentTraceCallback(a.config.Name, a.ops, acc, traceAcc)}
+	rail = rail.WithCtxVal(suspensionCtxKey, &suspension{})
+	rail = rail.WithCtxVal(toolLimiterCtxKey, newToolCallLimiter(a.config.MaxParallelToolCalls, a.config.MaxToolCallsPerTurn))
+	rail = rail.WithCtxVal(runProgressCtxKey, &runProgress{})
+	// The calibration belongs to the session: it carries over from the checkpoint or the previous turn.
+	calibration := &tokenCalibration{}
+	if resume != nil {
+		calibration.restore(resume.TokenRatio)
+	} else if req.Conversation != nil {
+		calibration.restore(req.Conversation.TokenRatio)
+	}
+	rail = rail.WithCtxVal(tokenCalibrationCtxKey, calibration)
+	activation := newSkillActivation(skills.GetSkills(), metadataStore, a.ops.enableSkillTool)
+	if resume != nil && resume.ActiveSkill != "" {
+		if _, err := activation.activate(resume.ActiveSkill); err != nil {
+			rail.Warnf("[%v] failed to restore active skill, %v", a.config.Name, err)
+		}
+	}
+	rail = rail.WithCtxVal(skillActivationCtxKey, activation)
+
+	// When streaming, forward tool events to the event sink alongside any configured callback.
+	ops := a.ops
+	if sink := eventSinkFromCtx(rail); sink != nil {
+		ops.toolEventCallback = streamToolEventCallback(a.config.Name, a.ops.toolEventCallback, sink)
+	}
+	invokeOpts := []compose.Option{withAgentTraceCallback(a.config.Name, ops, acc, traceAcc)}
 	result, err := a.graph.Invoke(rail, taskInput, invokeOpts...)
+	if err != nil {
+		// Report what was collected so far, so the caller can decide whether to show or retry.
+		result = buildPartialOutput(rail, err)
+	}
+	result.SessionId = req.SessionId
 	result.TokenUsage = acc.snapshot()
 	if traceAcc != nil {
 		result.TraceLogs = traceAcc.snapshot()
 	}
 	if err != nil {
+		rail.Infof("[%v] Stopped (%v), SessionId: %v", a.config.Name, result.StopReason, req.SessionId)
 		for _, m := range a.middleware {
 			if afterErr := m.AfterAgent(rail, agentCtxVal, nil, err); afterErr != nil {
 				rail.Errorf("middleware %q AfterAgent error: %v", m.Name(), afterErr)
@@ -345,12 +515,27 @@ func (a *Agent) Execute(rail flow.Rail, req AgentRequest) (TaskOutput, error) {
 		}
 		return result, errs.Wrapf(err, "failed to execute graph")
 	}
+
+	if result.StopReason == StopReasonPendingApproval || result.StopReason == StopReasonNeedsInput {
+		rail.Infof("[%v] Suspended (%v), SessionId: %v", a.config.Name, result.StopReason, req.SessionId)
+		if a.config.CheckpointStore == nil {
+			rail.Warnf("[%v] CheckpointStore is not configured, the suspended run cannot be resumed", a.config.Name)
+		}
+	} else if a.config.CheckpointStore != nil {
+		// The run completed; its checkpoint is no longer needed.
+		if err := a.config.CheckpointStore.Delete(rail, a.config.Name, req.SessionId); err != nil {
+			rail.Warnf("failed to delete checkpoint (non-fatal), SessionId: %v, %v", req.SessionId, err)
+		}
+	}
 	tu := result.TokenUsage
 	if tu.PromptTokens > 0 {
 		msg := fmt.Sprintf("[%v] total — in: %v tokens, out: %v tokens", a.config.Name, tu.PromptTokens, tu.CompletionTokens)
 		if tu.CachedTokens > 0 {
 			msg += fmt.Sprintf(", cache hit: %v (%.1f%%)", tu.CachedTokens, float64(tu.CachedTokens)*100.0/float64(tu.PromptTokens))
 		}
+		if tu.Cost > 0 {
+			msg += fmt.Sprintf(", est. cost: $%.4f", tu.Cost)
+		}
 		rail.Info(msg)
 	}
 
@@ -0,0 +1,299 @@
+package agentloop
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/util/ptr"
+)
+
+// scriptedModel is a ToolCallingChatModel whose replies are produced by respond.
+// withTools reports whether the model instance was bound with tools via WithTools.
+type scriptedModel struct {
+	tools   []*schema.ToolInfo
+	respond func(input []*schema.Message, withTools bool) (*schema.Message, error)
+}
+
+func (m *scriptedModel) Generate(_ context.Context, input []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	return m.respond(input, len(m.tools) > 0)
+}
+
+func (m *scriptedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+func (m *scriptedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	cp := *m
+	cp.tools = tools
+	return &cp, nil
+}
+
+// toolCallMsg returns an assistant message calling the named tool once.
+func toolCallMsg(id, name, args string) *schema.Message {
+	return &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+		{ID: id, Type: "function", Function: schema.FunctionCall{Name: name, Arguments: args}},
+	}}
+}
+
+// newCountingTool returns a tool that counts its invocations.
+func newCountingTool(name string, calls *int32) Tool {
+	return NewToolFunc(name, "test tool", nil, func(_ context.Context, _ map[string]interface{}) (string, error) {
+		atomic.AddInt32(calls, 1)
+		return "result of " + name, nil
+	})
+}
+
+func newTestAgent(t *testing.T, config AgentConfig) *Agent {
+	t.Helper()
+	if config.EnableFileTool == nil {
+		config.EnableFileTool = ptr.ValPtr(false)
+	}
+	a, err := NewAgent(config)
+	if err != nil {
+		t.Fatalf("NewAgent() error = %v", err)
+	}
+	return a
+}
+
+// TestNewAgent_WithTools covers the graph with a tools node: the default file tools and a custom tool.
+func TestNewAgent_WithTools(t *testing.T) {
+	var calls int32
+	n := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		n++
+		if n == 1 {
+			return toolCallMsg("call_1", "lookup", `{}`), nil
+		}
+		return schema.AssistantMessage("done", nil), nil
+	}}
+	a, err := NewAgent(AgentConfig{Model: m, Tools: []Tool{newCountingTool("lookup", &calls)}})
+	if err != nil {
+		t.Fatalf("NewAgent() error = %v", err)
+	}
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "hi"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.StopReason != StopReasonCompleted || out.Response != "done" || calls != 1 {
+		t.Errorf("out = %+v after %d lookup calls, want done after 1 call", out, calls)
+	}
+}
+
+func TestAgent_FinalAnswerOnMaxSteps(t *testing.T) {
+	var calls int32
+	n := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, withTools bool) (*schema.Message, error) {
+		if !withTools {
+			return schema.AssistantMessage("final answer from gathered results", nil), nil
+		}
+		n++
+		return toolCallMsg("call_"+string(rune('a'+n)), "lookup", `{}`), nil
+	}}
+
+	a := newTestAgent(t, AgentConfig{
+		Model:                 m,
+		MaxRunSteps:           3,
+		FinalAnswerOnMaxSteps: ptr.ValPtr(true),
+		Tools:                 []Tool{newCountingTool("lookup", &calls)},
+	})
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "research"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.StopReason != StopReasonMaxSteps {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonMaxSteps)
+	}
+	if out.Response != "final answer from gathered results" {
+		t.Errorf("Response = %q", out.Response)
+	}
+	if calls != 2 {
+		t.Errorf("lookup called %d times, want 2 (the 3rd round has no tools)", calls)
+	}
+}
+
+// TestAgent_ResumeForcedFinalAnswer verifies a run interrupted during its forced final answer
+// resumes with the final answer round, not with another tool round.
+func TestAgent_ResumeForcedFinalAnswer(t *testing.T) {
+	var calls int32
+	n := 0
+	failFinal := true
+	var finalInput []*schema.Message
+	m := &scriptedModel{respond: func(input []*schema.Message, withTools bool) (*schema.Message, error) {
+		if !withTools {
+			if failFinal {
+				return nil, errors.New("connection reset")
+			}
+			finalInput = input
+			return schema.AssistantMessage("final answer", nil), nil
+		}
+		n++
+		return toolCallMsg("call_"+string(rune('a'+n)), "lookup", `{}`), nil
+	}}
+	a := newTestAgent(t, AgentConfig{
+		Name:                  "main",
+		Model:                 m,
+		MaxRunSteps:           3,
+		FinalAnswerOnMaxSteps: ptr.ValPtr(true),
+		Tools:                 []Tool{newCountingTool("lookup", &calls)},
+		CheckpointStore:       NewFileCheckpointStore(t.TempDir()),
+	})
+	if _, err := a.Execute(flow.EmptyRail(), AgentRequest{SessionId: "s1", UserInput: "research"}); err == nil {
+		t.Fatal("Execute() should fail on the final answer round")
+	}
+
+	failFinal = false
+	out, err := a.Resume(flow.EmptyRail(), "s1")
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if out.StopReason != StopReasonMaxSteps || out.Response != "final answer" {
+		t.Errorf("out = %+v, want the forced final answer", out)
+	}
+	prompts := 0
+	for _, msg := range finalInput {
+		if msg.Role == schema.User && strings.Contains(msg.Content, "This is the last step allowed") {
+			prompts++
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("forced final answer prompt sent %d times, want 1", prompts)
+	}
+}
+
+func TestAgent_Completed(t *testing.T) {
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		return schema.AssistantMessage("done", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "hi"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.StopReason != StopReasonCompleted || out.Response != "done" {
+		t.Errorf("out = %+v", out)
+	}
+}
+
+func TestAgent_PartialResultsOnError(t *testing.T) {
+	n := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		n++
+		if n == 1 {
+			msg := toolCallMsg("call_1", "add_todo", `{"todos":[{"task":"collect sources"}]}`)
+			msg.Content = "Let me plan first."
+			return msg, nil
+		}
+		return nil, errors.New("provider unavailable")
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m, EnableTodoTool: ptr.ValPtr(true)})
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "research"})
+	if err == nil {
+		t.Fatal("Execute() should fail")
+	}
+	if out.StopReason != StopReasonError {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonError)
+	}
+	if out.Response != "Let me plan first." {
+		t.Errorf("Response = %q, want the last assistant reply", out.Response)
+	}
+	if len(out.Todos) != 1 || out.Todos[0].Task != "collect sources" {
+		t.Errorf("Todos = %+v", out.Todos)
+	}
+	if out.SessionId == "" || out.Conversation == nil {
+		t.Errorf("SessionId and Conversation should be set: %+v", out)
+	}
+}
+
+func TestAgent_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		cancel()
+		return nil, ctx.Err()
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	out, err := a.Execute(flow.NewRail(ctx), AgentRequest{UserInput: "hi"})
+	if err == nil {
+		t.Fatal("Execute() should fail")
+	}
+	if out.StopReason != StopReasonCancelled {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonCancelled)
+	}
+}
+
+func TestAgent_MaxStepsWithoutFinalAnswer(t *testing.T) {
+	var calls int32
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		return toolCallMsg("call_x", "lookup", `{}`), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m, MaxRunSteps: 2, Tools: []Tool{newCountingTool("lookup", &calls)}})
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "hi"})
+	if err == nil {
+		t.Fatal("Execute() should fail")
+	}
+	if out.StopReason != StopReasonMaxSteps {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonMaxSteps)
+	}
+}
+
+func TestAgent_OutputCheckExhausted(t *testing.T) {
+	type result struct {
+		Score int `json:"score"`
+	}
+	var n int32
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		atomic.AddInt32(&n, 1)
+		return schema.AssistantMessage("not json", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m, OutputCheck: JsonOutputCheck[result](2)})
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "score it"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.StopReason != StopReasonOutputCheckExhausted {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonOutputCheckExhausted)
+	}
+	if out.Response != "not json" || n != 2 {
+		t.Errorf("Response = %q after %d calls, want the last response after 2 calls", out.Response, n)
+	}
+}
+
+func TestAgent_TokenCalibrationCarriesOverTurns(t *testing.T) {
+	reportUsage := true
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		msg := schema.AssistantMessage("ok", nil)
+		if reportUsage {
+			msg.ResponseMeta = &schema.ResponseMeta{Usage: &schema.TokenUsage{PromptTokens: 5000}}
+		}
+		return msg, nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: strings.Repeat("word ", 1000)})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	ratio := out.Conversation.TokenRatio
+	if ratio <= 0 {
+		t.Fatalf("Conversation.TokenRatio = %v, want the observed ratio", ratio)
+	}
+
+	// The next turn reports no usage, so it keeps the ratio of the session.
+	reportUsage = false
+	out, err = a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "and then?", Conversation: out.Conversation})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.Conversation.TokenRatio != ratio {
+		t.Errorf("next turn Conversation.TokenRatio = %v, want %v", out.Conversation.TokenRatio, ratio)
+	}
+}
@@ -0,0 +1,194 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// pendingApprovalResult is the placeholder tool result of a call awaiting approval.
+// It is replaced with the real result (or the rejection) when the run is resumed.
+const pendingApprovalResult = "[pending approval]"
+
+// PendingToolCall is a tool call proposed by the model that is awaiting a human decision.
+type PendingToolCall struct {
+	ToolCallID string `json:"toolCallId"`
+	Name       string `json:"name"`
+	Args       string `json:"args"` // Raw JSON arguments proposed by the model
+}
+
+// ApprovalAction is the decision made on a [PendingToolCall].
+type ApprovalAction string
+
+const (
+	// ApprovalActionApprove runs the tool call as proposed.
+	ApprovalActionApprove ApprovalAction = "approve"
+	// ApprovalActionReject skips the tool call; the model is told it was rejected.
+	ApprovalActionReject ApprovalAction = "reject"
+	// ApprovalActionEdit runs the tool call with ApprovalDecision.Args instead of the proposed args.
+	ApprovalActionEdit ApprovalAction = "edit"
+)
+
+// ApprovalDecision is the reviewer's decision on one pending tool call, passed back via
+// AgentRequest.ApprovalDecisions when resuming a run suspended with [StopReasonPendingApproval].
+type ApprovalDecision struct {
+	ToolCallID string
+	Action     ApprovalAction
+	Args       string // Edited raw JSON arguments; required for ApprovalActionEdit
+	Reason     string // Optional; told to the model when the call is rejected
+}
+
+// toolApprovalMiddleware suspends calls to the configured tools until they are approved.
+type toolApprovalMiddleware struct {
+	BaseMiddleware
+	tools map[string]bool
+}
+
+// NewToolApprovalMiddleware returns a middleware that requires human approval for calls to the
+// named tools (e.g. "write_file", "edit_file" or custom side-effecting tools).
+//
+// When the model calls one of these tools, the call is not executed. Once all tool calls of
+// the current round have been handled, the run stops and returns a TaskOutput with
+// StopReason [StopReasonPendingApproval] and the proposed calls in TaskOutput.PendingApprovals.
+// Other tool calls of the same round run normally.
+//
+// Resume the run with the reviewer's decisions:
+//
+//	out, err = agent.Execute(rail, agentloop.AgentRequest{
+//	    SessionId: out.SessionId,
+//	    Resume:    true,
+//	    ApprovalDecisions: []agentloop.ApprovalDecision{
+//	        {ToolCallID: out.PendingApprovals[0].ToolCallID, Action: agentloop.ApprovalActionApprove},
+//	    },
+//	})
+//
+// Resuming requires AgentConfig.CheckpointStore. Eino's own graph interrupt is not used: it
+// serializes the whole graph state, which holds the per-execution FileStore and skills.
+// The run is instead suspended and resumed from the agent's [Checkpoint].
+func NewToolApprovalMiddleware(tools ...string) Middleware {
+	m := &toolApprovalMiddleware{tools: make(map[string]bool, len(tools))}
+	for _, t := range tools {
+		m.tools[t] = true
+	}
+	return m
+}
+
+func (m *toolApprovalMiddleware) Name() string { return "tool_approval" }
+
+func (m *toolApprovalMiddleware) WrapToolCall(ctx context.Context, req *ToolCallRequest, next ToolCallHandler) (*ToolCallResponse, error) {
+	if !m.tools[req.Name] {
+		return next(ctx, req)
+	}
+	if approved, _ := ctx.Value(toolApprovedCtxKey).(bool); approved {
+		return next(ctx, req)
+	}
+	s := suspensionFromCtx(ctx)
+	if s == nil {
+		return &ToolCallResponse{Result: fmt.Sprintf("Error: tool %q requires approval, but the run cannot be suspended", req.Name), IsError: true}, nil
+	}
+	s.addApproval(PendingToolCall{
+		ToolCallID: compose.GetToolCallID(ctx),
+		Name:       req.Name,
+		Args:       req.RawInput,
+	})
+	return &ToolCallResponse{Result: pendingApprovalResult}, nil
+}
+
+// resolvePendingApprovals applies the reviewer's decisions to a run restored from a checkpoint:
+// approved and edited calls are executed by toolNode, and the placeholder tool results in msgs
+// are replaced with their results or with a rejection notice. Edited args are also written back
+// to the assistant message so the history matches what actually ran.
+//
+// Running the calls through the tools node rather than the tools themselves keeps the tools node
+// middlewares (skill allowed tools, per-turn limits and timeouts), callbacks and tool call IDs.
+func resolvePendingApprovals(ctx context.Context, msgs []*schema.Message, pending []PendingToolCall,
+	decisions []ApprovalDecision, toolNode *compose.ToolsNode) ([]*schema.Message, error) {
+
+	byId := make(map[string]ApprovalDecision, len(decisions))
+	for _, d := range decisions {
+		byId[d.ToolCallID] = d
+	}
+	if len(byId) != len(pending) {
+		return nil, errs.NewErrf("expected %d approval decisions, got %d", len(pending), len(byId))
+	}
+
+	results := make(map[string]string, len(pending))
+	editedArgs := make(map[string]string)
+	var approved []schema.ToolCall
+	for _, p := range pending {
+		d, ok := byId[p.ToolCallID]
+		if !ok {
+			return nil, errs.NewErrf("missing approval decision for tool call %q (%s)", p.ToolCallID, p.Name)
+		}
+		args := p.Args
+		switch d.Action {
+		case ApprovalActionReject:
+			result := "Tool call rejected by the reviewer."
+			if d.Reason != "" {
+				result += " Reason: " + d.Reason
+			}
+			results[p.ToolCallID] = result
+			continue
+		case ApprovalActionEdit:
+			if d.Args == "" {
+				return nil, errs.NewErrf("edit decision for tool call %q has no args", p.ToolCallID)
+			}
+			args = d.Args
+			editedArgs[p.ToolCallID] = args
+		case ApprovalActionApprove:
+		default:
+			return nil, errs.NewErrf("unknown approval action %q for tool call %q", d.Action, p.ToolCallID)
+		}
+		approved = append(approved, schema.ToolCall{
+			ID:       p.ToolCallID,
+			Type:     "function",
+			Function: schema.FunctionCall{Name: p.Name, Arguments: args},
+		})
+	}
+
+	if len(approved) > 0 {
+		if toolNode == nil {
+			return nil, errs.NewErrf("cannot run %d approved tool calls: the agent has no tools", len(approved))
+		}
+		if l := toolCallLimiterFromCtx(ctx); l != nil {
+			l.startTurn(approved)
+		}
+		approvedCtx := context.WithValue(ctx, toolApprovedCtxKey, true)
+		toolMsgs, err := toolNode.Invoke(approvedCtx, &schema.Message{Role: schema.Assistant, ToolCalls: approved})
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to run approved tool calls")
+		}
+		for _, m := range toolMsgs {
+			results[m.ToolCallID] = m.Content
+		}
+	}
+
+	out := make([]*schema.Message, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg
+		switch msg.Role {
+		case schema.Tool:
+			if result, ok := results[msg.ToolCallID]; ok {
+				cp := *msg
+				cp.Content = result
+				out[i] = &cp
+			}
+		case schema.Assistant:
+			if len(editedArgs) == 0 || len(msg.ToolCalls) == 0 {
+				continue
+			}
+			cp := *msg
+			cp.ToolCalls = append([]schema.ToolCall(nil), msg.ToolCalls...)
+			for j, tc := range cp.ToolCalls {
+				if args, ok := editedArgs[tc.ID]; ok {
+					cp.ToolCalls[j].Function.Arguments = args
+				}
+			}
+			out[i] = &cp
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,223 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// echoTool is an InvokableTool that returns "ran <name> <args>".
+type echoTool struct {
+	name  string
+	mu    sync.Mutex
+	calls []string
+}
+
+func (t *echoTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func (t *echoTool) InvokableRun(_ context.Context, args string, _ ...tool.Option) (string, error) {
+	t.mu.Lock()
+	t.calls = append(t.calls, args)
+	t.mu.Unlock()
+	return "ran " + t.name + " " + args, nil
+}
+
+// newApprovalTestToolsNode builds a tools node running the given tools.
+func newApprovalTestToolsNode(t *testing.T, tools ...tool.BaseTool) *compose.ToolsNode {
+	t.Helper()
+	toolNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{Tools: tools})
+	if err != nil {
+		t.Fatalf("NewToolNode() error = %v", err)
+	}
+	return toolNode
+}
+
+func TestToolApprovalMiddleware(t *testing.T) {
+	m := NewToolApprovalMiddleware("write_file")
+	ran := false
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		ran = true
+		return &ToolCallResponse{Result: "ok"}, nil
+	}
+
+	s := &suspension{}
+	ctx := context.WithValue(context.Background(), suspensionCtxKey, s)
+
+	// Not in the approval list: runs immediately.
+	resp, err := m.WrapToolCall(ctx, &ToolCallRequest{Name: "read_file", RawInput: `{}`}, next)
+	if err != nil || resp.Result != "ok" || !ran {
+		t.Fatalf("read_file: resp %+v, err %v, ran %v", resp, err, ran)
+	}
+	if s.suspended() {
+		t.Fatal("read_file should not suspend the run")
+	}
+
+	// In the approval list: suspended, not executed.
+	ran = false
+	resp, err = m.WrapToolCall(ctx, &ToolCallRequest{Name: "write_file", RawInput: `{"path":"/a"}`}, next)
+	if err != nil || resp.Result != pendingApprovalResult || ran {
+		t.Fatalf("write_file: resp %+v, err %v, ran %v", resp, err, ran)
+	}
+	pending := s.pendingApprovals()
+	if len(pending) != 1 || pending[0].Name != "write_file" || pending[0].Args != `{"path":"/a"}` {
+		t.Errorf("pendingApprovals() = %+v", pending)
+	}
+
+	// Already approved: runs.
+	resp, err = m.WrapToolCall(context.WithValue(ctx, toolApprovedCtxKey, true), &ToolCallRequest{Name: "write_file"}, next)
+	if err != nil || resp.Result != "ok" || !ran {
+		t.Errorf("approved write_file: resp %+v, err %v, ran %v", resp, err, ran)
+	}
+
+	// No suspension in ctx: error result rather than silently running.
+	ran = false
+	resp, _ = m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "write_file"}, next)
+	if !resp.IsError || ran {
+		t.Errorf("without suspension: resp %+v, ran %v", resp, ran)
+	}
+}
+
+func TestResolvePendingApprovals(t *testing.T) {
+	write := &echoTool{name: "write_file"}
+	del := &echoTool{name: "delete_file"}
+	tools := newApprovalTestToolsNode(t, write, del)
+
+	msgs := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("task"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+			{ID: "c1", Function: schema.FunctionCall{Name: "write_file", Arguments: `{"path":"/a"}`}},
+			{ID: "c2", Function: schema.FunctionCall{Name: "delete_file", Arguments: `{"path":"/b"}`}},
+			{ID: "c3", Function: schema.FunctionCall{Name: "write_file", Arguments: `{"path":"/c"}`}},
+			{ID: "c4", Function: schema.FunctionCall{Name: "read_file", Arguments: `{}`}},
+		}},
+		schema.ToolMessage(pendingApprovalResult, "c1"),
+		schema.ToolMessage(pendingApprovalResult, "c2"),
+		schema.ToolMessage(pendingApprovalResult, "c3"),
+		schema.ToolMessage("file content", "c4"),
+	}
+	pending := []PendingToolCall{
+		{ToolCallID: "c1", Name: "write_file", Args: `{"path":"/a"}`},
+		{ToolCallID: "c2", Name: "delete_file", Args: `{"path":"/b"}`},
+		{ToolCallID: "c3", Name: "write_file", Args: `{"path":"/c"}`},
+	}
+	decisions := []ApprovalDecision{
+		{ToolCallID: "c1", Action: ApprovalActionApprove},
+		{ToolCallID: "c2", Action: ApprovalActionReject, Reason: "keep it"},
+		{ToolCallID: "c3", Action: ApprovalActionEdit, Args: `{"path":"/d"}`},
+	}
+
+	got, err := resolvePendingApprovals(context.Background(), msgs, pending, decisions, tools)
+	if err != nil {
+		t.Fatalf("resolvePendingApprovals() error = %v", err)
+	}
+	if got[3].Content != `ran write_file {"path":"/a"}` {
+		t.Errorf("approved result = %q", got[3].Content)
+	}
+	if !strings.Contains(got[4].Content, "rejected") || !strings.Contains(got[4].Content, "keep it") {
+		t.Errorf("rejected result = %q", got[4].Content)
+	}
+	if got[5].Content != `ran write_file {"path":"/d"}` {
+		t.Errorf("edited result = %q", got[5].Content)
+	}
+	if got[6].Content != "file content" {
+		t.Errorf("unrelated tool result changed: %q", got[6].Content)
+	}
+	if args := got[2].ToolCalls[2].Function.Arguments; args != `{"path":"/d"}` {
+		t.Errorf("edited args not written back to the assistant message: %s", args)
+	}
+	if len(del.calls) != 0 {
+		t.Errorf("rejected tool was executed: %v", del.calls)
+	}
+
+	// The checkpointed messages are not mutated.
+	if msgs[3].Content != pendingApprovalResult || msgs[2].ToolCalls[2].Function.Arguments != `{"path":"/c"}` {
+		t.Error("resolvePendingApprovals mutated its input messages")
+	}
+}
+
+func TestResolvePendingApprovals_InvalidDecisions(t *testing.T) {
+	tools := newApprovalTestToolsNode(t, &echoTool{name: "write_file"})
+	pending := []PendingToolCall{{ToolCallID: "c1", Name: "write_file", Args: `{}`}}
+
+	tests := []struct {
+		name      string
+		decisions []ApprovalDecision
+	}{
+		{name: "missing", decisions: nil},
+		{name: "wrong id", decisions: []ApprovalDecision{{ToolCallID: "c9", Action: ApprovalActionApprove}}},
+		{name: "edit without args", decisions: []ApprovalDecision{{ToolCallID: "c1", Action: ApprovalActionEdit}}},
+		{name: "unknown action", decisions: []ApprovalDecision{{ToolCallID: "c1", Action: "maybe"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := resolvePendingApprovals(context.Background(), nil, pending, tt.decisions, tools); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// callIdTool records the tool call ID seen by each run.
+type callIdTool struct {
+	echoTool
+	ids []string
+}
+
+func (t *callIdTool) InvokableRun(ctx context.Context, args string, opts ...tool.Option) (string, error) {
+	t.ids = append(t.ids, compose.GetToolCallID(ctx))
+	return t.echoTool.InvokableRun(ctx, args, opts...)
+}
+
+func TestResolvePendingApprovals_ToolsNodeMiddlewares(t *testing.T) {
+	write := &callIdTool{echoTool: echoTool{name: "write_file"}}
+	var seen []string
+	toolNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
+		Tools: []tool.BaseTool{write},
+		ToolCallMiddlewares: []compose.ToolMiddleware{{Invokable: func(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+			return func(ctx context.Context, input *compose.ToolInput) (*compose.ToolOutput, error) {
+				seen = append(seen, input.CallID)
+				return next(ctx, input)
+			}
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("NewToolNode() error = %v", err)
+	}
+
+	msgs := []*schema.Message{
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+			{ID: "c1", Function: schema.FunctionCall{Name: "write_file", Arguments: `{"path":"/a"}`}},
+		}},
+		schema.ToolMessage(pendingApprovalResult, "c1"),
+	}
+	pending := []PendingToolCall{{ToolCallID: "c1", Name: "write_file", Args: `{"path":"/a"}`}}
+	decisions := []ApprovalDecision{{ToolCallID: "c1", Action: ApprovalActionApprove}}
+
+	got, err := resolvePendingApprovals(context.Background(), msgs, pending, decisions, toolNode)
+	if err != nil {
+		t.Fatalf("resolvePendingApprovals() error = %v", err)
+	}
+	if got[1].Content != `ran write_file {"path":"/a"}` {
+		t.Errorf("approved result = %q", got[1].Content)
+	}
+	if len(seen) != 1 || seen[0] != "c1" {
+		t.Errorf("tools node middleware saw %v, want [c1]", seen)
+	}
+	if len(write.ids) != 1 || write.ids[0] != "c1" {
+		t.Errorf("GetToolCallID() in the tool = %v, want [c1]", write.ids)
+	}
+
+	// Rejecting everything needs no tools node.
+	decisions = []ApprovalDecision{{ToolCallID: "c1", Action: ApprovalActionReject}}
+	if _, err := resolvePendingApprovals(context.Background(), msgs, pending, decisions, nil); err != nil {
+		t.Errorf("reject without tools node: error = %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package bpe provides an [agentloop.Tokenizer] counting tokens with tiktoken BPE encodings.
+//
+// It lives in its own package so that the vocabularies, embedded in the binary, are only linked
+// into programs that import it.
+package bpe
+
+import (
+	"sync"
+
+	"github.com/curtisnewbie/miso-agent/agentloop"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// BPE encodings supported by [NewTokenizer].
+const (
+	EncodingCl100kBase = "cl100k_base" // GPT-4, GPT-3.5-turbo, text-embedding-3
+	EncodingO200kBase  = "o200k_base"  // GPT-4o, GPT-4.1, o-series
+)
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*tiktoken.Tiktoken{}
+	loaderOnce  sync.Once
+)
+
+// NewTokenizer creates a Tokenizer that counts tokens with a tiktoken BPE encoding, e.g.
+// [EncodingO200kBase]. Counts are exact for OpenAI models and a close estimate for other
+// models with large BPE vocabularies (Qwen, DeepSeek, GLM).
+//
+// The vocabularies are embedded in the binary; nothing is downloaded. An encoding is loaded
+// once per process on first use, which takes a few hundred milliseconds.
+//
+// The first call sets the process-wide BPE loader of tiktoken-go (tiktoken.SetBpeLoader) to the
+// offline loader, which also applies to any other use of tiktoken-go in the process.
+func NewTokenizer(encoding string) (agentloop.Tokenizer, error) {
+	enc, err := loadEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return agentloop.NewTokenizerFunc(func(text string) int {
+		return len(enc.Encode(text, nil, nil))
+	}), nil
+}
+
+// loadEncoding returns the cached encoding, loading it from the embedded vocabularies.
+func loadEncoding(encoding string) (*tiktoken.Tiktoken, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if enc, ok := encodings[encoding]; ok {
+		return enc, nil
+	}
+	if encoding != EncodingCl100kBase && encoding != EncodingO200kBase {
+		return nil, errs.NewErrf("unsupported BPE encoding %q, use %q or %q", encoding, EncodingCl100kBase, EncodingO200kBase)
+	}
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to load BPE encoding %q", encoding)
+	}
+	encodings[encoding] = enc
+	return enc, nil
+}
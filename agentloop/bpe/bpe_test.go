@@ -0,0 +1,30 @@
+package bpe
+
+import "testing"
+
+func TestNewTokenizer(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     int
+	}{
+		{EncodingCl100kBase, "Hello, world!", 4},
+		{EncodingO200kBase, "Hello, world!", 4},
+		{EncodingCl100kBase, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			tokenizer, err := NewTokenizer(tt.encoding)
+			if err != nil {
+				t.Fatalf("NewTokenizer() error = %v", err)
+			}
+			if got := tokenizer.CountTokens(tt.text); got != tt.want {
+				t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewTokenizer("unknown"); err == nil {
+		t.Error("NewTokenizer(unknown) should fail")
+	}
+}
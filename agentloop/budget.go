@@ -0,0 +1,28 @@
+package agentloop
+
+// BudgetLimit identifies which limit of a [Budget] was reached.
+type BudgetLimit string
+
+const (
+	BudgetLimitPromptTokens     BudgetLimit = "prompt_tokens"
+	BudgetLimitCompletionTokens BudgetLimit = "completion_tokens"
+	BudgetLimitCost             BudgetLimit = "cost"
+)
+
+// Budget caps the token usage and estimated cost of a single execution, including sub-agents.
+// Zero fields are unlimited.
+//
+// Before every model call the agent projects the usage after the call: the prompt about to be
+// sent, the average completion size so far, and their estimated cost. When a limit would be
+// exceeded, tools are removed and the model is asked to give its final answer from what it has
+// gathered. The run then stops with StopReason [StopReasonBudgetExceeded] and
+// TaskOutput.BudgetExceeded names the limit. The final call itself may go slightly over.
+type Budget struct {
+	MaxPromptTokens     int     // Total prompt tokens across all model calls
+	MaxCompletionTokens int     // Total completion tokens across all model calls
+	MaxCost             float64 // Estimated cost in USD; requires AgentConfig.ModelPrice
+}
+
+func (b Budget) isZero() bool {
+	return b.MaxPromptTokens <= 0 && b.MaxCompletionTokens <= 0 && b.MaxCost <= 0
+}
@@ -0,0 +1,118 @@
+package agentloop
+
+import (
+	"math"
+	"testing"
+
+	"github.com/curtisnewbie/miso-agent/agents"
+)
+
+func TestTokenAccumulator_Cost(t *testing.T) {
+	acc := &tokenAccumulator{price: &agents.ModelPrice{Input: 2, Output: 8, CacheRead: 0.5}}
+	acc.add(1_000_000, 100_000, 400_000)
+	// 600k uncached * $2 + 400k cached * $0.5 + 100k out * $8 = 1.2 + 0.2 + 0.8
+	if got := acc.snapshot().Cost; math.Abs(got-2.2) > 1e-9 {
+		t.Errorf("Cost = %v, want 2.2", got)
+	}
+
+	acc.merge(TokenUsage{PromptTokens: 10, Cost: 0.3})
+	tu := acc.snapshot()
+	if math.Abs(tu.Cost-2.5) > 1e-9 || tu.PromptTokens != 1_000_010 {
+		t.Errorf("after merge: %+v", tu)
+	}
+
+	unpriced := &tokenAccumulator{}
+	unpriced.add(1000, 1000, 0)
+	if unpriced.snapshot().Cost != 0 {
+		t.Error("Cost should be 0 when the price is unknown")
+	}
+}
+
+func TestTokenAccumulator_CheckBudgetMergedUsage(t *testing.T) {
+	acc := &tokenAccumulator{}
+	acc.add(100, 100, 0)
+	acc.merge(TokenUsage{PromptTokens: 1000, CompletionTokens: 500}) // a sub-agent run of several calls
+	// The average completion of the agent's own calls is 100: 600 + 100 fits in 700.
+	if got := acc.checkBudget(Budget{MaxCompletionTokens: 700}, 0); got != "" {
+		t.Errorf("checkBudget() = %v, want no limit", got)
+	}
+	if got := acc.checkBudget(Budget{MaxCompletionTokens: 699}, 0); got != BudgetLimitCompletionTokens {
+		t.Errorf("checkBudget() = %v, want %v", got, BudgetLimitCompletionTokens)
+	}
+}
+
+func TestTokenAccumulator_CheckBudget(t *testing.T) {
+	price := &agents.ModelPrice{Input: 1, Output: 1}
+
+	tests := []struct {
+		name       string
+		price      *agents.ModelPrice
+		calls      [][3]int
+		budget     Budget
+		nextPrompt int
+		want       BudgetLimit
+	}{
+		{
+			name:       "first call within budget",
+			budget:     Budget{MaxPromptTokens: 1000},
+			nextPrompt: 500,
+			want:       "",
+		},
+		{
+			name:       "next prompt would exceed",
+			calls:      [][3]int{{600, 50, 0}},
+			budget:     Budget{MaxPromptTokens: 1000},
+			nextPrompt: 500,
+			want:       BudgetLimitPromptTokens,
+		},
+		{
+			name:       "average completion would exceed",
+			calls:      [][3]int{{100, 300, 0}, {100, 300, 0}},
+			budget:     Budget{MaxCompletionTokens: 800},
+			nextPrompt: 100,
+			want:       BudgetLimitCompletionTokens,
+		},
+		{
+			name:       "completion within budget",
+			calls:      [][3]int{{100, 300, 0}},
+			budget:     Budget{MaxCompletionTokens: 800},
+			nextPrompt: 100,
+			want:       "",
+		},
+		{
+			name:       "cost would exceed",
+			price:      price,
+			calls:      [][3]int{{500_000, 0, 0}},
+			budget:     Budget{MaxCost: 1},
+			nextPrompt: 600_000,
+			want:       BudgetLimitCost,
+		},
+		{
+			name:       "cost ignored without price",
+			calls:      [][3]int{{500_000, 0, 0}},
+			budget:     Budget{MaxCost: 1},
+			nextPrompt: 600_000,
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := &tokenAccumulator{price: tt.price}
+			for _, c := range tt.calls {
+				acc.add(c[0], c[1], c[2])
+			}
+			if got := acc.checkBudget(tt.budget, tt.nextPrompt); got != tt.want {
+				t.Errorf("checkBudget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudget_IsZero(t *testing.T) {
+	if !(Budget{}).isZero() {
+		t.Error("empty Budget should be zero")
+	}
+	if (Budget{MaxCost: 0.5}).isZero() {
+		t.Error("Budget with MaxCost should not be zero")
+	}
+}
@@ -0,0 +1,220 @@
+package agentloop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/middleware/redis"
+	"github.com/curtisnewbie/miso/util/atom"
+)
+
+// Checkpoint is a snapshot of an in-flight agent run, saved to the configured
+// [CheckpointStore] after every ReAct round so the run can be continued with [Agent.Resume].
+//
+// Files written to the FileStore are not part of the checkpoint. Use a persistent
+// AgentConfig.BackendFactory (or AgentRequest.PreloadBackendFiles) if the resumed run
+// needs files written before the interruption.
+type Checkpoint struct {
+	AgentName           string            `json:"agentName"` // AgentConfig.Name of the agent that saved the checkpoint
+	SessionId           string            `json:"sessionId"`
+	UserInput           string            `json:"userInput"`
+	Messages            []*schema.Message `json:"messages"`
+	TaskIndex           int               `json:"taskIndex,omitempty"` // Index of the user message of the current turn in Messages
+	CycleCount          int               `json:"cycleCount"`
+	CompactionSummary   string            `json:"compactionSummary"`
+	OutputCheckAttempts int               `json:"outputCheckAttempts"`
+	ForceFinal          StopReason        `json:"forceFinal,omitempty"`     // Set when the next model call must give the final answer
+	BudgetExceeded      BudgetLimit       `json:"budgetExceeded,omitempty"` // Budget limit that forced the final answer, if any
+	Todos               []TodoItem        `json:"todos"`
+	Artifacts           []Artifact        `json:"artifacts"`
+	Metadata            map[string]any    `json:"metadata"` // Values are JSON round-tripped; typed values are restored as generic JSON types
+	TokenUsage          TokenUsage        `json:"tokenUsage"`
+	TokenRatio          float64           `json:"tokenRatio,omitempty"`       // Reported / estimated prompt tokens, see AgentConfig.Tokenizer
+	PendingApprovals    []PendingToolCall `json:"pendingApprovals,omitempty"` // Set when the run is suspended awaiting approval
+	PendingQuestion     *PendingQuestion  `json:"pendingQuestion,omitempty"`  // Set when the run is suspended by ask_user
+	ActiveSkill         string            `json:"activeSkill,omitempty"`      // Name of the skill active when the checkpoint was saved
+	UpdatedAt           atom.Time         `json:"updatedAt"`
+}
+
+// CheckpointStore persists agent run checkpoints keyed by agent name and session ID. Sub-agents
+// run by [NewSubAgentTool] share the session of their parent, so the agent name keeps their
+// checkpoints apart.
+type CheckpointStore interface {
+	// Save stores cp, replacing any previous checkpoint of the same agent and session.
+	Save(ctx context.Context, cp *Checkpoint) error
+
+	// Load returns the latest checkpoint of the agent in the session. ok is false if none exists.
+	Load(ctx context.Context, agentName string, sessionId string) (cp *Checkpoint, ok bool, err error)
+
+	// Delete removes the checkpoint of the agent in the session. No-op if none exists.
+	Delete(ctx context.Context, agentName string, sessionId string) error
+}
+
+// FileCheckpointStore is a CheckpointStore that writes each checkpoint as a JSON file
+// under a local directory.
+type FileCheckpointStore struct {
+	dir string
+}
+
+// NewFileCheckpointStore creates a FileCheckpointStore writing to dir.
+// The directory is created on the first Save if it does not exist.
+func NewFileCheckpointStore(dir string) *FileCheckpointStore {
+	return &FileCheckpointStore{dir: dir}
+}
+
+func (s *FileCheckpointStore) path(agentName string, sessionId string) string {
+	return filepath.Join(s.dir, sanitizeForPath(agentName), sanitizeForPath(sessionId)+".json")
+}
+
+// Save writes cp to {dir}/{agentName}/{sessionId}.json. The file is replaced atomically.
+func (s *FileCheckpointStore) Save(ctx context.Context, cp *Checkpoint) error {
+	dir := filepath.Dir(s.path(cp.AgentName, cp.SessionId))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errs.Wrapf(err, "failed to create checkpoint directory %s", dir)
+	}
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		return errs.Wrapf(err, "failed to marshal checkpoint")
+	}
+	f, err := os.CreateTemp(dir, "checkpoint-*.tmp")
+	if err != nil {
+		return errs.Wrapf(err, "failed to create checkpoint tmp file")
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return errs.Wrapf(err, "failed to write checkpoint tmp file")
+	}
+	f.Close()
+	if err := os.Rename(tmpPath, s.path(cp.AgentName, cp.SessionId)); err != nil {
+		os.Remove(tmpPath)
+		return errs.Wrapf(err, "failed to rename checkpoint file")
+	}
+	return nil
+}
+
+// Load reads the checkpoint of the agent in the session from disk.
+func (s *FileCheckpointStore) Load(ctx context.Context, agentName string, sessionId string) (*Checkpoint, bool, error) {
+	buf, err := os.ReadFile(s.path(agentName, sessionId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, errs.Wrapf(err, "failed to read checkpoint file")
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(buf, &cp); err != nil {
+		return nil, false, errs.Wrapf(err, "failed to unmarshal checkpoint")
+	}
+	return &cp, true, nil
+}
+
+// Delete removes the checkpoint file of the agent in the session.
+func (s *FileCheckpointStore) Delete(ctx context.Context, agentName string, sessionId string) error {
+	if err := os.Remove(s.path(agentName, sessionId)); err != nil && !os.IsNotExist(err) {
+		return errs.Wrapf(err, "failed to remove checkpoint file")
+	}
+	return nil
+}
+
+// RedisCheckpointStore is a CheckpointStore backed by Redis.
+// Redis must be initialized via miso's redis middleware before use.
+type RedisCheckpointStore struct {
+	keyPat string
+	ttl    time.Duration
+}
+
+// NewRedisCheckpointStore creates a RedisCheckpointStore. Checkpoints expire after ttl;
+// a ttl of 0 means no expiration.
+func NewRedisCheckpointStore(ttl time.Duration) *RedisCheckpointStore {
+	return &RedisCheckpointStore{
+		keyPat: "miso-agent:agentloop:checkpoint:%v:%v",
+		ttl:    ttl,
+	}
+}
+
+// Save writes cp as JSON under the key of its agent and session.
+func (s *RedisCheckpointStore) Save(ctx context.Context, cp *Checkpoint) error {
+	return redis.SetJson(flow.NewRail(ctx), fmt.Sprintf(s.keyPat, cp.AgentName, cp.SessionId), cp, s.ttl)
+}
+
+// Load reads the checkpoint of the agent in the session from Redis.
+func (s *RedisCheckpointStore) Load(ctx context.Context, agentName string, sessionId string) (*Checkpoint, bool, error) {
+	cp, ok, err := redis.GetJson[*Checkpoint](flow.NewRail(ctx), fmt.Sprintf(s.keyPat, agentName, sessionId))
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return cp, true, nil
+}
+
+// Delete removes the key of the agent in the session.
+func (s *RedisCheckpointStore) Delete(ctx context.Context, agentName string, sessionId string) error {
+	if err := redis.GetRedis().Del(ctx, fmt.Sprintf(s.keyPat, agentName, sessionId)).Err(); err != nil {
+		return errs.Wrap(err)
+	}
+	return nil
+}
+
+// saveCheckpoint snapshots state together with the execution's todos, artifacts and metadata,
+// and writes it to the configured CheckpointStore. Failures are logged, not returned:
+// checkpointing is best-effort and must not abort the run.
+func (a *Agent) saveCheckpoint(ctx context.Context, state *agentLoopState) {
+	store := a.config.CheckpointStore
+	if store == nil {
+		return
+	}
+	agentCtx, _ := ctx.Value(agentCtxKey).(AgentContext)
+	cp := &Checkpoint{
+		AgentName:           a.config.Name,
+		SessionId:           agentCtx.SessionId,
+		UserInput:           agentCtx.UserInput,
+		Messages:            state.messages,
+		TaskIndex:           state.taskIndex,
+		CycleCount:          state.cycleCount,
+		CompactionSummary:   state.compactionSummary,
+		OutputCheckAttempts: state.outputCheckAttempts,
+		ForceFinal:          state.forceFinal,
+		BudgetExceeded:      state.budgetExceeded,
+		UpdatedAt:           atom.Now(),
+	}
+	if agentCtx.Todos != nil {
+		cp.Todos = agentCtx.Todos.ToState()
+	}
+	if agentCtx.Artifacts != nil {
+		cp.Artifacts = agentCtx.Artifacts.ListArtifacts()
+	}
+	if agentCtx.Metadata != nil {
+		cp.Metadata = agentCtx.Metadata.All()
+	}
+	if s := suspensionFromCtx(ctx); s != nil {
+		cp.PendingApprovals = s.pendingApprovals()
+		cp.PendingQuestion = s.pendingQuestion()
+	}
+	if acc, ok := ctx.Value(tokenAccCtxKey).(*tokenAccumulator); ok && acc != nil {
+		cp.TokenUsage = acc.snapshot()
+	}
+	if c := tokenCalibrationFromCtx(ctx); c != nil {
+		cp.TokenRatio = c.getRatio()
+	}
+	if s := skillActivationFromCtx(ctx); s != nil {
+		cp.ActiveSkill = s.activeName()
+	}
+	if err := store.Save(ctx, cp); err != nil {
+		flow.NewRail(ctx).Warnf("[%v] failed to save checkpoint (non-fatal), SessionId: %v, %v", a.config.Name, cp.SessionId, err)
+	}
+}
+
+// Resume continues the run of the given session from its last checkpoint.
+// It is equivalent to Execute with AgentRequest{SessionId: sessionId, Resume: true}.
+// Requires AgentConfig.CheckpointStore.
+func (a *Agent) Resume(rail flow.Rail, sessionId string) (TaskOutput, error) {
+	return a.Execute(rail, AgentRequest{SessionId: sessionId, Resume: true})
+}
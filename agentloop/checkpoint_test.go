@@ -0,0 +1,122 @@
+package agentloop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestFileCheckpointStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileCheckpointStore(t.TempDir() + "/checkpoints")
+
+	cp := &Checkpoint{
+		AgentName: "main",
+		SessionId: "sess/1",
+		UserInput: "research X",
+		Messages: []*schema.Message{
+			schema.SystemMessage("system"),
+			schema.UserMessage("research X"),
+			{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "read_file", Arguments: `{"path":"/a"}`}}}},
+			schema.ToolMessage("content", "call_1"),
+		},
+		CycleCount:          3,
+		CompactionSummary:   "## Goal",
+		OutputCheckAttempts: 1,
+		Todos:               []TodoItem{{ID: "todo-1", Task: "a", Status: "pending"}},
+		Artifacts:           []Artifact{{Path: "/out.md", SizeInBytes: 10}},
+		Metadata:            map[string]any{"k": "v"},
+		TokenUsage:          TokenUsage{PromptTokens: 100, CompletionTokens: 20},
+		ForceFinal:          StopReasonBudgetExceeded,
+		BudgetExceeded:      BudgetLimitCost,
+	}
+	if err := store.Save(ctx, cp); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, ok, err := store.Load(ctx, "main", "sess/1")
+	if err != nil || !ok {
+		t.Fatalf("Load() = ok %v, err %v", ok, err)
+	}
+	if len(got.Messages) != 4 {
+		t.Fatalf("len(Messages) = %d, want 4", len(got.Messages))
+	}
+	if got.Messages[2].ToolCalls[0].Function.Name != "read_file" {
+		t.Errorf("tool call not restored: %+v", got.Messages[2])
+	}
+	if got.Messages[3].ToolCallID != "call_1" {
+		t.Errorf("ToolCallID = %q, want call_1", got.Messages[3].ToolCallID)
+	}
+	if got.CycleCount != 3 || got.CompactionSummary != "## Goal" || got.OutputCheckAttempts != 1 {
+		t.Errorf("loop counters not restored: %+v", got)
+	}
+	if len(got.Todos) != 1 || got.Todos[0].ID != "todo-1" {
+		t.Errorf("Todos = %+v", got.Todos)
+	}
+	if len(got.Artifacts) != 1 || got.Artifacts[0].Path != "/out.md" {
+		t.Errorf("Artifacts = %+v", got.Artifacts)
+	}
+	if got.Metadata["k"] != "v" {
+		t.Errorf("Metadata = %+v", got.Metadata)
+	}
+	if got.TokenUsage.PromptTokens != 100 {
+		t.Errorf("TokenUsage = %+v", got.TokenUsage)
+	}
+	if got.ForceFinal != StopReasonBudgetExceeded || got.BudgetExceeded != BudgetLimitCost {
+		t.Errorf("forced final answer not restored: %q, %q", got.ForceFinal, got.BudgetExceeded)
+	}
+
+	// A sub-agent in the same session keeps its own checkpoint.
+	sub := &Checkpoint{AgentName: "explorer", SessionId: "sess/1", CycleCount: 1}
+	if err := store.Save(ctx, sub); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got, _, _ := store.Load(ctx, "main", "sess/1"); got.CycleCount != 3 {
+		t.Errorf("CycleCount = %d after a sub-agent's Save, want 3", got.CycleCount)
+	}
+	if err := store.Delete(ctx, "explorer", "sess/1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, _ := store.Load(ctx, "main", "sess/1"); !ok {
+		t.Error("a sub-agent's Delete removed the parent's checkpoint")
+	}
+
+	// Save again overwrites.
+	cp.CycleCount = 4
+	if err := store.Save(ctx, cp); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, _, _ = store.Load(ctx, "main", "sess/1")
+	if got.CycleCount != 4 {
+		t.Errorf("CycleCount = %d after overwrite, want 4", got.CycleCount)
+	}
+
+	if err := store.Delete(ctx, "main", "sess/1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, err := store.Load(ctx, "main", "sess/1"); ok || err != nil {
+		t.Errorf("Load() after Delete = ok %v, err %v; want not found", ok, err)
+	}
+}
+
+func TestFileCheckpointStore_Missing(t *testing.T) {
+	store := NewFileCheckpointStore(t.TempDir())
+	if _, ok, err := store.Load(context.Background(), "main", "nope"); ok || err != nil {
+		t.Errorf("Load() = ok %v, err %v; want not found", ok, err)
+	}
+	if err := store.Delete(context.Background(), "main", "nope"); err != nil {
+		t.Errorf("Delete() of missing checkpoint error = %v", err)
+	}
+}
+
+func TestArtifactManager_FromState(t *testing.T) {
+	am := NewArtifactManager()
+	_ = am.AddArtifact(Artifact{Path: "/old"})
+	am.FromState([]Artifact{{Path: "/a"}, {Path: "/b"}})
+
+	got := am.ListArtifacts()
+	if len(got) != 2 || got[0].Path != "/a" || got[1].Path != "/b" {
+		t.Errorf("ListArtifacts() = %+v, want [/a /b]", got)
+	}
+}
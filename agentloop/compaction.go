@@ -58,7 +58,7 @@ func serializeForCompaction(msg *schema.Message) string {
 		// Skip compaction checkpoints — the summary text is already provided via
 		// buildCompactionPrompt's previousSummary parameter, so including the
 		// checkpoint message here would duplicate it in the prompt.
-		if strings.HasPrefix(msg.Content, "<conversation-checkpoint>") {
+		if isCompactionCheckpoint(msg) {
 			return ""
 		}
 		return "[User]: " + msg.Content
@@ -100,8 +100,12 @@ func selectForCompaction(messages []*schema.Message, tokenizer Tokenizer, keepTo
 		// Invariant violated — skip compaction rather than operating on unexpected structure.
 		return nil, nil
 	}
-	candidate := messages[2:]
+	return splitRecentMessages(messages[2:], tokenizer, keepTokens)
+}
 
+// splitRecentMessages splits candidate into the older messages and the recent tail that fits
+// in keepTokens, newest first.
+func splitRecentMessages(candidate []*schema.Message, tokenizer Tokenizer, keepTokens int) (older, recent []*schema.Message) {
 	recentTokens := 0
 	splitIdx := 0
 	for i := len(candidate) - 1; i >= 0; i-- {
@@ -153,7 +157,7 @@ func buildCompactionPrompt(previousSummary string, toSummarize []*schema.Message
 
 // runCompaction calls the model to summarize toSummarize and returns the summary text.
 // Returns previousSummary unchanged if toSummarize is empty or all messages serialize to nothing.
-func runCompaction(ctx context.Context, m model.ToolCallingChatModel, previousSummary string, toSummarize []*schema.Message) (string, error) {
+func runCompaction(ctx context.Context, m model.BaseChatModel, previousSummary string, toSummarize []*schema.Message) (string, error) {
 	if len(toSummarize) == 0 {
 		return previousSummary, nil
 	}
@@ -1,6 +1,7 @@
 package agentloop
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -346,3 +347,207 @@ func TestSelectForCompaction_FirstUserMessageAnchored(t *testing.T) {
 		}
 	}
 }
+
+// compactionTestHistory returns [user, (assistant tool call, tool result) x n] with large tool results.
+func compactionTestHistory(n int) []*schema.Message {
+	msgs := []*schema.Message{schema.UserMessage("follow-up")}
+	for i := 0; i < n; i++ {
+		id := string(rune('a' + i))
+		msgs = append(msgs,
+			schema.AssistantMessage("", []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: "search", Arguments: `{}`}}}),
+			schema.ToolMessage(strings.Repeat("result ", 200), id),
+		)
+	}
+	return msgs
+}
+
+func TestToolResultClearingCompactor(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(4)
+	in := CompactionInput{Messages: history, PreviousSummary: "prev", Tokenizer: tok, PreserveRecentTokens: tok.CountMessagesTokens(history[len(history)-2:])}
+	res, err := NewToolResultClearingCompactor().Compact(context.Background(), in)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if res.Summary != "prev" || len(res.Messages) != len(history) {
+		t.Fatalf("summary = %q, %d messages; want prev and %d messages", res.Summary, len(res.Messages), len(history))
+	}
+	for i, msg := range res.Messages {
+		cleared := msg.Content == clearedToolResult
+		if wantCleared := msg.Role == schema.Tool && i < len(history)-1; cleared != wantCleared {
+			t.Errorf("message %d (%s): cleared = %v, want %v", i, msg.Role, cleared, wantCleared)
+		}
+	}
+	if history[2].Content == clearedToolResult {
+		t.Error("input messages must not be modified")
+	}
+}
+
+func TestSlidingWindowCompactor(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(4)
+	// The budget fits the last tool result but not its tool call: the orphaned result is dropped too.
+	in := CompactionInput{Messages: history, Tokenizer: tok, PreserveRecentTokens: tok.CountMessageTokens(history[len(history)-1]) + 1}
+	res, _ := NewSlidingWindowCompactor().Compact(context.Background(), in)
+	if len(res.Messages) != 0 {
+		t.Errorf("kept %d messages, want 0", len(res.Messages))
+	}
+
+	in.PreserveRecentTokens = tok.CountMessagesTokens(history[len(history)-4:])
+	res, _ = NewSlidingWindowCompactor().Compact(context.Background(), in)
+	if len(res.Messages) != 4 || res.Messages[0].Role != schema.Assistant {
+		t.Errorf("kept %d messages starting with %v, want the last 2 rounds", len(res.Messages), res.Messages[0].Role)
+	}
+}
+
+func TestChainCompactor(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(4)
+	calls := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		calls++
+		return schema.AssistantMessage("## Goal\n- search", nil), nil
+	}}
+	in := CompactionInput{
+		Messages:             history,
+		Tokenizer:            tok,
+		PreserveRecentTokens: tok.CountMessagesTokens(history[len(history)-2:]),
+		Model:                m,
+	}
+	chain := NewChainCompactor(NewToolResultClearingCompactor(), NewSummaryCompactor(nil))
+
+	// Clearing is enough: the model is not called.
+	in.TargetTokens = tok.CountMessagesTokens(history)
+	res, err := chain.Compact(context.Background(), in)
+	if err != nil || calls != 0 || res.Summary != "" {
+		t.Fatalf("clearing only: err = %v, calls = %d, summary = %q", err, calls, res.Summary)
+	}
+
+	// Still too long after clearing: summarized.
+	in.TargetTokens = 1
+	res, err = chain.Compact(context.Background(), in)
+	if err != nil || calls != 1 || res.Summary == "" || len(res.Messages) != 2 {
+		t.Fatalf("clearing then summary: err = %v, calls = %d, summary = %q, %d messages", err, calls, res.Summary, len(res.Messages))
+	}
+}
+
+func TestHierarchicalSummaryCompactor(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(4)
+	var prompts []string
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		prompts = append(prompts, input[0].Content)
+		return schema.AssistantMessage("summary "+string(rune('0'+len(prompts))), nil), nil
+	}}
+	in := CompactionInput{
+		Messages:             history,
+		PreviousSummary:      "prev",
+		Tokenizer:            tok,
+		PreserveRecentTokens: tok.CountMessagesTokens(history[len(history)-2:]),
+	}
+	chunkTokens := tok.CountMessagesTokens(history[1:3])
+	res, err := NewHierarchicalSummaryCompactor(m, chunkTokens).Compact(context.Background(), in)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	// 7 messages to summarize in chunks of about one round: one call per chunk, then the merge.
+	if len(prompts) < 3 {
+		t.Fatalf("%d model calls, want at least 2 chunks and a merge", len(prompts))
+	}
+	merge := prompts[len(prompts)-1]
+	for _, want := range []string{"<previous-summary>\nprev", "summary 1", "summary 2", "## Goal"} {
+		if !strings.Contains(merge, want) {
+			t.Errorf("merge prompt missing %q", want)
+		}
+	}
+	if wantSummary := "summary " + string(rune('0'+len(prompts))); res.Summary != wantSummary || len(res.Messages) != 2 {
+		t.Errorf("summary = %q, %d messages; want %q and 2 messages", res.Summary, len(res.Messages), wantSummary)
+	}
+}
+
+func TestHierarchicalSummaryCompactor_DefaultChunkTokens(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(4)
+	calls := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		calls++
+		return schema.AssistantMessage("summary", nil), nil
+	}}
+	in := CompactionInput{Messages: history, Tokenizer: tok}
+	if _, err := NewHierarchicalSummaryCompactor(m, 0).Compact(context.Background(), in); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	// The history fits in one default chunk: a single summary call, not one per message.
+	if calls != 1 {
+		t.Errorf("%d model calls, want 1", calls)
+	}
+}
+
+func TestCompactionInput_TotalTokens(t *testing.T) {
+	tok := NewTokenizer()
+	history := compactionTestHistory(2)
+	system, task := schema.SystemMessage("system"), schema.UserMessage("task")
+	in := CompactionInput{Tokenizer: tok, ReservedTokens: tok.CountMessagesTokens([]*schema.Message{system, task})}
+	res := CompactionResult{Summary: "summary", Messages: history}
+
+	rebuilt := append([]*schema.Message{system, task, compactionCheckpointMessage(res.Summary)}, history...)
+	if got, want := in.totalTokens(res), tok.CountMessagesTokens(rebuilt); got != want {
+		t.Errorf("totalTokens() = %d, want %d", got, want)
+	}
+}
+
+func TestAgentCompact_MultiTurn(t *testing.T) {
+	big := strings.Repeat("result ", 200)
+	history := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("turn 1"),
+		toolCallMsg("a", "search", `{}`),
+		schema.ToolMessage(big, "a"),
+		schema.AssistantMessage("answer 1", nil),
+		schema.UserMessage("turn 2"),
+		toolCallMsg("b", "search", `{}`),
+		schema.ToolMessage(big, "b"),
+	}
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		return schema.AssistantMessage("## Goal\n- turn 1", nil), nil
+	}}
+
+	tests := []struct {
+		name          string
+		compactor     Compactor
+		wantRoles     []schema.RoleType
+		wantTaskIndex int
+	}{
+		{
+			name:          "summary",
+			compactor:     NewSummaryCompactor(nil),
+			wantRoles:     []schema.RoleType{schema.System, schema.User, schema.User, schema.Assistant, schema.Tool},
+			wantTaskIndex: 1,
+		},
+		{
+			name:          "previous turns kept by the compactor stay before the task",
+			compactor:     NewToolResultClearingCompactor(),
+			wantRoles:     []schema.RoleType{schema.System, schema.User, schema.Assistant, schema.Tool, schema.Assistant, schema.User, schema.Assistant, schema.Tool},
+			wantTaskIndex: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAgent(t, AgentConfig{Model: m, MaxTokens: 100000, Compactor: tt.compactor, CompactPreserveRecentTokens: 100000})
+			state := &agentLoopState{messages: history, taskIndex: 5}
+			a.compact(context.Background(), state, NewTokenizer())
+
+			if len(state.messages) != len(tt.wantRoles) {
+				t.Fatalf("got %d messages %v, want roles %v", len(state.messages), state.messages, tt.wantRoles)
+			}
+			for i, role := range tt.wantRoles {
+				if state.messages[i].Role != role {
+					t.Errorf("messages[%d].Role = %s, want %s", i, state.messages[i].Role, role)
+				}
+			}
+			if state.taskIndex != tt.wantTaskIndex || state.messages[state.taskIndex].Content != "turn 2" {
+				t.Errorf("task index = %d, want %d pointing at turn 2", state.taskIndex, tt.wantTaskIndex)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+// clearedToolResult replaces the content of tool results cleared by [NewToolResultClearingCompactor].
+const clearedToolResult = "[tool result cleared to save context]"
+
+// Compactor compacts the conversation history when it approaches AgentConfig.MaxTokens.
+// See AgentConfig.Compactor.
+type Compactor interface {
+	Compact(ctx context.Context, in CompactionInput) (CompactionResult, error)
+}
+
+// CompactionInput is the history passed to a [Compactor].
+//
+// The system message and the task message, the user message of the current turn, are not
+// included: they are always kept, followed by a checkpoint message carrying CompactionResult.Summary
+// (if not empty) and CompactionResult.Messages. In a multi-turn conversation Messages starts with
+// the previous turns, up to CurrentTurn. PreserveRecentTokens never exceeds the tokens of the
+// current turn, so a recent tail kept verbatim never reaches into the previous turns.
+type CompactionInput struct {
+	Messages             []*schema.Message   // Previous turns and the current turn, oldest first, without the task and checkpoint messages
+	CurrentTurn          int                 // Index of the first message of the current turn in Messages; 0 in the first turn
+	PreviousSummary      string              // Summary of the previous compactions; "" if none
+	Tokenizer            Tokenizer           // Calibrated tokenizer of the execution
+	ReservedTokens       int                 // Tokens of the system and task messages, including the reply priming of CountMessagesTokens
+	TargetTokens         int                 // Compaction was triggered because the whole history exceeds this many tokens
+	PreserveRecentTokens int                 // Budget of the recent tail to keep verbatim, see AgentConfig.CompactPreserveRecentTokens, at most the tokens of the current turn
+	Model                model.BaseChatModel // AgentConfig.CompactionModel, or AgentConfig.Model
+}
+
+// CompactionResult is the compacted history returned by a [Compactor].
+type CompactionResult struct {
+	Summary  string            // Summary of everything compacted so far; return CompactionInput.PreviousSummary to keep it
+	Messages []*schema.Message // Messages kept, oldest first
+
+	// CurrentTurn is the index of the first message of the current turn in Messages. The messages
+	// before it are kept from the previous turns and placed before the task message, the others
+	// after the checkpoint message. Leave it 0 if no message of the previous turns is kept.
+	CurrentTurn int
+}
+
+// totalTokens estimates the tokens of the whole history rebuilt from res.
+func (in CompactionInput) totalTokens(res CompactionResult) int {
+	// ReservedTokens includes the reply priming already, so it is not counted again for res.Messages.
+	n := in.ReservedTokens + sumMessageTokens(in.Tokenizer, res.Messages)
+	if res.Summary != "" {
+		n += in.Tokenizer.CountMessageTokens(compactionCheckpointMessage(res.Summary))
+	}
+	return n
+}
+
+// unchanged returns the result that keeps the history as is.
+func (in CompactionInput) unchanged() CompactionResult {
+	return CompactionResult{Summary: in.PreviousSummary, Messages: in.Messages, CurrentTurn: in.CurrentTurn}
+}
+
+// compactionCheckpointMessage builds the user message carrying the compaction summary.
+func compactionCheckpointMessage(summary string) *schema.Message {
+	return schema.UserMessage(fmt.Sprintf(
+		"<conversation-checkpoint>\n<summary>\n%s\n</summary>\n</conversation-checkpoint>",
+		summary,
+	))
+}
+
+// isCompactionCheckpoint reports whether msg is a checkpoint message built by compactionCheckpointMessage.
+func isCompactionCheckpoint(msg *schema.Message) bool {
+	return msg.Role == schema.User && strings.HasPrefix(msg.Content, "<conversation-checkpoint>")
+}
+
+// summaryCompactor summarizes the messages older than the recent tail.
+type summaryCompactor struct {
+	model model.BaseChatModel
+}
+
+// NewSummaryCompactor returns a Compactor that summarizes the messages older than
+// CompactionInput.PreserveRecentTokens into a structured checkpoint with m, merging in the
+// previous summary. The recent messages are kept verbatim. If m is nil, CompactionInput.Model is
+// used. This is the default Compactor.
+func NewSummaryCompactor(m model.BaseChatModel) Compactor {
+	return &summaryCompactor{model: m}
+}
+
+func (c *summaryCompactor) Compact(ctx context.Context, in CompactionInput) (CompactionResult, error) {
+	toSummarize, toKeep := splitRecentMessages(in.Messages, in.Tokenizer, in.PreserveRecentTokens)
+	if len(toSummarize) == 0 {
+		return in.unchanged(), nil
+	}
+	summary, err := runCompaction(ctx, modelOr(c.model, in.Model), in.PreviousSummary, toSummarize)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	if summary == "" {
+		return CompactionResult{}, errs.NewErrf("compaction returned empty summary")
+	}
+	return CompactionResult{Summary: summary, Messages: toKeep}, nil
+}
+
+// defaultCompactionChunkTokens is the chunk size of [NewHierarchicalSummaryCompactor] if none is given.
+const defaultCompactionChunkTokens = 32_000
+
+// hierarchicalSummaryCompactor summarizes chunks of old messages separately, then merges them.
+type hierarchicalSummaryCompactor struct {
+	model       model.BaseChatModel
+	chunkTokens int
+}
+
+// NewHierarchicalSummaryCompactor returns a Compactor like [NewSummaryCompactor] that splits the
+// messages to summarize into chunks of at most chunkTokens, summarizes each chunk, and merges the
+// chunk summaries and the previous summary into one. Use it when the messages to summarize may
+// not fit in the context window of the summarizing model. If m is nil, CompactionInput.Model is used.
+// If chunkTokens is not positive, chunks of 32k tokens are used.
+func NewHierarchicalSummaryCompactor(m model.BaseChatModel, chunkTokens int) Compactor {
+	if chunkTokens <= 0 {
+		chunkTokens = defaultCompactionChunkTokens
+	}
+	return &hierarchicalSummaryCompactor{model: m, chunkTokens: chunkTokens}
+}
+
+func (c *hierarchicalSummaryCompactor) Compact(ctx context.Context, in CompactionInput) (CompactionResult, error) {
+	toSummarize, toKeep := splitRecentMessages(in.Messages, in.Tokenizer, in.PreserveRecentTokens)
+	if len(toSummarize) == 0 {
+		return in.unchanged(), nil
+	}
+	m := modelOr(c.model, in.Model)
+	chunks := chunkMessages(toSummarize, in.Tokenizer, c.chunkTokens)
+	if len(chunks) == 1 {
+		return (&summaryCompactor{model: m}).Compact(ctx, in)
+	}
+
+	parts := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		part, err := runCompaction(ctx, m, "", chunk)
+		if err != nil {
+			return CompactionResult{}, errs.Wrapf(err, "failed to summarize chunk %d of %d", i+1, len(chunks))
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return CompactionResult{}, errs.NewErrf("compaction returned empty summary")
+	}
+	resp, err := m.Generate(ctx, []*schema.Message{schema.UserMessage(buildMergeSummariesPrompt(in.PreviousSummary, parts))})
+	if err != nil {
+		return CompactionResult{}, errs.Wrapf(err, "failed to merge chunk summaries")
+	}
+	if resp.Content == "" {
+		return CompactionResult{}, errs.NewErrf("compaction returned empty summary")
+	}
+	return CompactionResult{Summary: resp.Content, Messages: toKeep}, nil
+}
+
+// chunkMessages splits msgs into consecutive chunks of at most maxTokens each.
+// A message larger than maxTokens forms a chunk of its own.
+func chunkMessages(msgs []*schema.Message, tokenizer Tokenizer, maxTokens int) [][]*schema.Message {
+	var chunks [][]*schema.Message
+	var cur []*schema.Message
+	curTokens := 0
+	for _, msg := range msgs {
+		t := tokenizer.CountMessageTokens(msg)
+		if len(cur) > 0 && curTokens+t > maxTokens {
+			chunks = append(chunks, cur)
+			cur, curTokens = nil, 0
+		}
+		cur = append(cur, msg)
+		curTokens += t
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// buildMergeSummariesPrompt builds the LLM prompt merging chunk summaries, oldest first.
+func buildMergeSummariesPrompt(previousSummary string, parts []string) string {
+	var sb strings.Builder
+	if previousSummary != "" {
+		sb.WriteString("<previous-summary>\n" + previousSummary + "\n</previous-summary>\n\n")
+	}
+	for i, p := range parts {
+		fmt.Fprintf(&sb, "<partial-summary index=\"%d\">\n%s\n</partial-summary>\n\n", i+1, p)
+	}
+	sb.WriteString("The partial summaries above cover consecutive parts of the conversation history, oldest first")
+	if previousSummary != "" {
+		sb.WriteString(", continuing from the previous summary")
+	}
+	sb.WriteString(".\nMerge them into one summary. When details conflict, later parts win.\n\n")
+	sb.WriteString(compactionSummaryTemplate)
+	return sb.String()
+}
+
+// toolResultClearingCompactor clears the content of old tool results.
+type toolResultClearingCompactor struct{}
+
+// NewToolResultClearingCompactor returns a Compactor that replaces the content of tool results
+// older than CompactionInput.PreserveRecentTokens with a short placeholder, without calling a
+// model. Tool calls and their results stay paired, so the model still sees what it did.
+// Combine it with a summarizing Compactor in [NewChainCompactor] to summarize only when clearing
+// is not enough.
+func NewToolResultClearingCompactor() Compactor {
+	return toolResultClearingCompactor{}
+}
+
+func (toolResultClearingCompactor) Compact(ctx context.Context, in CompactionInput) (CompactionResult, error) {
+	older, recent := splitRecentMessages(in.Messages, in.Tokenizer, in.PreserveRecentTokens)
+	out := make([]*schema.Message, 0, len(in.Messages))
+	for _, msg := range older {
+		if msg.Role == schema.Tool && len(msg.Content) > len(clearedToolResult) {
+			cp := *msg
+			cp.Content = clearedToolResult
+			msg = &cp
+		}
+		out = append(out, msg)
+	}
+	out = append(out, recent...)
+	return CompactionResult{Summary: in.PreviousSummary, Messages: out, CurrentTurn: in.CurrentTurn}, nil
+}
+
+// slidingWindowCompactor drops the messages older than the recent tail.
+type slidingWindowCompactor struct{}
+
+// NewSlidingWindowCompactor returns a Compactor that drops the messages older than
+// CompactionInput.PreserveRecentTokens without summarizing them. The previous summary, if any,
+// is kept. The kept messages never start with a tool result whose tool call was dropped.
+func NewSlidingWindowCompactor() Compactor {
+	return slidingWindowCompactor{}
+}
+
+func (slidingWindowCompactor) Compact(ctx context.Context, in CompactionInput) (CompactionResult, error) {
+	_, recent := splitRecentMessages(in.Messages, in.Tokenizer, in.PreserveRecentTokens)
+	return CompactionResult{Summary: in.PreviousSummary, Messages: recent}, nil
+}
+
+// chainCompactor runs compactors in order until the history fits.
+type chainCompactor struct {
+	compactors []Compactor
+}
+
+// NewChainCompactor returns a Compactor that runs compactors in order, each on the result of the
+// previous one, and stops as soon as the history is within CompactionInput.TargetTokens.
+// A failing compactor is skipped with a warning, unless it is the last one.
+//
+// Example:
+//
+//	// clear old tool results first, summarize with a cheaper model only if still too long
+//	compactor := agentloop.NewChainCompactor(
+//	    agentloop.NewToolResultClearingCompactor(),
+//	    agentloop.NewSummaryCompactor(cheapModel),
+//	)
+func NewChainCompactor(compactors ...Compactor) Compactor {
+	return &chainCompactor{compactors: compactors}
+}
+
+func (c *chainCompactor) Compact(ctx context.Context, in CompactionInput) (CompactionResult, error) {
+	res := in.unchanged()
+	for i, compactor := range c.compactors {
+		next, err := compactor.Compact(ctx, in)
+		if err != nil {
+			if i == len(c.compactors)-1 {
+				return res, err
+			}
+			flow.NewRail(ctx).Warnf("Compactor %d of %d failed, trying the next one, %v", i+1, len(c.compactors), err)
+			continue
+		}
+		res = next
+		if in.totalTokens(res) <= in.TargetTokens {
+			break
+		}
+		in.Messages, in.PreviousSummary, in.CurrentTurn = res.Messages, res.Summary, res.CurrentTurn
+	}
+	return res, nil
+}
+
+// modelOr returns m, or def if m is nil.
+func modelOr(m, def model.BaseChatModel) model.BaseChatModel {
+	if m != nil {
+		return m
+	}
+	return def
+}
+
+// compact runs the configured Compactor on the history and rebuilds it as
+// [system, task, checkpoint, kept...], where task is the user message of the current turn.
+// Failures are logged and leave the history unchanged.
+func (a *Agent) compact(ctx context.Context, state *agentLoopState, tokenizer Tokenizer) {
+	rail := flow.NewRail(ctx)
+	previous, task, current, ok := splitTurn(state.messages, state.taskIndex)
+	if !ok {
+		rail.Warnf("Compaction skipped: unexpected message structure (%d messages, task index %d)", len(state.messages), state.taskIndex)
+		return
+	}
+	if len(previous)+len(current) == 0 {
+		return
+	}
+
+	// The recent tail kept verbatim never reaches into the previous turns, so the task message
+	// stays next to the system message.
+	currentTokens := 0
+	for _, msg := range current {
+		currentTokens += tokenizer.CountMessageTokens(msg)
+	}
+	system := state.messages[0]
+	in := CompactionInput{
+		Messages:             append(slices.Clip(previous), current...),
+		CurrentTurn:          len(previous),
+		PreviousSummary:      state.compactionSummary,
+		Tokenizer:            tokenizer,
+		ReservedTokens:       tokenizer.CountMessagesTokens([]*schema.Message{system, task}),
+		TargetTokens:         a.config.MaxTokens - a.ops.compactBuffer,
+		PreserveRecentTokens: min(a.ops.compactPreserveRecentTokens, currentTokens),
+		Model:                a.ops.compactionModel,
+	}
+	before := tokenizer.CountMessagesTokens(state.messages)
+	rail.Infof("Compaction started: %d messages, ~%d tokens (target preserve_recent_tokens: %v)", len(in.Messages), before, in.PreserveRecentTokens)
+
+	res, err := a.ops.compactor.Compact(ctx, in)
+	if err != nil {
+		rail.Warnf("Compaction failed: %v", err)
+		return
+	}
+
+	// Rebuild as [system, task, checkpoint, recent...]. In a multi-turn conversation the task is
+	// the user message of the current turn, and the previous turns are in the checkpoint unless
+	// the compactor kept them, e.g. NewToolResultClearingCompactor: these stay before the task.
+	turn := min(max(res.CurrentTurn, 0), len(res.Messages))
+	newMessages := make([]*schema.Message, 0, 3+len(res.Messages))
+	newMessages = append(newMessages, system)
+	newMessages = append(newMessages, res.Messages[:turn]...)
+	newMessages = append(newMessages, task)
+	if res.Summary != "" {
+		newMessages = append(newMessages, compactionCheckpointMessage(res.Summary))
+	}
+	newMessages = append(newMessages, res.Messages[turn:]...)
+	after := tokenizer.CountMessagesTokens(newMessages)
+	if after >= before && res.Summary == state.compactionSummary {
+		rail.Infof("Compaction found nothing to compact")
+		return
+	}
+	state.compactionSummary = res.Summary
+	state.messages = newMessages
+	state.taskIndex = 1 + turn
+	rail.Infof("Compaction succeeded: summary %d chars, kept %d messages, new message set ~%d tokens", len([]rune(res.Summary)), len(res.Messages), after)
+	emitEvent(ctx, AgentEvent{Kind: AgentEventKindCompaction, Agent: a.config.Name, Summary: res.Summary})
+}
@@ -3,10 +3,10 @@ package agentloop
 import (
 	"context"
 	"embed"
-	"io/fs"
+	"time"
 
 	"github.com/cloudwego/eino/components/model"
-	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso-agent/agents"
 )
 
 // OutputCheckFunc is a callback invoked on each final assistant response before the agent
@@ -22,6 +22,8 @@ import (
 //   - ok=true: output is accepted; agent proceeds to final_output.
 //   - ok=false: output is rejected; hint is inserted as a user message and the agent retries.
 //   - err!=nil: unexpected failure (e.g. network error); the agent aborts immediately.
+//   - err is [ErrOutputCheckExhausted]: the check gives up; output is accepted and the run stops
+//     with StopReason [StopReasonOutputCheckExhausted].
 //
 // OutputCheckFunc may be used for any per-response validation: output format compliance,
 // quality assessment, security screening, and so on.
@@ -36,9 +38,11 @@ type AgentConfig struct {
 	// Model is the LLM model to use.
 	//
 	// Retry behavior is controlled by the model wrapper, not the agent itself.
-	// Use [agents.NewOpenAIChatModel] with [agents.WithRetry] to configure retry count and
-	// backoff. The default model uses exponential backoff (1s, 2s, 4s, capped at 5s) with
-	// 5 retries; 429 (rate limit) errors skip directly to the 5s cap.
+	// Use [agents.NewOpenAIChatModel] with [agents.WithRetry] or [agents.WithRetryPolicy] to
+	// configure it. By default rate limit, server and network errors are retried 5 times with
+	// jittered exponential backoff (1s, 2s, 4s, 8s, capped at 10s), or after the delay of a
+	// Retry-After header; bad requests and context overflows are not retried.
+	// To switch to another provider when the model keeps failing, use [agents.NewFallbackChatModel].
 	Model model.ToolCallingChatModel
 
 	// MaxRunSteps limits the maximum number of ReAct rounds (tool-call cycles) the agent may execute.
@@ -47,6 +51,12 @@ type AgentConfig struct {
 	// If 0 or negative, defaults to 5.
 	MaxRunSteps int
 
+	// FinalAnswerOnMaxSteps makes the last round allowed by MaxRunSteps a final answer round:
+	// tools are removed and the model is asked to synthesize its answer from what it has gathered.
+	// The run then returns that answer with StopReason [StopReasonMaxSteps] instead of failing
+	// with an exceeded step budget. If nil, defaults to false.
+	FinalAnswerOnMaxSteps *bool
+
 	// Language specifies the language for agent responses.
 	// If empty, defaults to "English".
 	Language string
@@ -90,11 +100,29 @@ type AgentConfig struct {
 	Timezone float64
 
 	// MaxTokens is the maximum number of tokens allowed in the conversation history.
-	// When exceeded, old messages will be pruned (except system messages).
+	// With Compaction, the history is compacted as it approaches MaxTokens. Without it, the
+	// oldest rounds (an assistant message with its tool results) are dropped once MaxTokens is
+	// exceeded, then older tool results are truncated if still needed. The system and task
+	// messages and the latest round are always kept.
 	// If 0 or negative, no token limit is enforced.
 	// Default: 0 (no limit)
 	MaxTokens int
 
+	// Tokenizer counts tokens for MaxTokens, compaction, tool result offloading and Budget.
+	// Default: [NewTokenizer], a CJK-aware estimate. Use bpe.NewTokenizer (package agentloop/bpe) for exact counts.
+	// Estimates are calibrated with the prompt tokens reported by the provider. The calibration is kept
+	// for the session: in checkpoints and in TaskOutput.Conversation, for the next turn.
+	Tokenizer Tokenizer
+
+	// ModelPrice is the price of Model, used to estimate TokenUsage.Cost and enforce Budget.MaxCost.
+	// If nil, it is looked up by model name in agents.ModelPriceTable (and fetched from models.dev
+	// when EnableModelsFetch is true). If still unknown, cost is not estimated.
+	ModelPrice *agents.ModelPrice
+
+	// Budget caps the token usage and estimated cost of each execution. See [Budget].
+	// AgentRequest.Budget overrides it per request. Default: no limits.
+	Budget Budget
+
 	// EnableModelsFetch enables runtime fetching of model context window sizes
 	// from models.dev when the model is not found in the build-time generated map.
 	// Fetched results are cached in memory for the process lifetime.
@@ -110,18 +138,63 @@ type AgentConfig struct {
 	// If nil, defaults to false.
 	EnableTodoTool *bool
 
+	// EnableAskUserTool enables the built-in ask_user tool. When the model calls it, the run stops
+	// with StopReason [StopReasonNeedsInput] and the question in TaskOutput.Question; resume the
+	// session with the user's answer in AgentRequest.Answer. Requires CheckpointStore to resume.
+	// If nil, defaults to false.
+	EnableAskUserTool *bool
+
+	// EnableSkillTool enables the built-in skill tools: activate_skill, which activates a skill
+	// explicitly, and load_skill, which returns a skill's instructions and lists its bundled
+	// files. A skill is also activated when the model reads its SKILL.md. While a skill listing
+	// allowed_tools in its frontmatter is active, other tools are not executed (reading files
+	// under /skills/ is always allowed). Activated skills are listed in TaskOutput.Metadata
+	// under MetadataKeyUsedSkills. If nil, defaults to false.
+	EnableSkillTool *bool
+
+	// MaxParallelToolCalls limits how many tool calls of one round run concurrently.
+	// Set to 1 to run them one at a time. Default: 0 (no limit).
+	MaxParallelToolCalls int
+
+	// MaxToolCallsPerTurn caps the number of tool calls executed per round. Calls beyond the cap,
+	// in the order the model made them, are not executed; the model is told to call them again
+	// in the next round. Default: 0 (no limit).
+	MaxToolCallsPerTurn int
+
+	// ToolTimeout is the default timeout of a single tool call. The deadline is set on the tool's
+	// context and passed to middleware as ToolCallRequest.Deadline. A tool that does not return
+	// in time is abandoned and the model receives a timeout error; it keeps its MaxParallelToolCalls
+	// slot until it returns. Default: 0 (no timeout).
+	ToolTimeout time.Duration
+
+	// ToolTimeouts overrides ToolTimeout for specific tools, keyed by tool name
+	// (e.g. a longer timeout for a slow search tool). A zero value disables the timeout for that tool.
+	ToolTimeouts map[string]time.Duration
+
 	// ToolEventCallback is called synchronously for each tool invocation during execution.
-	// Receives a ToolEvent with the tool name and raw JSON args before the tool runs.
+	// Receives a ToolEvent with the tool name and raw JSON args before the tool runs,
+	// and another one carrying the tool result after it finishes.
 	// Must not block for long — it runs within the agent graph execution.
 	// If nil, no events are emitted.
 	ToolEventCallback func(event ToolEvent)
 
-	// Compaction enables LLM-based context compaction when the conversation history
-	// approaches MaxTokens. Older messages are summarized into a structured checkpoint;
-	// recent messages are kept verbatim. Requires MaxTokens to be set.
-	// If nil, defaults to false.
+	// Compaction enables context compaction when the conversation history approaches MaxTokens.
+	// By default older messages are summarized into a structured checkpoint; recent messages are
+	// kept verbatim. Requires MaxTokens to be set.
+	// If nil, defaults to true when Compactor is set, false otherwise.
 	Compaction *bool
 
+	// Compactor compacts the history when Compaction is enabled. The system message and the
+	// task message are always kept, followed by the checkpoint message with the summary.
+	// Built-ins: [NewSummaryCompactor], [NewHierarchicalSummaryCompactor],
+	// [NewToolResultClearingCompactor], [NewSlidingWindowCompactor] and [NewChainCompactor].
+	// Default: NewSummaryCompactor(nil), summarizing with CompactionModel.
+	Compactor Compactor
+
+	// CompactionModel is the model summarizing the history, e.g. a cheaper model than Model.
+	// Used by the built-in compactors created with a nil model. Default: Model.
+	CompactionModel model.BaseChatModel
+
 	// CompactPreserveRecentTokens is the token budget for the verbatim recent tail kept after compaction.
 	// Messages within this budget (newest first) are sent to the model as-is; older messages are summarized.
 	// When MaxTokens is known, defaults to max(2000, min(8000, MaxTokens * 0.25)) — i.e., 25% of the
@@ -149,6 +222,25 @@ type AgentConfig struct {
 	// If nil, defaults to true. Set to a non-nil pointer to false to disable.
 	EnableToolOffload *bool
 
+	// ToolOffloadSummaryModel, if set, summarizes each offloaded tool result. The summary is
+	// included in the replacement message before the preview. JSON, CSV and Markdown results are
+	// previewed by their shape, rows or heading outline, anything else by its head and tail.
+	// If nil, no summary is written.
+	ToolOffloadSummaryModel model.BaseChatModel
+
+	// ClearToolResultsAfterRounds replaces the tool results older than this many rounds (an
+	// assistant message with tool calls and its results) with a short stub such as
+	// "[result cleared, saved at /large_tool_results/<id>]" before each model call. The full
+	// result is saved like an offloaded one, so the model can read it again with read_file.
+	// Results of the tools never offloaded are cleared without being saved. This keeps long
+	// runs under budget more cheaply than Compaction. If 0, results are not cleared by age.
+	ClearToolResultsAfterRounds int
+
+	// ClearToolResultsKeepTokens clears the tool results, newest first, once they exceed this
+	// many tokens in total, like ClearToolResultsAfterRounds. The results of the latest round are
+	// always kept, even if they exceed this on their own. If 0, results are not cleared by size.
+	ClearToolResultsKeepTokens int
+
 	// Middleware is an ordered list of middleware to apply to the agent loop.
 	// Middlewares are called in registration order for BeforeAgent, AfterAgent,
 	// SystemPromptFragment, and Tools; and composed into chains for WrapModelCall
@@ -164,6 +256,13 @@ type AgentConfig struct {
 	// or any other per-response review. If nil, no check is performed.
 	OutputCheck OutputCheckFunc
 
+	// CheckpointStore persists a snapshot of the run (messages, loop counters, todos, artifacts,
+	// metadata and token usage) before every model call, so a run interrupted by e.g. a process
+	// restart can be continued with [Agent.Resume]. The checkpoint is deleted once the run completes.
+	// Checkpoints are keyed by Name and session, so give agents sharing a store distinct names.
+	// Use [NewFileCheckpointStore] or [NewRedisCheckpointStore]. If nil, no checkpoints are saved.
+	CheckpointStore CheckpointStore
+
 	// EnableTrace enables per-node execution tracing. When true, each graph node's input and
 	// output are JSON-marshaled and collected in TaskOutput.TraceLogs. ChatModel entries include
 	// the full message history per call, so TraceLogs can grow large on long multi-turn runs.
@@ -171,30 +270,13 @@ type AgentConfig struct {
 	EnableTrace *bool
 }
 
-// skillsMiddleware is a Middleware that writes pre-embedded skill files into the
-// agent's FileStore during BeforeAgent, so they are discoverable from /skills/.
-type skillsMiddleware struct {
-	BaseMiddleware
-	files map[string]string // virtualPath -> content
-}
-
-func (m *skillsMiddleware) Name() string { return "skills" }
-
-func (m *skillsMiddleware) BeforeAgent(ctx context.Context, agentCtx AgentContext) error {
-	for path, content := range m.files {
-		if err := agentCtx.Store.WriteFile(ctx, path, []byte(content)); err != nil {
-			return errs.Wrapf(err, "failed to write skill %s", path)
-		}
-	}
-	return nil
-}
-
 // BuildPreloadedSkills builds a skills Middleware from an embedded filesystem.
 // The efs root must contain skill directories directly (each with a SKILL.md file).
 // If skillNames are provided, only skills with matching directory names are included;
 // if no skillNames are given, all top-level skill directories are included.
 // The Middleware writes skill files into the agent's store during BeforeAgent so
 // they are discoverable from the /skills/ directory on each execution.
+// See [NewSkillSourceMiddleware] to load skills from OS directories, bundles or a [SkillRegistry].
 //
 // Example:
 //
@@ -211,39 +293,5 @@ func (m *skillsMiddleware) BeforeAgent(ctx context.Context, agentCtx AgentContex
 //	    Middleware: []agentloop.Middleware{agentloop.BuildPreloadedSkills(skillsFS, "humanizer", "web-research")},
 //	})
 func BuildPreloadedSkills(efs embed.FS, skillNames ...string) Middleware {
-	nameSet := make(map[string]bool, len(skillNames))
-	for _, n := range skillNames {
-		nameSet[n] = true
-	}
-
-	files := make(map[string]string)
-
-	entries, err := fs.ReadDir(efs, ".")
-	if err != nil {
-		return &skillsMiddleware{files: files}
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if len(nameSet) > 0 && !nameSet[name] {
-			continue
-		}
-
-		_ = fs.WalkDir(efs, name, func(path string, d fs.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return nil
-			}
-			content, err := efs.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			files["/skills/"+path] = string(content)
-			return nil
-		})
-	}
-
-	return &skillsMiddleware{files: files}
+	return NewSkillSourceMiddleware([]SkillSource{NewFSSkillSource(efs, skillNames...)})
 }
@@ -0,0 +1,91 @@
+package agentloop
+
+import (
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// Conversation carries the message history of previous turns so a follow-up request can
+// continue where the last one stopped, instead of starting from scratch.
+//
+// Every [TaskOutput] includes the Conversation at the end of its run; pass it back via
+// AgentRequest.Conversation together with the next UserInput:
+//
+//	out, _ := agent.Execute(rail, agentloop.AgentRequest{UserInput: "Research X"})
+//	out, _ = agent.Execute(rail, agentloop.AgentRequest{
+//	    UserInput:    "Now compare it with Y",
+//	    Conversation: out.Conversation,
+//	})
+//
+// Conversation is JSON-serializable, so it can be persisted between turns.
+type Conversation struct {
+	// Messages are the user, assistant and tool messages of previous turns, oldest first.
+	// The system prompt is not included; it is rebuilt on every turn.
+	// A compaction checkpoint message, if any, is kept in place.
+	Messages []*schema.Message `json:"messages"`
+
+	// CompactionSummary is the latest compaction summary, so the next compaction
+	// updates it instead of starting a new one.
+	CompactionSummary string `json:"compactionSummary"`
+
+	// TokenRatio is the calibration of the Tokenizer against the prompt tokens reported by the
+	// provider so far, so the next turn starts calibrated. 0 if nothing has been observed.
+	TokenRatio float64 `json:"tokenRatio,omitempty"`
+}
+
+// buildTurnMessages builds the initial message list of a turn: [system, history..., user].
+//
+// A leading system message in conv is dropped, since the system prompt is rebuilt for every turn.
+// The remaining history must start with a user message: compaction and pruning keep the history
+// starting with one, and most providers reject a history that starts with an assistant or tool message.
+func buildTurnMessages(systemMsg *schema.Message, conv *Conversation, task string) ([]*schema.Message, error) {
+	var history []*schema.Message
+	if conv != nil {
+		history = conv.Messages
+	}
+	if len(history) > 0 && history[0].Role == schema.System {
+		history = history[1:]
+	}
+	if len(history) > 0 && history[0].Role != schema.User {
+		return nil, errs.NewErrf("conversation history must start with a user message, got %s", history[0].Role)
+	}
+
+	msgs := make([]*schema.Message, 0, len(history)+2)
+	msgs = append(msgs, systemMsg)
+	msgs = append(msgs, history...)
+	msgs = append(msgs, schema.UserMessage(task))
+	return msgs, nil
+}
+
+// conversationFromState returns the Conversation at the end of a run, excluding the system prompt.
+func conversationFromState(messages []*schema.Message, compactionSummary string, tokenRatio float64) *Conversation {
+	if len(messages) > 0 && messages[0].Role == schema.System {
+		messages = messages[1:]
+	}
+	return &Conversation{
+		Messages:          append(make([]*schema.Message, 0, len(messages)), messages...),
+		CompactionSummary: compactionSummary,
+		TokenRatio:        tokenRatio,
+	}
+}
+
+// splitTurn splits messages, [system, previous turns..., task, current turn...], around task, the
+// user message of the current turn at taskIndex. Compaction checkpoints and pruning notices are left
+// out of previous and current. A taskIndex below 1 is treated as 1. ok is false if messages does not
+// have this structure.
+func splitTurn(messages []*schema.Message, taskIndex int) (previous []*schema.Message, task *schema.Message, current []*schema.Message, ok bool) {
+	taskIndex = max(taskIndex, 1)
+	if len(messages) <= taskIndex || messages[0].Role != schema.System || messages[taskIndex].Role != schema.User {
+		return nil, nil, nil, false
+	}
+	keep := func(msgs []*schema.Message) []*schema.Message {
+		out := make([]*schema.Message, 0, len(msgs))
+		for _, msg := range msgs {
+			if !isCompactionCheckpoint(msg) && !isPrunedHistoryNotice(msg) {
+				out = append(out, msg)
+			}
+		}
+		return out
+	}
+	return keep(messages[1:taskIndex]), messages[taskIndex], keep(messages[taskIndex+1:]), true
+}
@@ -0,0 +1,97 @@
+package agentloop
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestBuildTurnMessages(t *testing.T) {
+	sys := schema.SystemMessage("new system")
+	history := []*schema.Message{
+		schema.UserMessage("turn 1"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{ID: "c1", Function: schema.FunctionCall{Name: "glob"}}}},
+		schema.ToolMessage("a.md", "c1"),
+		schema.AssistantMessage("answer 1", nil),
+	}
+
+	tests := []struct {
+		name      string
+		conv      *Conversation
+		wantRoles []schema.RoleType
+		wantErr   bool
+	}{
+		{
+			name:      "new conversation",
+			conv:      nil,
+			wantRoles: []schema.RoleType{schema.System, schema.User},
+		},
+		{
+			name:      "empty conversation",
+			conv:      &Conversation{},
+			wantRoles: []schema.RoleType{schema.System, schema.User},
+		},
+		{
+			name:      "follow-up turn",
+			conv:      &Conversation{Messages: history},
+			wantRoles: []schema.RoleType{schema.System, schema.User, schema.Assistant, schema.Tool, schema.Assistant, schema.User},
+		},
+		{
+			name:      "leading system message dropped",
+			conv:      &Conversation{Messages: append([]*schema.Message{schema.SystemMessage("old system")}, history...)},
+			wantRoles: []schema.RoleType{schema.System, schema.User, schema.Assistant, schema.Tool, schema.Assistant, schema.User},
+		},
+		{
+			name:    "history starting with assistant",
+			conv:    &Conversation{Messages: history[1:]},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildTurnMessages(sys, tt.conv, "turn 2")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildTurnMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.wantRoles) {
+				t.Fatalf("got %d messages, want %d", len(got), len(tt.wantRoles))
+			}
+			for i, role := range tt.wantRoles {
+				if got[i].Role != role {
+					t.Errorf("messages[%d].Role = %s, want %s", i, got[i].Role, role)
+				}
+			}
+			if got[0] != sys {
+				t.Error("messages[0] should be the new system prompt")
+			}
+			if last := got[len(got)-1]; last.Content != "turn 2" {
+				t.Errorf("last message = %q, want %q", last.Content, "turn 2")
+			}
+		})
+	}
+}
+
+func TestConversationFromState(t *testing.T) {
+	msgs := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("task"),
+		schema.AssistantMessage("done", nil),
+	}
+	conv := conversationFromState(msgs, "## Goal", 0)
+	if len(conv.Messages) != 2 || conv.Messages[0].Role != schema.User {
+		t.Fatalf("Messages = %+v, want [user, assistant]", conv.Messages)
+	}
+	if conv.CompactionSummary != "## Goal" {
+		t.Errorf("CompactionSummary = %q", conv.CompactionSummary)
+	}
+
+	// The returned slice must not alias the state slice.
+	conv.Messages[0] = schema.UserMessage("changed")
+	if msgs[1].Content != "task" {
+		t.Error("conversationFromState aliases the state messages")
+	}
+}
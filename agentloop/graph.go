@@ -2,6 +2,7 @@ package agentloop
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -16,11 +17,23 @@ import (
 type agentLoopState struct {
 	taskInput           taskInput
 	messages            []*schema.Message
+	taskIndex           int // index of the user message of the current turn in messages, see splitTurn
 	cycleCount          int
 	compactionSummary   string
 	outputCheckAttempts int
+
+	// forceFinal is set when the loop must end: the next model call has no tools and its
+	// answer is final, or the current answer is accepted as final. It becomes TaskOutput.StopReason.
+	forceFinal     StopReason
+	budgetExceeded BudgetLimit
 }
 
+// forcedFinalAnswerPrompt is appended as a user message when the loop must stop calling tools.
+const forcedFinalAnswerPrompt = `<system-reminder>
+%s No more tool calls are possible. Using only the information gathered so far, write your final answer to the task now.
+If the task is not fully done, say what was completed and what remains.
+</system-reminder>`
+
 // shouldContinueLoop reports whether the agent loop should continue after the given assistant message.
 // The loop continues when the assistant has tool calls; it stops on a plain-text response.
 func shouldContinueLoop(lastMsg *schema.Message) bool {
@@ -41,6 +54,20 @@ type TokenUsage struct {
 	PromptTokens     int // Total input tokens consumed across all LLM calls
 	CompletionTokens int // Total output tokens generated across all LLM calls
 	CachedTokens     int // Total prompt tokens served from cache across all LLM calls
+
+	Cost float64 // Estimated cost in USD; 0 when the model price is unknown (see AgentConfig.ModelPrice)
+
+	// ByModel breaks the usage down per model name, including sub-agents invoked via NewSubAgentTool.
+	// Models that do not implement agents.ModelNamer are reported as "unknown".
+	ByModel map[string]ModelUsage
+}
+
+// ModelUsage is the token usage and estimated cost of one model within a TokenUsage.
+type ModelUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int
+	Cost             float64 // Estimated cost in USD; 0 when the model price is unknown
 }
 
 // Artifact represents a discovered or created artifact during agent execution
@@ -52,11 +79,31 @@ type Artifact struct {
 
 // TaskOutput represents the output from an agent execution
 type TaskOutput struct {
+	SessionId  string         // Session ID of the execution; pass it back to resume a suspended run
 	Response   string         // Main response (research report)
 	Artifacts  []Artifact     // Artifacts collected during execution
 	Metadata   map[string]any // Snapshot of MetadataStore at end of execution
 	TokenUsage TokenUsage     // Aggregate token usage across all LLM calls
 	TraceLogs  []TraceEntry   // Per-node execution trace; populated when AgentConfig.EnableTrace is true, nil otherwise. Populated even when execution returns an error. ChatModel entries include the full message history per call, so size grows with each ReAct cycle.
+
+	// Conversation is the message history at the end of the run, including this turn.
+	// Pass it as AgentRequest.Conversation to continue with a follow-up turn.
+	Conversation *Conversation
+
+	// StopReason explains why the run stopped.
+	StopReason StopReason
+
+	// PendingApprovals lists the tool calls awaiting a decision; set when StopReason is StopReasonPendingApproval.
+	PendingApprovals []PendingToolCall
+
+	// Question is the question asked via the ask_user tool; set when StopReason is StopReasonNeedsInput.
+	Question string
+
+	// BudgetExceeded names the Budget limit that stopped the run; set when StopReason is StopReasonBudgetExceeded.
+	BudgetExceeded BudgetLimit
+
+	// Todos is the todo list at the end of the run; empty unless the todo tools were used.
+	Todos []TodoItem
 }
 
 // taskOutput is the internal output type used by the graph
@@ -67,6 +114,13 @@ type taskInput struct {
 	task   string
 	skills *Skills
 	store  FileStore
+	resume *Checkpoint // non-nil when continuing a checkpointed run
+
+	conversation *Conversation      // history of previous turns; nil for a new conversation
+	approvals    []ApprovalDecision // decisions on the checkpoint's pending approvals when resuming
+	answer       string             // answer to the checkpoint's pending question when resuming
+	budget       Budget             // effective budget of the execution
+	typed        *typedOutput       // expected JSON output of ExecuteTyped; nil for Execute
 }
 
 // buildGraph builds the Eino graph for the ReAct agent.
@@ -86,8 +140,58 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 		}),
 	)
 
+	toolInfos := agent.tools.ToEinoToolsWithChain(agent.middleware)
+	// The tools node also runs the calls approved on resume, so they get the same middlewares,
+	// callbacks and tool call IDs as any other call.
+	var toolNode *compose.ToolsNode
+	if len(toolInfos) > 0 {
+		var err error
+		toolNode, err = compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
+			Tools:               toolInfos,
+			UnknownToolsHandler: buildUnknownToolHandler(toolInfos),
+			ToolCallMiddlewares: []compose.ToolMiddleware{
+				{Invokable: buildSkillToolMiddleware()},
+				{Invokable: buildToolLimitMiddleware(&agent.config)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Prepare messages node - runs once at start
 	_ = g.AddLambdaNode("prepare_messages", compose.InvokableLambda(func(ctx context.Context, input taskInput) ([]*schema.Message, error) {
+		// Resuming: continue from the checkpointed history, which already starts with the system prompt.
+		if cp := input.resume; cp != nil && len(cp.Messages) > 0 {
+			msgs := cp.Messages
+			if len(cp.PendingApprovals) > 0 {
+				var err error
+				msgs, err = resolvePendingApprovals(ctx, msgs, cp.PendingApprovals, input.approvals, toolNode)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if cp.PendingQuestion != nil {
+				var err error
+				msgs, err = resolvePendingQuestion(msgs, cp.PendingQuestion, input.answer)
+				if err != nil {
+					return nil, err
+				}
+			}
+			_ = compose.ProcessState(ctx, func(ctx context.Context, st *agentLoopState) error {
+				trackProgress(ctx, st)
+				st.taskInput = input
+				st.cycleCount = cp.CycleCount
+				st.compactionSummary = cp.CompactionSummary
+				st.outputCheckAttempts = cp.OutputCheckAttempts
+				st.taskIndex = cp.TaskIndex
+				st.forceFinal = cp.ForceFinal
+				st.budgetExceeded = cp.BudgetExceeded
+				return nil
+			})
+			return msgs, nil
+		}
+
 		fragments := make([]string, 0, len(agent.middleware))
 		for _, m := range agent.middleware {
 			if f := m.SystemPromptFragment(ctx); f != "" {
@@ -100,7 +204,10 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 			WithSkills(input.skills).
 			WithLanguage(agent.ops.language).
 			WithCurrentTime(GetCurrentTime(agent.config.Timezone)).
-			WithFileOps(agent.ops.enableFileTool)
+			WithFileOps(agent.ops.enableFileTool).
+			WithAskUser(agent.ops.enableAskUserTool).
+			WithSkillTool(agent.ops.enableSkillTool).
+			WithOutputSchema(typedOutputSchema(input.typed))
 		systemMsg, err := promptBuilder.Build(ctx)
 		if err != nil {
 			return nil, err
@@ -110,18 +217,25 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 			r.Infof("[%v] Init System Prompt:\n%s", agent.config.Name, systemMsg.Content)
 		})
 
-		userMsg := schema.UserMessage(input.task)
+		msgs, err := buildTurnMessages(systemMsg, input.conversation, input.task)
+		if err != nil {
+			return nil, err
+		}
 
 		_ = compose.ProcessState(ctx, func(ctx context.Context, st *agentLoopState) error {
+			trackProgress(ctx, st)
 			st.taskInput = input
+			st.taskIndex = len(msgs) - 1
+			if input.conversation != nil {
+				st.compactionSummary = input.conversation.CompactionSummary
+			}
 			return nil
 		})
 
-		return []*schema.Message{systemMsg, userMsg}, nil
+		return msgs, nil
 	}), compose.WithNodeName(nodeNamePrepareMessages))
 
 	// Chat model node - uses StatePreHandler to manage message accumulation
-	toolInfos := agent.tools.ToEinoToolsWithChain(agent.middleware)
 	toolInfoList := make([]*schema.ToolInfo, len(toolInfos))
 	for i, tool := range toolInfos {
 		info, err := tool.Info(context.Background())
@@ -142,13 +256,30 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 		chatModel = agent.config.Model
 	}
 
-	// Wrap chatModel with middleware WrapModelCall chain, if any middleware registered.
+	// Wrap chatModel with the middleware WrapModelCall chain.
 	// This preserves AddChatModelNode semantics (callbacks, token tracking) while allowing
-	// middleware to intercept model inputs and outputs.
-	if len(agent.middleware) > 0 {
+	// middleware to intercept model inputs and outputs. The terminal handler switches to
+	// Stream() when the execution was started via ExecuteStream, so deltas can be forwarded.
+	// When the loop is forced to end (see agentLoopState.forceFinal), the model without tools is used.
+	{
 		inner := chatModel
 		terminal := func(ctx context.Context, req *ModelCallRequest) (*ModelCallResponse, error) {
-			msg, err := inner.Generate(ctx, req.Messages)
+			m := inner
+			var opts []model.Option
+			_ = compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
+				if state.forceFinal != "" {
+					m = agent.config.Model
+				}
+				opts = typedModelOpts(state.taskInput.typed)
+				return nil
+			})
+			var msg *schema.Message
+			var err error
+			if sink := eventSinkFromCtx(ctx); sink != nil {
+				msg, err = streamGenerate(ctx, agent.config.Name, m, req.Messages, sink, opts...)
+			} else {
+				msg, err = m.Generate(ctx, req.Messages, opts...)
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -158,49 +289,64 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 		chatModel = &middlewareModel{ToolCallingChatModel: inner, chain: chain}
 	}
 
+	toolTokens := estimateToolTokens(agent.tokenizer, toolInfoList)
+
 	modelPreHandle := func(ctx context.Context, input []*schema.Message, state *agentLoopState) ([]*schema.Message, error) {
 		state.cycleCount++
+		// Token counts are corrected with the prompt tokens reported by the provider so far.
+		tokenizer := agent.tokenizerFor(ctx)
 		if agent.ops.enableToolOffload {
-			input = offloadToolResults(ctx, input, state.messages, state.taskInput.store, agent.tokenizer, agent.ops.toolOffloadTokenLimit, agent.ops.toolOffloadResultsPathPrefix)
+			input = offloadToolResults(ctx, input, state.messages, state.taskInput.store, tokenizer, agent.ops.toolOffloadTokenLimit, agent.ops.toolOffloadResultsPathPrefix, agent.ops.toolOffloadSummaryModel)
 		}
 		state.messages = append(state.messages, input...)
+		if agent.ops.clearToolResultsAfterRounds > 0 || agent.ops.clearToolResultsKeepTokens > 0 {
+			var store FileStore
+			if agent.ops.enableFileTool {
+				store = state.taskInput.store
+			}
+			state.messages = clearStaleToolResults(ctx, state.messages, store, tokenizer, agent.ops.clearToolResultsAfterRounds, agent.ops.clearToolResultsKeepTokens, agent.ops.toolOffloadResultsPathPrefix)
+		}
 
-		// Compact if MaxTokens is set and exceeded threshold
-		if agent.config.MaxTokens > 0 && agent.ops.compaction && agent.tokenizer.CountMessagesTokens(state.messages) > agent.config.MaxTokens-agent.ops.compactBuffer {
-			rail := flow.NewRail(ctx)
-			toSummarize, toKeep := selectForCompaction(state.messages, agent.tokenizer, agent.ops.compactPreserveRecentTokens)
-			if toSummarize == nil && toKeep == nil && len(state.messages) >= 3 {
-				rail.Warnf("Compaction skipped: unexpected message structure (messages[0]=%s, messages[1]=%s)", state.messages[0].Role, state.messages[1].Role)
-				return state.messages, nil
+		// Compact if MaxTokens is set and exceeded threshold, otherwise prune once MaxTokens is exceeded
+		if agent.config.MaxTokens > 0 {
+			if agent.ops.compaction {
+				if tokenizer.CountMessagesTokens(state.messages) > agent.config.MaxTokens-agent.ops.compactBuffer {
+					agent.compact(ctx, state, tokenizer)
+				}
+			} else if tokenizer.CountMessagesTokens(state.messages) > agent.config.MaxTokens {
+				agent.prune(ctx, state, tokenizer)
 			}
-			if len(toSummarize) > 0 {
-				rail.Infof("Compaction started: summarizing %d messages, keeping %d (target preserve_recent_tokens: %v)", len(toSummarize), len(toKeep), agent.ops.compactPreserveRecentTokens)
-				summary, err := runCompaction(ctx, agent.config.Model, state.compactionSummary, toSummarize)
-				if err == nil && summary != "" {
-					state.compactionSummary = summary
-					checkpoint := schema.UserMessage(fmt.Sprintf(
-						"<conversation-checkpoint>\n<summary>\n%s\n</summary>\n</conversation-checkpoint>",
-						summary,
-					))
-
-					// Rebuild as [system, original_user_task, checkpoint, recent...]
-					// messages[0] and messages[1] are always preserved intact.
-					newMessages := make([]*schema.Message, 0, 3+len(toKeep))
-					newMessages = append(newMessages, state.messages[0], state.messages[1])
-					newMessages = append(newMessages, checkpoint)
-					newMessages = append(newMessages, toKeep...)
-					state.messages = newMessages
-					rail.Infof("Compaction succeeded: summary %d chars, new message set ~%d tokens", len([]rune(summary)), agent.tokenizer.CountMessagesTokens(newMessages))
-				} else {
-					if err != nil {
-						rail.Warnf("Compaction failed: %v", err)
-					} else {
-						rail.Warnf("Compaction returned empty summary")
-					}
+		}
+
+		// Make the last allowed round a final answer round.
+		if state.forceFinal == "" && agent.ops.finalAnswerOnMaxSteps && state.cycleCount >= agent.config.MaxRunSteps {
+			flow.NewRail(ctx).Infof("[%v] Reached MaxRunSteps (%v), forcing final answer", agent.config.Name, agent.config.MaxRunSteps)
+			state.forceFinal = StopReasonMaxSteps
+			state.messages = append(state.messages, schema.UserMessage(fmt.Sprintf(forcedFinalAnswerPrompt, "This is the last step allowed for this task.")))
+		}
+
+		// Stop the loop if the next call would exceed the budget.
+		if state.forceFinal == "" && !state.taskInput.budget.isZero() {
+			if acc, ok := ctx.Value(tokenAccCtxKey).(*tokenAccumulator); ok && acc != nil {
+				if limit := acc.checkBudget(state.taskInput.budget, tokenizer.CountMessagesTokens(state.messages)); limit != "" {
+					flow.NewRail(ctx).Infof("[%v] Budget limit %v reached, forcing final answer", agent.config.Name, limit)
+					state.forceFinal = StopReasonBudgetExceeded
+					state.budgetExceeded = limit
+					state.messages = append(state.messages, schema.UserMessage(fmt.Sprintf(forcedFinalAnswerPrompt, "The token or cost budget of this task is exhausted.")))
 				}
 			}
 		}
 
+		// Record the raw estimate of this call; the trace callback compares it with the reported usage.
+		if c := tokenCalibrationFromCtx(ctx); c != nil {
+			estimated := agent.tokenizer.CountMessagesTokens(state.messages)
+			if state.forceFinal == "" {
+				estimated += toolTokens
+			}
+			c.expect(estimated)
+		}
+
+		agent.saveCheckpoint(ctx, state)
 		return state.messages, nil
 	}
 
@@ -220,95 +366,95 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 		return input, nil
 	}), compose.WithNodeName(nodeNameUpdateState))
 
-	if len(toolInfos) > 0 {
-		toolNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
-			Tools:               toolInfos,
-			UnknownToolsHandler: buildUnknownToolHandler(toolInfos),
-		})
-		if err != nil {
-			return nil, err
-		}
+	if toolNode != nil {
 		_ = g.AddToolsNode("tools", toolNode)
-		_ = g.AddEdge("tools", "chat_model")
 	}
 
 	// output_check_retry bridges update_state (*schema.Message) back to chat_model ([]*schema.Message)
 	// after an OutputCheck rejection. The hint is already in state.messages via ProcessState;
 	// returning an empty slice causes modelPreHandle to pass the full history unchanged.
-	if agent.config.OutputCheck != nil {
-		_ = g.AddLambdaNode("output_check_retry", compose.InvokableLambda(func(ctx context.Context, _ *schema.Message) ([]*schema.Message, error) {
-			return []*schema.Message{}, nil
-		}), compose.WithNodeName(nodeNameOutputCheckRetry))
-		_ = g.AddEdge("output_check_retry", "chat_model")
-	}
+	// It is always added since ExecuteTyped may bring an output check for a single execution.
+	_ = g.AddLambdaNode("output_check_retry", compose.InvokableLambda(func(ctx context.Context, _ *schema.Message) ([]*schema.Message, error) {
+		return []*schema.Message{}, nil
+	}), compose.WithNodeName(nodeNameOutputCheckRetry))
+	_ = g.AddEdge("output_check_retry", "chat_model")
 
 	// Final output node
 	_ = g.AddLambdaNode("final_output", compose.InvokableLambda(func(ctx context.Context, input any) (taskOutput, error) {
-		var lastMessage *schema.Message
+		var out TaskOutput
 		err := compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
-			if len(state.messages) > 0 {
-				lastMessage = state.messages[len(state.messages)-1]
-			}
+			out = buildTaskOutput(ctx, state)
 			return nil
 		})
 		if err != nil {
 			return taskOutput{}, err
 		}
-
-		response := ""
-		if lastMessage != nil && lastMessage.Role == schema.Assistant {
-			response = lastMessage.Content
-		}
-
-		// Collect artifacts from AgentContext
-		var artifacts []Artifact
-		var metadata map[string]any
-		if agentCtxVal := ctx.Value(agentCtxKey); agentCtxVal != nil {
-			if agentCtx, ok := agentCtxVal.(AgentContext); ok {
-				if agentCtx.Artifacts != nil {
-					artifacts = agentCtx.Artifacts.ListArtifacts()
-				}
-				if agentCtx.Metadata != nil {
-					metadata = agentCtx.Metadata.All()
-				}
+		if s := suspensionFromCtx(ctx); s != nil && s.suspended() {
+			out.StopReason = s.stopReason()
+			out.PendingApprovals = s.pendingApprovals()
+			if q := s.pendingQuestion(); q != nil {
+				out.Question = q.Question
 			}
 		}
-
-		return TaskOutput{
-			Response:  response,
-			Artifacts: artifacts,
-			Metadata:  metadata,
-		}, nil
+		return out, nil
 	}), compose.WithNodeName(nodeNameFinalOutput))
 
-	// Branch: continue loop, run output check, or finish.
-	// A branch is needed when tools are registered (loop back via "tools") or when
-	// OutputCheck is set (loop back via "chat_model"). Otherwise a plain edge suffices.
-	if len(toolInfos) > 0 || agent.config.OutputCheck != nil {
-		targets := map[string]bool{"final_output": true}
+	// Branch: loop back from "tools" to chat_model, unless a tool call suspended the run (pending
+	// approval or ask_user). On suspension the tool results are not seen by modelPreHandle, so they
+	// are appended to state here and checkpointed before stopping. Added after final_output since
+	// the end nodes of a branch must be added to the graph first.
+	if len(toolInfos) > 0 {
+		_ = g.AddBranch("tools", compose.NewGraphBranch(func(ctx context.Context, input []*schema.Message) (string, error) {
+			if s := suspensionFromCtx(ctx); s == nil || !s.suspended() {
+				return "chat_model", nil
+			}
+			err := compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
+				state.messages = append(state.messages, input...)
+				agent.saveCheckpoint(ctx, state)
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+			return "final_output", nil
+		}, map[string]bool{"chat_model": true, "final_output": true}))
+	}
+
+	// Branch: continue loop via "tools", run the output check and loop back via
+	// "output_check_retry", or finish.
+	{
+		targets := map[string]bool{"final_output": true, "output_check_retry": true}
 		if len(toolInfos) > 0 {
 			targets["tools"] = true
 		}
-		if agent.config.OutputCheck != nil {
-			targets["output_check_retry"] = true
-		}
 		_ = g.AddBranch("update_state", compose.NewGraphBranch(func(ctx context.Context, input *schema.Message) (string, error) {
 			shouldContinue := false
+			forced := false
 			var lastMsg *schema.Message
+			var outputCheck OutputCheckFunc
 			err := compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
 				if len(state.messages) > 0 {
 					lastMsg = state.messages[len(state.messages)-1]
 					shouldContinue = shouldContinueLoop(lastMsg)
 				}
+				forced = state.forceFinal != ""
+				outputCheck = outputCheckOf(agent, state.taskInput.typed)
 				return nil
 			})
 			if err != nil {
 				return "", err
 			}
+			// A forced final answer is accepted as is: no more tool calls or output check retries.
+			if forced {
+				return "final_output", nil
+			}
 			if shouldContinue {
+				if l := toolCallLimiterFromCtx(ctx); l != nil {
+					l.startTurn(lastMsg.ToolCalls)
+				}
 				return "tools", nil
 			}
-			if agent.config.OutputCheck != nil && lastMsg != nil {
+			if outputCheck != nil && lastMsg != nil {
 				var attempt int
 				_ = compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
 					state.outputCheckAttempts++
@@ -316,7 +462,15 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 					return nil
 				})
 				agentCtx, _ := ctx.Value(agentCtxKey).(AgentContext)
-				hint, ok, err := agent.config.OutputCheck(ctx, agentCtx, attempt, lastMsg.Content)
+				hint, ok, err := outputCheck(ctx, agentCtx, attempt, lastMsg.Content)
+				if errors.Is(err, ErrOutputCheckExhausted) {
+					flow.NewRail(ctx).Infof("[%v] OutputCheck gave up after %d attempts, accepting the last response", agent.config.Name, attempt)
+					_ = compose.ProcessState(ctx, func(ctx context.Context, state *agentLoopState) error {
+						state.forceFinal = StopReasonOutputCheckExhausted
+						return nil
+					})
+					return "final_output", nil
+				}
 				if err != nil {
 					return "", err
 				}
@@ -332,8 +486,6 @@ func buildGraph(agent *Agent) (compose.Runnable[taskInput, taskOutput], error) {
 			}
 			return "final_output", nil
 		}, targets))
-	} else {
-		_ = g.AddEdge("update_state", "final_output")
 	}
 
 	// Add edges - ReAct loop pattern
@@ -2,6 +2,7 @@ package agentloop
 
 import (
 	"context"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 )
@@ -59,6 +60,7 @@ type ToolCallRequest struct {
 	Name     string                 // Tool name
 	Args     map[string]interface{} // Parsed arguments
 	RawInput string                 // Original JSON string from the LLM
+	Deadline time.Time              // When the call times out (AgentConfig.ToolTimeout/ToolTimeouts); zero if no deadline
 }
 
 // ToolCallResponse is the output of WrapToolCall.
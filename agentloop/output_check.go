@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/curtisnewbie/miso/errs"
 	"github.com/curtisnewbie/miso/util/llm"
 )
 
+// ErrOutputCheckExhausted is returned by an OutputCheckFunc that gives up on a response it would
+// otherwise reject. The response is accepted as the final output and the run stops with
+// StopReason [StopReasonOutputCheckExhausted], so callers can tell it apart from a valid one.
+var ErrOutputCheckExhausted = errs.NewErrf("output check attempts exhausted")
+
 // JsonOutputCheck returns an OutputCheckFunc that rejects assistant responses that cannot be
 // parsed as valid JSON of type T (after stripping any <think>...</think> block).
 //
-// maxAttempts caps how many times the check will reject a response. Once attempt exceeds
-// maxAttempts the check passes unconditionally, accepting whatever the model produced.
+// maxAttempts caps how many times the check will reject a response. Once attempt reaches
+// maxAttempts an invalid response is accepted as is, with [ErrOutputCheckExhausted].
 //
 // Example:
 //
@@ -23,7 +29,7 @@ func JsonOutputCheck[T any](maxAttempts int) OutputCheckFunc {
 		_, content := llm.ParseThink(output)
 		if _, err := llm.ParseLLMJsonAs[T](content); err != nil {
 			if attempt >= maxAttempts {
-				return "", true, nil
+				return "", false, ErrOutputCheckExhausted
 			}
 			return fmt.Sprintf(
 				"[Attempt %d] Your response could not be parsed as valid JSON: %v. "+
@@ -41,8 +47,8 @@ var FinalResponseExtractor = llm.MustTagExtractor("final_response")
 // FinalResponseTagOutputCheck returns an OutputCheckFunc that rejects assistant responses
 // not wrapped in <final_response>...</final_response> tags.
 //
-// maxAttempts caps how many times the check will reject a response. Once attempt exceeds
-// maxAttempts the check passes unconditionally, accepting whatever the model produced.
+// maxAttempts caps how many times the check will reject a response. Once attempt reaches
+// maxAttempts a response without the tags is accepted as is, with [ErrOutputCheckExhausted].
 //
 // Example:
 //
@@ -55,7 +61,7 @@ func FinalResponseTagOutputCheck(maxAttempts int) OutputCheckFunc {
 			return "", true, nil
 		}
 		if attempt >= maxAttempts {
-			return "", true, nil
+			return "", false, ErrOutputCheckExhausted
 		}
 		return fmt.Sprintf(
 			"[Attempt %d] Your response is missing the required <final_response> wrapper. "+
@@ -0,0 +1,101 @@
+package agentloop
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// runProgress gives Execute access to the loop state of the current execution after the graph
+// returned an error, so the partial results can still be reported. The state is only read once
+// the graph has returned.
+type runProgress struct {
+	state *agentLoopState
+}
+
+// runProgressFromCtx returns the runProgress of the current execution, or nil.
+func runProgressFromCtx(ctx context.Context) *runProgress {
+	if v, ok := ctx.Value(runProgressCtxKey).(*runProgress); ok {
+		return v
+	}
+	return nil
+}
+
+// trackProgress registers state with the runProgress of the current execution, if any.
+func trackProgress(ctx context.Context, state *agentLoopState) {
+	if p := runProgressFromCtx(ctx); p != nil {
+		p.state = state
+	}
+}
+
+// buildTaskOutput collects the results of the execution: the last assistant message as the
+// response, the conversation, and the todos, artifacts and metadata of the AgentContext.
+// state may be nil when the run failed before the loop started.
+func buildTaskOutput(ctx context.Context, state *agentLoopState) TaskOutput {
+	out := TaskOutput{StopReason: StopReasonCompleted}
+	if state != nil {
+		if n := len(state.messages); n > 0 && state.messages[n-1].Role == schema.Assistant {
+			out.Response = state.messages[n-1].Content
+		}
+		var tokenRatio float64
+		if c := tokenCalibrationFromCtx(ctx); c != nil {
+			tokenRatio = c.getRatio()
+		}
+		out.Conversation = conversationFromState(state.messages, state.compactionSummary, tokenRatio)
+		if state.forceFinal != "" {
+			out.StopReason = state.forceFinal
+			out.BudgetExceeded = state.budgetExceeded
+		}
+	}
+	if agentCtx, ok := ctx.Value(agentCtxKey).(AgentContext); ok {
+		if agentCtx.Todos != nil {
+			out.Todos = agentCtx.Todos.ListTodos()
+		}
+		if agentCtx.Artifacts != nil {
+			out.Artifacts = agentCtx.Artifacts.ListArtifacts()
+		}
+		if agentCtx.Metadata != nil {
+			out.Metadata = agentCtx.Metadata.All()
+		}
+	}
+	return out
+}
+
+// buildPartialOutput returns what the execution collected before it failed with err.
+// The response is the last non-empty assistant reply, which may be an intermediate one.
+func buildPartialOutput(ctx context.Context, err error) TaskOutput {
+	var state *agentLoopState
+	if p := runProgressFromCtx(ctx); p != nil {
+		state = p.state
+	}
+	out := buildTaskOutput(ctx, state)
+	out.StopReason = stopReasonOfErr(ctx, err)
+	out.BudgetExceeded = ""
+	if state != nil {
+		out.Response = lastAssistantContent(state.messages)
+	}
+	return out
+}
+
+// stopReasonOfErr maps an error returned by the graph to a StopReason.
+func stopReasonOfErr(ctx context.Context, err error) StopReason {
+	switch {
+	case ctx.Err() != nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return StopReasonCancelled
+	case errors.Is(err, compose.ErrExceedMaxSteps):
+		return StopReasonMaxSteps
+	}
+	return StopReasonError
+}
+
+// lastAssistantContent returns the content of the last assistant message with non-empty content.
+func lastAssistantContent(msgs []*schema.Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == schema.Assistant && msgs[i].Content != "" {
+			return msgs[i].Content
+		}
+	}
+	return ""
+}
@@ -56,6 +56,9 @@ type PromptBuilder struct {
 	language            string
 	currentTime         string
 	fileOpsEnabled      bool
+	askUserEnabled      bool
+	skillToolEnabled    bool
+	outputSchema        string
 }
 
 // NewPromptBuilder creates a new prompt builder.
@@ -104,6 +107,27 @@ func (pb *PromptBuilder) WithFileOps(enabled bool) *PromptBuilder {
 	return pb
 }
 
+// WithAskUser enables or disables the ask_user guidance section.
+// Enable this when the ask_user tool is available to the agent.
+func (pb *PromptBuilder) WithAskUser(enabled bool) *PromptBuilder {
+	pb.askUserEnabled = enabled
+	return pb
+}
+
+// WithSkillTool mentions the load_skill and activate_skill tools in the skills section.
+// Enable this when the skill tools are available to the agent.
+func (pb *PromptBuilder) WithSkillTool(enabled bool) *PromptBuilder {
+	pb.skillToolEnabled = enabled
+	return pb
+}
+
+// WithOutputSchema asks the model to respond with JSON matching the given JSON schema.
+// Empty means no output format section.
+func (pb *PromptBuilder) WithOutputSchema(schema string) *PromptBuilder {
+	pb.outputSchema = schema
+	return pb
+}
+
 // Build builds the system prompt.
 func (pb *PromptBuilder) Build(ctx context.Context) (*schema.Message, error) {
 	sb := strutil.NewBuilder()
@@ -120,6 +144,14 @@ func (pb *PromptBuilder) Build(ctx context.Context) (*schema.Message, error) {
 		sb.WriteString("</file_operations>")
 	}
 
+	// Add ask_user guidance if the tool is enabled
+	if pb.askUserEnabled {
+		sb.WriteString("\n\n<asking_questions>\n")
+		sb.WriteString("- When the request is ambiguous, call the `ask_user` tool instead of ending your turn with a question\n")
+		sb.WriteString("- Don't ask about things you can find out with other tools\n")
+		sb.WriteString("</asking_questions>")
+	}
+
 	// Add language instruction
 	if pb.language != "" {
 		sb.WriteString("\n\n")
@@ -138,7 +170,14 @@ func (pb *PromptBuilder) Build(ctx context.Context) (*schema.Message, error) {
 		if skillsMetadata != "" {
 			sb.WriteString("\n\n<skills_system>\n")
 			sb.WriteString("Skills provide specialized instructions and workflows for specific tasks.\n")
-			sb.WriteString("Use the `read_file` tool to load a skill's full instructions when a task matches its description.\n\n")
+			if pb.skillToolEnabled {
+				sb.WriteString("Use the `load_skill` tool to load a skill's full instructions and list its bundled files when a task matches its description.\n")
+				sb.WriteString("Loading a skill activates it. Call `activate_skill` with an empty name once you are done with it.\n")
+			} else {
+				sb.WriteString("Use the `read_file` tool to load a skill's full instructions when a task matches its description.\n")
+				sb.WriteString("Reading a skill's SKILL.md activates the skill until another skill is read.\n")
+			}
+			sb.WriteString("While a skill with allowed tools is active, only those tools can be called.\n\n")
 			sb.WriteString(skillsMetadata)
 			sb.WriteString("\n</skills_system>")
 		}
@@ -152,6 +191,14 @@ func (pb *PromptBuilder) Build(ctx context.Context) (*schema.Message, error) {
 		}
 	}
 
+	// Add output format if a JSON schema is expected
+	if pb.outputSchema != "" {
+		sb.WriteString("\n\n<output_format>\n")
+		sb.WriteString("Your final response must be a single JSON object matching this JSON schema, with no markdown fences or extra commentary:\n")
+		sb.WriteString(pb.outputSchema)
+		sb.WriteString("\n</output_format>")
+	}
+
 	// Add task prompt if provided
 	if pb.taskPrompt != "" {
 		sb.WriteString("\n\n")
@@ -0,0 +1,128 @@
+package agentloop
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+// prunedHistoryNotice is the user message inserted after the task message once older messages
+// have been pruned, so the model knows part of the conversation is missing.
+const prunedHistoryNotice = "<pruned-history>Earlier messages of this conversation were removed to fit the context window. " +
+	"Redo any step whose result you still need.</pruned-history>"
+
+// isPrunedHistoryNotice reports whether msg is the notice inserted by pruneMessages.
+func isPrunedHistoryNotice(msg *schema.Message) bool {
+	return msg.Role == schema.User && msg.Content == prunedHistoryNotice
+}
+
+// groupMessageRounds groups msgs so that an assistant message with tool calls and the tool results
+// following it stay together. Any other message forms a group of its own.
+func groupMessageRounds(msgs []*schema.Message) [][]*schema.Message {
+	var groups [][]*schema.Message
+	for i := 0; i < len(msgs); {
+		j := i + 1
+		if msgs[i].Role == schema.Assistant && len(msgs[i].ToolCalls) > 0 {
+			for j < len(msgs) && msgs[j].Role == schema.Tool {
+				j++
+			}
+		}
+		groups = append(groups, msgs[i:j])
+		i = j
+	}
+	return groups
+}
+
+// pruneMessages fits messages, [system, previous turns..., task, current turn...], in maxTokens
+// without calling a model. task is the user message of the current turn at taskIndex.
+//
+// The oldest rounds are dropped first, an assistant message together with its tool results, so
+// tool calls and tool results stay paired: the previous turns, then the current turn. The kept
+// previous turns always start with a user message. The system and task messages and the latest
+// round are always kept. If the history is still too long, the kept tool results are truncated to
+// a preview, oldest first. A notice is inserted after the task message once anything has been dropped.
+//
+// Returns the pruned messages, the new index of the task message and the number of messages dropped.
+func pruneMessages(messages []*schema.Message, taskIndex int, tokenizer Tokenizer, maxTokens int) ([]*schema.Message, int, int) {
+	previous, task, current, ok := splitTurn(messages, taskIndex)
+	if !ok || len(previous)+len(current) == 0 {
+		return messages, taskIndex, 0
+	}
+
+	notice := schema.UserMessage(prunedHistoryNotice)
+	noticed := slices.ContainsFunc(messages, isPrunedHistoryNotice)
+	prevGroups := groupMessageRounds(previous)
+	curGroups := groupMessageRounds(current)
+
+	// The reply priming of CountMessagesTokens is counted once, so total matches CountMessagesTokens(out).
+	total := tokenizer.CountMessagesTokens([]*schema.Message{messages[0], task}) + sumMessageTokens(tokenizer, previous) + sumMessageTokens(tokenizer, current)
+	if noticed {
+		total += tokenizer.CountMessageTokens(notice)
+	}
+
+	dropped := 0
+	drop := func(groups [][]*schema.Message) [][]*schema.Message {
+		if !noticed {
+			noticed = true
+			total += tokenizer.CountMessageTokens(notice)
+		}
+		total -= sumMessageTokens(tokenizer, groups[0])
+		dropped += len(groups[0])
+		return groups[1:]
+	}
+	for total > maxTokens && (len(prevGroups) > 0 || len(curGroups) > 1) {
+		if len(prevGroups) > 0 {
+			prevGroups = drop(prevGroups)
+		} else {
+			curGroups = drop(curGroups)
+		}
+	}
+	for len(prevGroups) > 0 && prevGroups[0][0].Role != schema.User {
+		prevGroups = drop(prevGroups)
+	}
+
+	out := make([]*schema.Message, 0, len(messages)-dropped+1)
+	out = append(out, messages[0])
+	for _, g := range prevGroups {
+		out = append(out, g...)
+	}
+	taskIndex = len(out)
+	out = append(out, task)
+	if noticed {
+		out = append(out, notice)
+	}
+	for _, g := range curGroups {
+		out = append(out, g...)
+	}
+
+	for i := 1; i < len(out) && total > maxTokens; i++ {
+		msg := out[i]
+		if msg.Role != schema.Tool {
+			continue
+		}
+		preview := buildPreview(msg.Content)
+		if len(preview) >= len(msg.Content) {
+			continue
+		}
+		cp := *msg
+		cp.Content = preview
+		total += tokenizer.CountMessageTokens(&cp) - tokenizer.CountMessageTokens(msg)
+		out[i] = &cp
+	}
+	return out, taskIndex, dropped
+}
+
+// prune fits the history in AgentConfig.MaxTokens with pruneMessages. Used when compaction is disabled.
+func (a *Agent) prune(ctx context.Context, state *agentLoopState, tokenizer Tokenizer) {
+	before := tokenizer.CountMessagesTokens(state.messages)
+	messages, taskIndex, dropped := pruneMessages(state.messages, state.taskIndex, tokenizer, a.config.MaxTokens)
+	after := tokenizer.CountMessagesTokens(messages)
+	state.messages, state.taskIndex = messages, taskIndex
+	rail := flow.NewRail(ctx)
+	rail.Infof("[%v] Pruned history: dropped %d messages, ~%d -> ~%d tokens", a.config.Name, dropped, before, after)
+	if after > a.config.MaxTokens {
+		rail.Warnf("[%v] History still exceeds MaxTokens (%d) after pruning: ~%d tokens", a.config.Name, a.config.MaxTokens, after)
+	}
+}
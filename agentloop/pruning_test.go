@@ -0,0 +1,97 @@
+package agentloop
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestPruneMessages(t *testing.T) {
+	tok := NewTokenizer()
+	msgs := []*schema.Message{schema.SystemMessage("system"), schema.UserMessage("task")}
+	for _, id := range []string{"a", "b", "c"} {
+		msgs = append(msgs,
+			toolCallMsg(id, "search", `{}`),
+			schema.ToolMessage(strings.Repeat("result ", 200), id),
+		)
+	}
+	msgs = append(msgs, schema.AssistantMessage("done", nil))
+
+	if got, _, dropped := pruneMessages(msgs, 1, tok, tok.CountMessagesTokens(msgs)); dropped != 0 || len(got) != len(msgs) {
+		t.Fatalf("within budget: dropped %d, %d messages, want nothing pruned", dropped, len(got))
+	}
+
+	// Room for the last two rounds only: the first call and its result are dropped together.
+	budget := tok.CountMessagesTokens(msgs) - sumMessageTokens(tok, msgs[2:4]) + tok.CountMessageTokens(schema.UserMessage(prunedHistoryNotice))
+	got, taskIndex, dropped := pruneMessages(msgs, 1, tok, budget)
+	if dropped != 2 || len(got) != len(msgs)-1 {
+		t.Fatalf("dropped %d, %d messages, want 2 dropped and %d messages", dropped, len(got), len(msgs)-1)
+	}
+	if n := tok.CountMessagesTokens(got); n != budget {
+		t.Errorf("pruned history has %d tokens, want exactly the budget %d", n, budget)
+	}
+	if taskIndex != 1 || !isPrunedHistoryNotice(got[2]) || got[3].ToolCalls[0].ID != "b" || got[4].ToolCallID != "b" {
+		t.Errorf("got %v, want [system, task, notice, call b, result b, ...]", got)
+	}
+
+	// Pruning again keeps a single notice.
+	again, _, _ := pruneMessages(got, taskIndex, tok, budget)
+	notices := 0
+	for _, msg := range again {
+		if isPrunedHistoryNotice(msg) {
+			notices++
+		}
+	}
+	if notices != 1 {
+		t.Errorf("%d notices, want 1", notices)
+	}
+
+	// The latest round is always kept; its large tool result is truncated.
+	last := []*schema.Message{
+		msgs[0], msgs[1],
+		toolCallMsg("d", "search", `{}`),
+		schema.ToolMessage(strings.Repeat("x", offloadPreviewHeadChars+offloadPreviewTailChars+5000), "d"),
+	}
+	got, _, dropped = pruneMessages(last, 1, tok, 100)
+	if dropped != 0 || len(got) != 4 {
+		t.Fatalf("dropped %d, %d messages, want the latest round kept", dropped, len(got))
+	}
+	if !strings.Contains(got[3].Content, "characters omitted") || last[3].Content == got[3].Content {
+		t.Errorf("tool result was not truncated: %d chars", len(got[3].Content))
+	}
+}
+
+func TestPruneMessages_MultiTurn(t *testing.T) {
+	tok := NewTokenizer()
+	big := strings.Repeat("result ", 200)
+	msgs := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("turn 1"),
+		toolCallMsg("a", "search", `{}`),
+		schema.ToolMessage(big, "a"),
+		schema.AssistantMessage("answer 1", nil),
+		schema.UserMessage("turn 2"),
+		toolCallMsg("b", "search", `{}`),
+		schema.ToolMessage(big, "b"),
+		schema.AssistantMessage("answer 2", nil),
+		schema.UserMessage("turn 3"),
+		toolCallMsg("c", "search", `{}`),
+		schema.ToolMessage(big, "c"),
+	}
+	const taskIndex = 9
+
+	// Room for turn 2 but not turn 1: the kept previous turns start with the user message of turn 2.
+	notice := tok.CountMessageTokens(schema.UserMessage(prunedHistoryNotice))
+	budget := tok.CountMessagesTokens(msgs) - sumMessageTokens(tok, msgs[1:4]) + notice
+	got, gotTaskIndex, dropped := pruneMessages(msgs, taskIndex, tok, budget)
+	if dropped != 4 || got[1].Content != "turn 2" || got[gotTaskIndex].Content != "turn 3" || !isPrunedHistoryNotice(got[gotTaskIndex+1]) {
+		t.Fatalf("dropped %d, got %v (task index %d), want [system, turn 2..., turn 3, notice, ...]", dropped, got, gotTaskIndex)
+	}
+
+	// The previous turns are dropped before the current turn; the task stays next to the system message.
+	got, gotTaskIndex, _ = pruneMessages(msgs, taskIndex, tok, tok.CountMessagesTokens(msgs[taskIndex:])+notice)
+	if gotTaskIndex != 1 || got[1].Content != "turn 3" || len(got) != 5 {
+		t.Errorf("got %v (task index %d), want [system, turn 3, notice, call c, result c]", got, gotTaskIndex)
+	}
+}
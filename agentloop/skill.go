@@ -131,6 +131,9 @@ func (s *Skill) FormatMetadataOnly() string {
 	if s.Metadata.Compatible != "" {
 		sb.Printlnf("    <compatibility>%s</compatibility>", s.Metadata.Compatible)
 	}
+	if len(s.Metadata.AllowedTools) > 0 {
+		sb.Printlnf("    <allowed_tools>%s</allowed_tools>", strings.Join(s.Metadata.AllowedTools, ", "))
+	}
 	sb.Println("  </skill>")
 	return sb.String()
 }
@@ -0,0 +1,269 @@
+package agentloop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/util/strutil"
+)
+
+// MetadataKeyUsedSkills is the TaskOutput.Metadata key listing the names of the skills activated
+// during the execution, in activation order. The value is a []string.
+const MetadataKeyUsedSkills = "used_skills"
+
+// skillControlTools can always be called while a skill is active, so the model can switch skills.
+var skillControlTools = map[string]bool{
+	"activate_skill": true,
+	"load_skill":     true,
+}
+
+// skillActivation tracks the active skill of an execution.
+//
+// A skill is activated when the model reads its SKILL.md or calls activate_skill or load_skill.
+// While a skill with SkillMetadata.AllowedTools is active, only those tools (plus the skill control
+// tools and read_file under /skills/) are executed. Activated skills are recorded in the metadata
+// under MetadataKeyUsedSkills.
+type skillActivation struct {
+	mu          sync.Mutex
+	skills      SkillsMap
+	metadata    *MetadataStore
+	toolEnabled bool // whether activate_skill and load_skill are registered
+	active      string
+}
+
+func newSkillActivation(skills SkillsMap, metadata *MetadataStore, toolEnabled bool) *skillActivation {
+	return &skillActivation{skills: skills, metadata: metadata, toolEnabled: toolEnabled}
+}
+
+// skillActivationFromCtx returns the skill activation of the execution, or nil.
+func skillActivationFromCtx(ctx context.Context) *skillActivation {
+	s, _ := ctx.Value(skillActivationCtxKey).(*skillActivation)
+	return s
+}
+
+// activate makes the named skill the active one. An empty name deactivates the active skill.
+func (s *skillActivation) activate(name string) (*Skill, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		s.active = ""
+		return nil, nil
+	}
+	skill, ok := s.skills.Get(name)
+	if !ok {
+		return nil, errs.NewErrf("skill %q not found", name)
+	}
+	s.active = name
+	s.recordUsed(name)
+	return skill, nil
+}
+
+// recordUsed adds name to the used skills in the metadata, unless it is already there.
+func (s *skillActivation) recordUsed(name string) {
+	if s.metadata == nil {
+		return
+	}
+	s.metadata.RunWithLock(func(m MetadataView) {
+		v, _ := m.Get(MetadataKeyUsedSkills)
+		var used []string
+		switch v := v.(type) {
+		case []string:
+			used = v
+		case []any: // restored from a checkpoint
+			for _, e := range v {
+				if str, ok := e.(string); ok {
+					used = append(used, str)
+				}
+			}
+		}
+		if slices.Contains(used, name) {
+			return
+		}
+		m.Set(MetadataKeyUsedSkills, append(slices.Clone(used), name))
+	})
+}
+
+// activeName returns the name of the active skill, or "" if none is active.
+func (s *skillActivation) activeName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// skillOfFile returns the skill whose SKILL.md is at p, if any.
+func (s *skillActivation) skillOfFile(p string) (*Skill, bool) {
+	p = cleanPolicyPath(p)
+	for _, skill := range s.skills {
+		if cleanPolicyPath(skill.Path) == p {
+			return skill, true
+		}
+	}
+	return nil, false
+}
+
+// check reports whether the tool call is allowed by the active skill. If not, the returned
+// message explains why.
+func (s *skillActivation) check(tool, args string) (msg string, ok bool) {
+	s.mu.Lock()
+	skill, active := s.skills.Get(s.active)
+	s.mu.Unlock()
+	if !active || len(skill.Metadata.AllowedTools) == 0 || skillControlTools[tool] {
+		return "", true
+	}
+	for _, allowed := range skill.Metadata.AllowedTools {
+		if matched, _ := path.Match(allowed, tool); matched {
+			return "", true
+		}
+	}
+	if tool == "read_file" {
+		if p := toolPathArg(args); p != "" && strings.HasPrefix(cleanPolicyPath(p), "/skills/") {
+			return "", true
+		}
+	}
+	msg = fmt.Sprintf("Error: tool %q is not allowed while skill %q is active, allowed tools: %s.",
+		tool, skill.Metadata.Name, strings.Join(skill.Metadata.AllowedTools, ", "))
+	if s.toolEnabled {
+		msg += " Call activate_skill with an empty name to deactivate the skill first."
+	}
+	return msg, false
+}
+
+// toolPathArg returns the "path" argument of a raw JSON tool input, or "".
+func toolPathArg(args string) string {
+	var v struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(args), &v); err != nil {
+		return ""
+	}
+	return v.Path
+}
+
+// buildSkillToolMiddleware returns the tools node middleware that enforces the allowed_tools of
+// the active skill, and activates a skill when the model reads its SKILL.md.
+func buildSkillToolMiddleware() compose.InvokableToolMiddleware {
+	return func(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+		return func(ctx context.Context, input *compose.ToolInput) (*compose.ToolOutput, error) {
+			s := skillActivationFromCtx(ctx)
+			if s == nil || len(s.skills) == 0 {
+				return next(ctx, input)
+			}
+			if msg, ok := s.check(input.Name, input.Arguments); !ok {
+				return &compose.ToolOutput{Result: msg}, nil
+			}
+			out, err := next(ctx, input)
+			if err != nil || input.Name != "read_file" || out == nil || strings.HasPrefix(out.Result, "Error:") {
+				return out, err
+			}
+			if skill, ok := s.skillOfFile(toolPathArg(input.Arguments)); ok && s.activeName() != skill.Metadata.Name {
+				if _, err := s.activate(skill.Metadata.Name); err != nil {
+					flow.NewRail(ctx).Warnf("Failed to activate skill %q read from %v, %v", skill.Metadata.Name, skill.Path, err)
+				} else {
+					flow.NewRail(ctx).Debugf("Skill %q activated by reading %v", skill.Metadata.Name, skill.Path)
+				}
+			}
+			return out, nil
+		}
+	}
+}
+
+type ActivateSkillArgs struct {
+	Name string `json:"name"`
+}
+
+// newActivateSkillTool creates the activate_skill tool. See AgentConfig.EnableSkillTool.
+func newActivateSkillTool() Tool {
+	return NewTypedCtxAwareToolFunc(
+		"activate_skill",
+		"Activate a skill before following its instructions, or pass an empty name to deactivate the active skill. "+
+			"While a skill that lists allowed tools is active, only those tools can be called.",
+		map[string]*schema.ParameterInfo{
+			"name": StringParam("The name of the skill to activate; empty to deactivate", true),
+		},
+		func(ctx context.Context, agentCtx AgentContext, args ActivateSkillArgs) (string, error) {
+			s := skillActivationFromCtx(ctx)
+			if s == nil {
+				return "", errs.NewErrf("no skills are available")
+			}
+			name := strings.TrimSpace(args.Name)
+			prev := s.activeName()
+			skill, err := s.activate(name)
+			if err != nil {
+				return "", err
+			}
+			if skill == nil {
+				if prev == "" {
+					return "No skill was active.", nil
+				}
+				return fmt.Sprintf("Skill %q deactivated, all tools are available.", prev), nil
+			}
+			msg := fmt.Sprintf("Skill %q activated. Read its instructions at %s if you have not yet.", name, skill.Path)
+			if len(skill.Metadata.AllowedTools) > 0 {
+				msg += fmt.Sprintf(" Allowed tools: %s.", strings.Join(skill.Metadata.AllowedTools, ", "))
+			}
+			return msg, nil
+		},
+	)
+}
+
+type LoadSkillArgs struct {
+	Name string `json:"name"`
+}
+
+// newLoadSkillTool creates the load_skill tool, which returns the full instructions of a skill
+// and lists its bundled resource files. See AgentConfig.EnableSkillTool.
+func newLoadSkillTool() Tool {
+	return NewTypedCtxAwareToolFunc(
+		"load_skill",
+		"Load the full instructions of a skill and list the resource files bundled with it (scripts, templates, reference docs). "+
+			"The skill is activated. Read the resource files with read_file when the instructions refer to them.",
+		map[string]*schema.ParameterInfo{
+			"name": StringParam("The name of the skill to load", true),
+		},
+		func(ctx context.Context, agentCtx AgentContext, args LoadSkillArgs) (string, error) {
+			s := skillActivationFromCtx(ctx)
+			if s == nil {
+				return "", errs.NewErrf("no skills are available")
+			}
+			name := strings.TrimSpace(args.Name)
+			if name == "" {
+				return "", errs.NewErrf("name cannot be empty")
+			}
+			skill, err := s.activate(name)
+			if err != nil {
+				return "", err
+			}
+			resources, err := NewSkillLoader(agentCtx.Store).ListResources(ctx, skill)
+			if err != nil {
+				return "", err
+			}
+
+			sb := strutil.NewBuilder()
+			sb.Printlnf("<skill name=%q location=%q>", skill.Metadata.Name, skill.Path)
+			if len(skill.Metadata.AllowedTools) > 0 {
+				sb.Printlnf("<allowed_tools>%s</allowed_tools>", strings.Join(skill.Metadata.AllowedTools, ", "))
+			}
+			sb.Println("<instructions>")
+			sb.Println(skill.Content)
+			sb.Println("</instructions>")
+			if len(resources) > 0 {
+				sb.Println("<resources>")
+				for _, r := range resources {
+					sb.Println(r)
+				}
+				sb.Println("</resources>")
+			}
+			sb.WriteString("</skill>")
+			return sb.String(), nil
+		},
+	)
+}
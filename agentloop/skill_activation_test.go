@@ -0,0 +1,134 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+func TestSkillToolMiddleware(t *testing.T) {
+	skills := SkillsMap{}
+	skills.Add(&Skill{
+		Metadata: SkillMetadata{Name: "csv-report", Description: "Build CSV reports", AllowedTools: []string{"read_file", "transform_*"}},
+		Path:     "/skills/csv-report/SKILL.md",
+	})
+	skills.Add(&Skill{
+		Metadata: SkillMetadata{Name: "research", Description: "Research a topic", AllowedTools: []string{"web_search"}},
+		Path:     "/skills/research/SKILL.md",
+	})
+	skills.Add(&Skill{
+		Metadata: SkillMetadata{Name: "writing", Description: "Write prose"},
+		Path:     "/skills/writing/SKILL.md",
+	})
+	activation := newSkillActivation(skills, NewMetadataStore(), true)
+	ctx := context.WithValue(context.Background(), skillActivationCtxKey, activation)
+
+	var ran []string
+	endpoint := buildSkillToolMiddleware()(func(_ context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		ran = append(ran, in.Name)
+		return &compose.ToolOutput{Result: "ok"}, nil
+	})
+	call := func(name, args string) string {
+		out, err := endpoint(ctx, &compose.ToolInput{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		return out.Result
+	}
+
+	// No active skill: everything runs.
+	call("write_file", `{"path":"/output/a.txt"}`)
+
+	// Reading a SKILL.md activates the skill.
+	call("read_file", `{"path":"/skills/csv-report/SKILL.md"}`)
+	if got := activation.activeName(); got != "csv-report" {
+		t.Fatalf("active skill = %q, want csv-report", got)
+	}
+	call("transform_csv_lua", `{"input_path":"/input/a.csv"}`)
+	if got := call("write_file", `{"path":"/output/a.txt"}`); !strings.Contains(got, "not allowed") {
+		t.Errorf("write_file while csv-report is active: result = %q, want not allowed", got)
+	}
+
+	// Skill files can always be read, switching to another skill.
+	call("read_file", `{"path":"/skills/research/SKILL.md"}`)
+	if got := activation.activeName(); got != "research" {
+		t.Fatalf("active skill = %q, want research", got)
+	}
+	if got := call("read_file", `{"path":"/input/a.csv"}`); !strings.Contains(got, "not allowed") {
+		t.Errorf("read_file outside /skills/ while research is active: result = %q, want not allowed", got)
+	}
+	call("activate_skill", `{"name":""}`)
+
+	// A skill without allowed tools does not restrict.
+	if _, err := activation.activate("writing"); err != nil {
+		t.Fatalf("activate() error = %v", err)
+	}
+	call("write_file", `{"path":"/output/b.txt"}`)
+
+	want := "write_file,read_file,transform_csv_lua,read_file,activate_skill,write_file"
+	if got := strings.Join(ran, ","); got != want {
+		t.Errorf("ran = %v, want %v", got, want)
+	}
+}
+
+func TestBuiltinTools_LoadSkill(t *testing.T) {
+	tool, ok := BuiltinTools(WithEnableSkillTool(true)).Get("load_skill")
+	if !ok {
+		t.Fatal("load_skill tool not found")
+	}
+
+	ctx := context.Background()
+	store := NewTmpFileStore()
+	defer store.OnSessionEnd(flow.NewRail(ctx))
+	files := map[string]string{
+		"/skills/csv-report/SKILL.md":            "---\nname: csv-report\ndescription: Build CSV reports\nallowed_tools: [read_file]\n---\n# CSV Report\nRun scripts/build.lua",
+		"/skills/csv-report/scripts/build.lua":   "return input",
+		"/skills/csv-report/templates/report.md": "# Report",
+		"/skills/writing/SKILL.md":               "---\nname: writing\ndescription: Write prose\n---\n# Writing",
+	}
+	for p, c := range files {
+		if err := store.WriteFile(ctx, p, []byte(c)); err != nil {
+			t.Fatalf("WriteFile(%s) error = %v", p, err)
+		}
+	}
+	skills, err := NewSkillLoader(store).LoadFromSources(ctx, []string{"/skills"})
+	if err != nil {
+		t.Fatalf("LoadFromSources() error = %v", err)
+	}
+
+	metadata := NewMetadataStore()
+	activation := newSkillActivation(skills, metadata, true)
+	ctx = context.WithValue(ctx, agentCtxKey, AgentContext{Store: store, Metadata: metadata})
+	ctx = context.WithValue(ctx, skillActivationCtxKey, activation)
+
+	result, err := tool.(SelfInvokeTool).ExecuteJson(ctx, `{"name":"csv-report"}`)
+	if err != nil {
+		t.Fatalf("load_skill error = %v", err)
+	}
+	for _, want := range []string{"Run scripts/build.lua", "/skills/csv-report/scripts/build.lua", "/skills/csv-report/templates/report.md", "<allowed_tools>read_file</allowed_tools>"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("result missing %q:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "/skills/csv-report/SKILL.md\n") {
+		t.Errorf("SKILL.md should not be listed as a resource:\n%s", result)
+	}
+	if got := activation.activeName(); got != "csv-report" {
+		t.Errorf("active skill = %q, want csv-report", got)
+	}
+
+	if _, err := tool.(SelfInvokeTool).ExecuteJson(ctx, `{"name":"writing"}`); err != nil {
+		t.Fatalf("load_skill error = %v", err)
+	}
+	tool.(SelfInvokeTool).ExecuteJson(ctx, `{"name":"csv-report"}`)
+	if used, _ := GetMeta[[]string](metadata, MetadataKeyUsedSkills); strings.Join(used, ",") != "csv-report,writing" {
+		t.Errorf("used skills = %v, want [csv-report writing]", used)
+	}
+
+	if _, err := tool.(SelfInvokeTool).ExecuteJson(ctx, `{"name":"missing"}`); err == nil {
+		t.Error("unknown skill: error = nil, want error")
+	}
+}
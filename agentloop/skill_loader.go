@@ -2,7 +2,9 @@ package agentloop
 
 import (
 	"context"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/curtisnewbie/miso/errs"
@@ -51,7 +53,7 @@ func (l *SkillLoader) LoadFromSource(ctx context.Context, source string) (Skills
 	source = normalizePath(source)
 
 	// If the source itself is a skill directory (contains SKILL.md directly), load it.
-	if skill, err := l.LoadSkillFile(ctx, filepath.Join(source, "SKILL.md")); err == nil {
+	if skill, err := l.LoadSkillFile(ctx, path.Join(source, "SKILL.md")); err == nil {
 		return SkillsMap{skill.Metadata.Name: skill}, nil
 	}
 
@@ -66,7 +68,7 @@ func (l *SkillLoader) LoadFromSource(ctx context.Context, source string) (Skills
 	for _, file := range files {
 		if file.IsDir {
 			// Try to load SKILL.md from this subdirectory
-			skillPath := filepath.Join(source, file.Path, "SKILL.md")
+			skillPath := path.Join(source, file.Path, "SKILL.md")
 			skill, err := l.LoadSkillFile(ctx, skillPath)
 			if err != nil {
 				// Log warning but continue loading other skills
@@ -99,6 +101,46 @@ func (l *SkillLoader) LoadSkillFile(ctx context.Context, path string) (*Skill, e
 	return skill, nil
 }
 
+// maxSkillResources caps the number of files returned by [SkillLoader.ListResources].
+const maxSkillResources = 200
+
+// ListResources lists the files bundled with skill (scripts, templates, reference docs, ...),
+// i.e. every file under the directory of its SKILL.md except SKILL.md itself, sorted by path.
+// At most 200 files are returned.
+func (l *SkillLoader) ListResources(ctx context.Context, skill *Skill) ([]string, error) {
+	dir := normalizePath(path.Dir(skill.Path))
+	var result []string
+	if err := l.listFiles(ctx, dir, normalizePath(skill.Path), &result); err != nil {
+		return nil, errs.Wrapf(err, "failed to list resources of skill %s", skill.Metadata.Name)
+	}
+	sort.Strings(result)
+	if len(result) > maxSkillResources {
+		result = result[:maxSkillResources]
+	}
+	return result, nil
+}
+
+// listFiles appends the paths of all files under dir except skip to result.
+func (l *SkillLoader) listFiles(ctx context.Context, dir, skip string, result *[]string) error {
+	files, err := l.backend.ListDirectory(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		p := path.Join(dir, file.Path)
+		if file.IsDir {
+			if err := l.listFiles(ctx, p, skip, result); err != nil {
+				return err
+			}
+			continue
+		}
+		if p != skip {
+			*result = append(*result, p)
+		}
+	}
+	return nil
+}
+
 // normalizePath normalizes a path to use forward slashes and remove trailing slashes.
 // Leading slashes are preserved so callers can pass absolute store paths (e.g. "/skills/foo").
 func normalizePath(path string) string {
@@ -0,0 +1,455 @@
+package agentloop
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+// SkillSource provides skill files to be written under /skills/, see [NewSkillSourceMiddleware].
+type SkillSource interface {
+	// Version returns a value that changes whenever the files change. It is checked on every
+	// execution when hot reload is enabled, so it should be cheap.
+	Version(ctx context.Context) (string, error)
+
+	// Files returns the skill files keyed by path relative to /skills/, e.g. "humanizer/SKILL.md".
+	Files(ctx context.Context) (map[string][]byte, error)
+}
+
+// fsSkillSource reads skill directories from the root of a fs.FS.
+type fsSkillSource struct {
+	fsys  fs.FS
+	names map[string]bool // skill directories to include; all if empty
+}
+
+// NewFSSkillSource creates a SkillSource reading skills from fsys, e.g. an embed.FS.
+// The root of fsys must contain skill directories directly (each with a SKILL.md file).
+// If skillNames are provided, only skill directories with matching names are included.
+func NewFSSkillSource(fsys fs.FS, skillNames ...string) SkillSource {
+	names := make(map[string]bool, len(skillNames))
+	for _, n := range skillNames {
+		names[n] = true
+	}
+	return &fsSkillSource{fsys: fsys, names: names}
+}
+
+// NewDirSkillSource creates a SkillSource reading skills from the OS directory dir, which must
+// contain skill directories directly. If skillNames are provided, only skill directories with
+// matching names are included. The version changes whenever a file is added, removed or modified.
+func NewDirSkillSource(dir string, skillNames ...string) SkillSource {
+	return NewFSSkillSource(os.DirFS(dir), skillNames...)
+}
+
+// walk calls fn for every file of the included skill directories.
+func (s *fsSkillSource) walk(fn func(p string, d fs.DirEntry) error) error {
+	entries, err := fs.ReadDir(s.fsys, ".")
+	if err != nil {
+		return errs.Wrapf(err, "failed to read skills root")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || (len(s.names) > 0 && !s.names[entry.Name()]) {
+			continue
+		}
+		err := fs.WalkDir(s.fsys, entry.Name(), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			return fn(p, d)
+		})
+		if err != nil {
+			return errs.Wrapf(err, "failed to walk skill %s", entry.Name())
+		}
+	}
+	return nil
+}
+
+// Version returns a hash of the paths, sizes and modification times of the files.
+func (s *fsSkillSource) Version(ctx context.Context) (string, error) {
+	h := sha256.New()
+	err := s.walk(func(p string, d fs.DirEntry) error {
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *fsSkillSource) Files(ctx context.Context) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := s.walk(func(p string, d fs.DirEntry) error {
+		content, err := fs.ReadFile(s.fsys, p)
+		if err != nil {
+			return err
+		}
+		files[p] = content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// archiveSkillSource reads skill directories from a zip or tar bundle.
+type archiveSkillSource struct {
+	path  string
+	names []string
+}
+
+// NewArchiveSkillSource creates a SkillSource reading skills from a zip, tar or gzipped tar bundle
+// at path. The format is detected from the content. The root of the bundle must contain skill
+// directories directly. If skillNames are provided, only skill directories with matching names
+// are included. The version changes whenever the bundle file is replaced or modified.
+func NewArchiveSkillSource(path string, skillNames ...string) SkillSource {
+	return &archiveSkillSource{path: path, names: skillNames}
+}
+
+// Version returns the size and modification time of the bundle file.
+func (s *archiveSkillSource) Version(ctx context.Context) (string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", errs.Wrapf(err, "failed to stat skill bundle %s", s.path)
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+func (s *archiveSkillSource) Files(ctx context.Context) (map[string][]byte, error) {
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to read skill bundle %s", s.path)
+	}
+
+	if bytes.HasPrefix(buf, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to open zip skill bundle %s", s.path)
+		}
+		return NewFSSkillSource(zr, s.names...).Files(ctx)
+	}
+
+	var r io.Reader = bytes.NewReader(buf)
+	if bytes.HasPrefix(buf, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to open gzip skill bundle %s", s.path)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to read tar skill bundle %s", s.path)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		p := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		skill, _, nested := strings.Cut(p, "/")
+		if !nested || (len(s.names) > 0 && !slices.Contains(s.names, skill)) {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to read %s in skill bundle %s", hdr.Name, s.path)
+		}
+		files[p] = content
+	}
+	return files, nil
+}
+
+// SkillRegistry is an in-process, versioned SkillSource. Each [SkillRegistry.Register] adds a new
+// version of a skill, which becomes the current one; [SkillRegistry.Use] switches back to an
+// earlier version. Executions started after a change see the current versions when the registry
+// is used with hot reload, see [WithSkillHotReload].
+type SkillRegistry struct {
+	mu       sync.Mutex
+	revision int
+	skills   map[string]*registeredSkill
+}
+
+type registeredSkill struct {
+	current  int                 // 1-based version in use; 0 if removed
+	versions []map[string][]byte // files of each version, keyed by path relative to the skill directory
+}
+
+// NewSkillRegistry creates an empty SkillRegistry.
+func NewSkillRegistry() *SkillRegistry {
+	return &SkillRegistry{skills: map[string]*registeredSkill{}}
+}
+
+// Register adds a new version of the skill with the given files, keyed by path relative to the
+// skill directory. files must contain a valid SKILL.md whose name is name. Returns the new version,
+// starting from 1.
+func (r *SkillRegistry) Register(name string, files map[string][]byte) (int, error) {
+	skillMd, ok := files["SKILL.md"]
+	if !ok {
+		return 0, errs.NewErrf("skill %s: SKILL.md is missing", name)
+	}
+	skill, err := LoadSkill(name+"/SKILL.md", skillMd)
+	if err != nil {
+		return 0, errs.Wrapf(err, "skill %s: invalid SKILL.md", name)
+	}
+	if skill.Metadata.Name != name {
+		return 0, errs.NewErrf("skill %s: SKILL.md is named %q", name, skill.Metadata.Name)
+	}
+	copied := make(map[string][]byte, len(files))
+	for p, content := range files {
+		cleaned := strings.TrimPrefix(path.Clean("/"+p), "/")
+		if cleaned == "" {
+			return 0, errs.NewErrf("skill %s: invalid file path %q", name, p)
+		}
+		copied[cleaned] = slices.Clone(content)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.skills[name]
+	if !ok {
+		rs = &registeredSkill{}
+		r.skills[name] = rs
+	}
+	rs.versions = append(rs.versions, copied)
+	rs.current = len(rs.versions)
+	r.revision++
+	return rs.current, nil
+}
+
+// Use makes an earlier version of the skill the current one, e.g. to roll back.
+func (r *SkillRegistry) Use(name string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.skills[name]
+	if !ok || version < 1 || version > len(rs.versions) {
+		return errs.NewErrf("skill %s version %d not found", name, version)
+	}
+	rs.current = version
+	r.revision++
+	return nil
+}
+
+// Remove stops providing the skill. Its versions are kept, so it can be restored with Use.
+func (r *SkillRegistry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rs, ok := r.skills[name]; ok && rs.current > 0 {
+		rs.current = 0
+		r.revision++
+	}
+}
+
+// Versions returns the current version of each provided skill, keyed by name.
+func (r *SkillRegistry) Versions() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]int, len(r.skills))
+	for name, rs := range r.skills {
+		if rs.current > 0 {
+			out[name] = rs.current
+		}
+	}
+	return out
+}
+
+// Version returns the revision of the registry, which changes on every Register, Use and Remove.
+func (r *SkillRegistry) Version(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprint(r.revision), nil
+}
+
+// Files returns the files of the current version of every skill.
+func (r *SkillRegistry) Files(ctx context.Context) (map[string][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := map[string][]byte{}
+	for name, rs := range r.skills {
+		if rs.current == 0 {
+			continue
+		}
+		for p, content := range rs.versions[rs.current-1] {
+			files[name+"/"+p] = content
+		}
+	}
+	return files, nil
+}
+
+// SkillSourceOption is a functional option for [NewSkillSourceMiddleware].
+type SkillSourceOption = func(o *skillSourceConfig)
+
+type skillSourceConfig struct {
+	hotReload      bool
+	reloadInterval time.Duration
+}
+
+// WithSkillHotReload makes the middleware check the versions of its sources when an execution
+// starts, at most once per interval, and reload them when they changed. Without it, the sources
+// are read once, on the first execution.
+func WithSkillHotReload(interval time.Duration) SkillSourceOption {
+	return func(o *skillSourceConfig) {
+		o.hotReload = true
+		o.reloadInterval = interval
+	}
+}
+
+// skillSourceMiddleware writes the files of its SkillSources into the agent's FileStore
+// during BeforeAgent, so they are discoverable from /skills/.
+type skillSourceMiddleware struct {
+	BaseMiddleware
+	sources []SkillSource
+	conf    skillSourceConfig
+
+	mu        sync.Mutex
+	loaded    bool
+	versions  []string
+	checkedAt time.Time
+	files     map[string][]byte // virtualPath -> content
+}
+
+// NewSkillSourceMiddleware returns a middleware that writes the skills of sources into /skills/
+// of the agent's FileStore on every execution. When several sources provide a skill with the
+// same directory name, the one of the later source is used as a whole.
+//
+// Sources are read on the first execution and cached; with [WithSkillHotReload], changes are
+// picked up by later executions without restarting the service. Files removed from a source
+// are not deleted from a FileStore that outlives executions.
+//
+// Example:
+//
+//	skills := agentloop.NewSkillSourceMiddleware([]agentloop.SkillSource{
+//	    agentloop.NewFSSkillSource(builtinSkillsFS),
+//	    agentloop.NewDirSkillSource("/etc/my-service/skills"),
+//	}, agentloop.WithSkillHotReload(10*time.Second))
+func NewSkillSourceMiddleware(sources []SkillSource, opts ...SkillSourceOption) Middleware {
+	m := &skillSourceMiddleware{sources: sources}
+	for _, op := range opts {
+		op(&m.conf)
+	}
+	return m
+}
+
+func (m *skillSourceMiddleware) Name() string { return "skills" }
+
+func (m *skillSourceMiddleware) BeforeAgent(ctx context.Context, agentCtx AgentContext) error {
+	files, err := m.currentFiles(ctx)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := agentCtx.Store.WriteFile(ctx, p, files[p]); err != nil {
+			return errs.Wrapf(err, "failed to write skill %s", p)
+		}
+	}
+	return nil
+}
+
+// currentFiles returns the cached files, reloading the sources first if needed.
+func (m *skillSourceMiddleware) currentFiles(ctx context.Context) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded && (!m.conf.hotReload || time.Since(m.checkedAt) < m.conf.reloadInterval) {
+		return m.files, nil
+	}
+
+	versions := make([]string, len(m.sources))
+	for i, s := range m.sources {
+		v, err := s.Version(ctx)
+		if err != nil {
+			if m.loaded {
+				flow.NewRail(ctx).Warnf("Failed to check skill source version, using cached skills, %v", err)
+				m.checkedAt = time.Now()
+				return m.files, nil
+			}
+			return nil, errs.Wrapf(err, "failed to check skill source version")
+		}
+		versions[i] = v
+	}
+	m.checkedAt = time.Now()
+	if m.loaded && slices.Equal(versions, m.versions) {
+		return m.files, nil
+	}
+
+	files, err := loadSkillSources(ctx, m.sources)
+	if err != nil {
+		if m.loaded {
+			flow.NewRail(ctx).Warnf("Failed to reload skill sources, using cached skills, %v", err)
+			return m.files, nil
+		}
+		return nil, err
+	}
+	if m.loaded {
+		flow.NewRail(ctx).Infof("Reloaded skill sources, %d files", len(files))
+	}
+	m.files, m.versions, m.loaded = files, versions, true
+	return files, nil
+}
+
+// loadSkillSources merges the files of sources into virtual paths under /skills/.
+// A skill directory provided by a later source replaces the one of earlier sources.
+func loadSkillSources(ctx context.Context, sources []SkillSource) (map[string][]byte, error) {
+	bySkill := map[string]map[string][]byte{}
+	for _, s := range sources {
+		files, err := s.Files(ctx)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to load skill source")
+		}
+		fromSource := map[string]map[string][]byte{}
+		for p, content := range files {
+			p = strings.TrimPrefix(path.Clean("/"+p), "/")
+			skill, _, nested := strings.Cut(p, "/")
+			if !nested {
+				continue
+			}
+			if fromSource[skill] == nil {
+				fromSource[skill] = map[string][]byte{}
+			}
+			fromSource[skill][p] = content
+		}
+		for skill, skillFiles := range fromSource {
+			bySkill[skill] = skillFiles
+		}
+	}
+	out := map[string][]byte{}
+	for _, skillFiles := range bySkill {
+		for p, content := range skillFiles {
+			out["/skills/"+p] = content
+		}
+	}
+	return out, nil
+}
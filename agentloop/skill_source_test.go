@@ -0,0 +1,170 @@
+package agentloop
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/curtisnewbie/miso/flow"
+)
+
+func testSkillMd(name, description string) string {
+	return "---\nname: " + name + "\ndescription: " + description + "\n---\n# " + name
+}
+
+// loadSkillsVia runs the middleware's BeforeAgent on a fresh store and loads the skills written to /skills.
+func loadSkillsVia(t *testing.T, m Middleware) (SkillsMap, FileStore) {
+	t.Helper()
+	ctx := context.Background()
+	store := NewTmpFileStore()
+	t.Cleanup(func() { store.OnSessionEnd(flow.NewRail(ctx)) })
+	if err := m.BeforeAgent(ctx, AgentContext{Store: store}); err != nil {
+		t.Fatalf("BeforeAgent() error = %v", err)
+	}
+	skills, err := NewSkillLoader(store).LoadFromSources(ctx, []string{"/skills"})
+	if err != nil {
+		t.Fatalf("LoadFromSources() error = %v", err)
+	}
+	return skills, store
+}
+
+func TestDirSkillSource_HotReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(p, content string) {
+		full := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("humanizer/SKILL.md", testSkillMd("humanizer", "Make text sound human"))
+	write("humanizer/reference/tone.md", "be casual")
+
+	m := NewSkillSourceMiddleware([]SkillSource{NewDirSkillSource(dir)}, WithSkillHotReload(0))
+	skills, store := loadSkillsVia(t, m)
+	if _, ok := skills.Get("humanizer"); !ok || len(skills) != 1 {
+		t.Fatalf("skills = %v, want [humanizer]", skills)
+	}
+	if ok, _ := store.FileExists(context.Background(), "/skills/humanizer/reference/tone.md"); !ok {
+		t.Error("bundled resource was not written")
+	}
+
+	write("web-research/SKILL.md", testSkillMd("web-research", "Research the web"))
+	skills, _ = loadSkillsVia(t, m)
+	if _, ok := skills.Get("web-research"); !ok {
+		t.Errorf("skills after change = %v, want web-research to be reloaded", skills)
+	}
+
+	noReload := NewSkillSourceMiddleware([]SkillSource{NewDirSkillSource(dir, "humanizer")})
+	loadSkillsVia(t, noReload)
+	write("humanizer/SKILL.md", testSkillMd("humanizer", "Changed"))
+	skills, _ = loadSkillsVia(t, noReload)
+	if s, _ := skills.Get("humanizer"); s == nil || s.Metadata.Description != "Make text sound human" || len(skills) != 1 {
+		t.Errorf("without hot reload skills should be read once and filtered, got %v", skills)
+	}
+}
+
+func TestArchiveSkillSource(t *testing.T) {
+	files := map[string]string{
+		"humanizer/SKILL.md":     testSkillMd("humanizer", "Make text sound human"),
+		"humanizer/scripts/a.sh": "echo hi",
+		"README.md":              "not a skill",
+	}
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for p, c := range files {
+		w, _ := zw.Create(p)
+		w.Write([]byte(c))
+	}
+	zw.Close()
+
+	var tgzBuf bytes.Buffer
+	gw := gzip.NewWriter(&tgzBuf)
+	tw := tar.NewWriter(gw)
+	for p, c := range files {
+		tw.WriteHeader(&tar.Header{Name: "./" + p, Mode: 0o644, Size: int64(len(c)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(c))
+	}
+	tw.Close()
+	gw.Close()
+
+	dir := t.TempDir()
+	for name, buf := range map[string][]byte{"skills.zip": zipBuf.Bytes(), "skills.tgz": tgzBuf.Bytes()} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, buf, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewArchiveSkillSource(p).Files(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Files() error = %v", name, err)
+		}
+		if len(got) != 2 || string(got["humanizer/scripts/a.sh"]) != "echo hi" || got["humanizer/SKILL.md"] == nil {
+			t.Errorf("%s: files = %v, want the 2 humanizer files", name, got)
+		}
+	}
+}
+
+func TestSkillRegistry(t *testing.T) {
+	r := NewSkillRegistry()
+	if _, err := r.Register("humanizer", map[string][]byte{"notes.md": []byte("x")}); err == nil {
+		t.Error("missing SKILL.md: error = nil, want error")
+	}
+	if _, err := r.Register("humanizer", map[string][]byte{"SKILL.md": []byte(testSkillMd("other", "x"))}); err == nil {
+		t.Error("mismatched name: error = nil, want error")
+	}
+
+	v1, _ := r.Register("humanizer", map[string][]byte{"SKILL.md": []byte(testSkillMd("humanizer", "v1"))})
+	m := NewSkillSourceMiddleware([]SkillSource{r}, WithSkillHotReload(0))
+	skills, _ := loadSkillsVia(t, m)
+	if s, _ := skills.Get("humanizer"); s == nil || s.Metadata.Description != "v1" {
+		t.Fatalf("skills = %v, want humanizer v1", skills)
+	}
+
+	v2, err := r.Register("humanizer", map[string][]byte{"SKILL.md": []byte(testSkillMd("humanizer", "v2"))})
+	if err != nil || v2 != v1+1 {
+		t.Fatalf("Register() = %d, %v, want version %d", v2, err, v1+1)
+	}
+	skills, _ = loadSkillsVia(t, m)
+	if s, _ := skills.Get("humanizer"); s == nil || s.Metadata.Description != "v2" {
+		t.Errorf("after Register, description = %v, want v2", s)
+	}
+
+	if err := r.Use("humanizer", v1); err != nil {
+		t.Fatalf("Use() error = %v", err)
+	}
+	skills, _ = loadSkillsVia(t, m)
+	if s, _ := skills.Get("humanizer"); s == nil || s.Metadata.Description != "v1" {
+		t.Errorf("after Use(v1), description = %v, want v1", s)
+	}
+
+	r.Remove("humanizer")
+	if files, _ := r.Files(context.Background()); len(files) != 0 {
+		t.Errorf("after Remove, files = %v, want none", files)
+	}
+	if err := r.Use("humanizer", 3); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Use(missing version) error = %v, want not found", err)
+	}
+}
+
+func TestSkillSourceMiddleware_LaterSourceWins(t *testing.T) {
+	a, b := NewSkillRegistry(), NewSkillRegistry()
+	a.Register("humanizer", map[string][]byte{"SKILL.md": []byte(testSkillMd("humanizer", "from a")), "old.md": []byte("x")})
+	b.Register("humanizer", map[string][]byte{"SKILL.md": []byte(testSkillMd("humanizer", "from b"))})
+
+	skills, store := loadSkillsVia(t, NewSkillSourceMiddleware([]SkillSource{a, b}, WithSkillHotReload(time.Minute)))
+	if s, _ := skills.Get("humanizer"); s == nil || s.Metadata.Description != "from b" {
+		t.Errorf("description = %v, want from b", s)
+	}
+	if ok, _ := store.FileExists(context.Background(), "/skills/humanizer/old.md"); ok {
+		t.Error("files of the overridden skill should not be written")
+	}
+}
@@ -0,0 +1,165 @@
+package agentloop
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+// AgentEventKind identifies the kind of event emitted by [Agent.ExecuteStream].
+type AgentEventKind string
+
+const (
+	// AgentEventKindContentDelta carries an incremental chunk of assistant content.
+	AgentEventKindContentDelta AgentEventKind = "content_delta"
+	// AgentEventKindReasoningDelta carries an incremental chunk of model reasoning content.
+	AgentEventKindReasoningDelta AgentEventKind = "reasoning_delta"
+	// AgentEventKindToolCall fires when the LLM invokes a tool, before execution begins.
+	AgentEventKindToolCall AgentEventKind = "tool_call"
+	// AgentEventKindToolResult fires after a tool finishes execution, with its result.
+	AgentEventKindToolResult AgentEventKind = "tool_result"
+	// AgentEventKindCompaction fires after the conversation history has been compacted.
+	AgentEventKindCompaction AgentEventKind = "compaction"
+	// AgentEventKindDone is always the last event; it carries the final TaskOutput and error.
+	AgentEventKindDone AgentEventKind = "done"
+)
+
+// AgentEvent is emitted by [Agent.ExecuteStream] while the ReAct loop runs.
+//
+// Only the fields relevant to Kind are populated.
+type AgentEvent struct {
+	Kind  AgentEventKind
+	Agent string // Name of the agent that emitted the event; differs from the streamed agent for sub-agent events
+
+	Delta string // Content or reasoning chunk (content_delta, reasoning_delta)
+
+	ToolName   string // Tool name (tool_call, tool_result)
+	ToolArgs   string // Raw JSON args (tool_call, tool_result)
+	ToolResult string // Tool result (tool_result)
+
+	Summary string // Compaction summary (compaction)
+
+	Output *TaskOutput // Final output (done)
+	Err    error       // Execution error, if any (done)
+}
+
+// eventSink receives AgentEvents for a single streamed execution.
+type eventSink func(ev AgentEvent)
+
+// eventSinkFromCtx returns the eventSink registered by ExecuteStream, or nil.
+func eventSinkFromCtx(ctx context.Context) eventSink {
+	if v, ok := ctx.Value(eventSinkCtxKey).(eventSink); ok {
+		return v
+	}
+	return nil
+}
+
+// emitEvent sends ev to the eventSink in ctx, if any.
+func emitEvent(ctx context.Context, ev AgentEvent) {
+	if sink := eventSinkFromCtx(ctx); sink != nil {
+		sink(ev)
+	}
+}
+
+// ExecuteStream runs the agent like [Agent.Execute], but emits events while the loop runs:
+// assistant content and reasoning deltas, tool calls and results, compaction events, and
+// finally a single [AgentEventKindDone] event carrying the TaskOutput and error.
+// The returned channel is closed after the done event.
+//
+// Model calls are made via Stream() instead of Generate() while streaming so deltas can be
+// forwarded as they arrive. Events from sub-agents invoked via [NewSubAgentTool] are forwarded
+// to the same channel; use AgentEvent.Agent to tell them apart.
+//
+// The caller must drain the channel until it is closed, or cancel the rail's context;
+// emitting blocks until the event is received or the context is done.
+//
+// Example:
+//
+//	for ev := range agent.ExecuteStream(rail, agentloop.AgentRequest{UserInput: "..."}) {
+//	    switch ev.Kind {
+//	    case agentloop.AgentEventKindContentDelta:
+//	        fmt.Print(ev.Delta)
+//	    case agentloop.AgentEventKindDone:
+//	        out, err := ev.Output, ev.Err
+//	    }
+//	}
+func (a *Agent) ExecuteStream(rail flow.Rail, req AgentRequest) <-chan AgentEvent {
+	ch := make(chan AgentEvent, 64)
+	var sink eventSink = func(ev AgentEvent) {
+		select {
+		case ch <- ev:
+		case <-rail.Done():
+		}
+	}
+	go func() {
+		defer close(ch)
+		defer func() {
+			if v := recover(); v != nil {
+				sink(AgentEvent{Kind: AgentEventKindDone, Agent: a.config.Name, Err: errs.NewErrf("agent panicked: %v", v)})
+			}
+		}()
+		out, err := a.Execute(rail.WithCtxVal(eventSinkCtxKey, sink), req)
+		sink(AgentEvent{Kind: AgentEventKindDone, Agent: a.config.Name, Output: &out, Err: err})
+	}()
+	return ch
+}
+
+// streamToolEventCallback returns a ToolEvent callback that forwards tool calls and results
+// to sink as AgentEvents, then delegates to next (if non-nil).
+func streamToolEventCallback(agentName string, next func(event ToolEvent), sink eventSink) func(event ToolEvent) {
+	return func(event ToolEvent) {
+		if next != nil {
+			next(event)
+		}
+		ev := AgentEvent{Agent: agentName, ToolName: event.Name, ToolArgs: event.Args}
+		switch event.Kind {
+		case ToolEventKindCall:
+			ev.Kind = AgentEventKindToolCall
+		case ToolEventKindResult:
+			ev.Kind = AgentEventKindToolResult
+			ev.ToolResult = event.Result
+		default:
+			return
+		}
+		sink(ev)
+	}
+}
+
+// streamGenerate calls m.Stream, forwards each chunk's content and reasoning deltas to sink,
+// and returns the concatenated message, equivalent to what Generate would have returned.
+func streamGenerate(ctx context.Context, agentName string, m model.BaseChatModel, input []*schema.Message, sink eventSink, opts ...model.Option) (*schema.Message, error) {
+	sr, err := m.Stream(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if chunk == nil {
+			continue
+		}
+		if chunk.ReasoningContent != "" {
+			sink(AgentEvent{Kind: AgentEventKindReasoningDelta, Agent: agentName, Delta: chunk.ReasoningContent})
+		}
+		if chunk.Content != "" {
+			sink(AgentEvent{Kind: AgentEventKindContentDelta, Agent: agentName, Delta: chunk.Content})
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		return nil, errs.NewErrf("model returned an empty stream")
+	}
+	return schema.ConcatMessages(chunks)
+}
@@ -0,0 +1,99 @@
+package agentloop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// streamOnlyModel is a BaseChatModel whose Stream emits the configured chunks.
+type streamOnlyModel struct {
+	chunks []*schema.Message
+}
+
+func (m *streamOnlyModel) Generate(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	return schema.ConcatMessages(m.chunks)
+}
+
+func (m *streamOnlyModel) Stream(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray(m.chunks), nil
+}
+
+func TestStreamGenerate_ForwardsDeltas(t *testing.T) {
+	m := &streamOnlyModel{chunks: []*schema.Message{
+		{Role: schema.Assistant, ReasoningContent: "thinking"},
+		{Role: schema.Assistant, Content: "Hello"},
+		{Role: schema.Assistant, Content: ", world"},
+	}}
+
+	var events []AgentEvent
+	msg, err := streamGenerate(context.Background(), "test-agent", m, nil, func(ev AgentEvent) {
+		events = append(events, ev)
+	})
+	if err != nil {
+		t.Fatalf("streamGenerate() error = %v", err)
+	}
+	if msg.Content != "Hello, world" {
+		t.Errorf("Content = %q, want %q", msg.Content, "Hello, world")
+	}
+	if msg.ReasoningContent != "thinking" {
+		t.Errorf("ReasoningContent = %q, want %q", msg.ReasoningContent, "thinking")
+	}
+
+	want := []AgentEvent{
+		{Kind: AgentEventKindReasoningDelta, Agent: "test-agent", Delta: "thinking"},
+		{Kind: AgentEventKindContentDelta, Agent: "test-agent", Delta: "Hello"},
+		{Kind: AgentEventKindContentDelta, Agent: "test-agent", Delta: ", world"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i := range want {
+		if events[i].Kind != want[i].Kind || events[i].Delta != want[i].Delta || events[i].Agent != want[i].Agent {
+			t.Errorf("event[%d] = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestStreamGenerate_EmptyStream(t *testing.T) {
+	m := &streamOnlyModel{}
+	if _, err := streamGenerate(context.Background(), "test-agent", m, nil, func(AgentEvent) {}); err == nil {
+		t.Error("expected error for empty stream, got nil")
+	}
+}
+
+func TestStreamToolEventCallback(t *testing.T) {
+	var forwarded []ToolEvent
+	var events []AgentEvent
+	cb := streamToolEventCallback("test-agent",
+		func(event ToolEvent) { forwarded = append(forwarded, event) },
+		func(ev AgentEvent) { events = append(events, ev) },
+	)
+
+	cb(ToolEvent{Kind: ToolEventKindCall, Name: "read_file", Args: `{"path":"/a"}`})
+	cb(ToolEvent{Kind: ToolEventKindResult, Name: "read_file", Args: `{"path":"/a"}`, Result: "content"})
+
+	if len(forwarded) != 2 {
+		t.Errorf("got %d forwarded ToolEvents, want 2", len(forwarded))
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d AgentEvents, want 2", len(events))
+	}
+	if events[0].Kind != AgentEventKindToolCall || events[0].ToolName != "read_file" || events[0].ToolArgs != `{"path":"/a"}` {
+		t.Errorf("events[0] = %+v, want tool_call for read_file", events[0])
+	}
+	if events[1].Kind != AgentEventKindToolResult || events[1].ToolResult != "content" {
+		t.Errorf("events[1] = %+v, want tool_result with content", events[1])
+	}
+}
+
+func TestStreamToolEventCallback_NilNext(t *testing.T) {
+	var events []AgentEvent
+	cb := streamToolEventCallback("test-agent", nil, func(ev AgentEvent) { events = append(events, ev) })
+	cb(ToolEvent{Kind: ToolEventKindCall, Name: "glob"})
+	if len(events) != 1 {
+		t.Fatalf("got %d AgentEvents, want 1", len(events))
+	}
+}
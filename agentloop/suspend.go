@@ -0,0 +1,115 @@
+package agentloop
+
+import (
+	"context"
+	"sync"
+)
+
+// StopReason explains why an agent run stopped.
+//
+// Only StopReasonCompleted means the task was carried out as intended. For every other reason
+// TaskOutput still holds the response, artifacts, todos and metadata collected so far.
+type StopReason string
+
+const (
+	// StopReasonCompleted means the model produced its final answer.
+	StopReasonCompleted StopReason = "completed"
+	// StopReasonPendingApproval means the run is suspended until the tool calls listed in
+	// TaskOutput.PendingApprovals are approved, rejected or edited. See [NewToolApprovalMiddleware].
+	StopReasonPendingApproval StopReason = "pending_approval"
+	// StopReasonNeedsInput means the run is suspended by the ask_user tool until the question in
+	// TaskOutput.Question is answered via AgentRequest.Answer.
+	StopReasonNeedsInput StopReason = "needs_input"
+	// StopReasonBudgetExceeded means a [Budget] limit was reached and the model was asked to
+	// give its final answer early. TaskOutput.BudgetExceeded names the limit.
+	StopReasonBudgetExceeded StopReason = "budget_exceeded"
+	// StopReasonMaxSteps means the last round allowed by MaxRunSteps was reached and the model was
+	// asked to give its final answer without tools. See AgentConfig.FinalAnswerOnMaxSteps.
+	StopReasonMaxSteps StopReason = "max_steps"
+	// StopReasonCancelled means the context of the execution was cancelled or its deadline passed.
+	StopReasonCancelled StopReason = "cancelled"
+	// StopReasonOutputCheckExhausted means AgentConfig.OutputCheck gave up with
+	// [ErrOutputCheckExhausted]; Response is the last response, which did not pass the check.
+	StopReasonOutputCheckExhausted StopReason = "output_check_exhausted"
+	// StopReasonError means the run failed; Execute also returns the error.
+	StopReasonError StopReason = "error"
+)
+
+// suspension collects, for one execution, the tool calls that asked to suspend the run.
+// The tools branch checks it after every tools node run and routes to final_output if non-empty.
+type suspension struct {
+	mu        sync.Mutex
+	approvals []PendingToolCall
+	question  *PendingQuestion
+}
+
+func (s *suspension) addApproval(p PendingToolCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.approvals = append(s.approvals, p)
+}
+
+func (s *suspension) pendingApprovals() []PendingToolCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.approvals) == 0 {
+		return nil
+	}
+	return append([]PendingToolCall(nil), s.approvals...)
+}
+
+// setQuestion records q as the pending question. Only one question can be pending at a time;
+// it returns false if another one was already asked in this round.
+func (s *suspension) setQuestion(q PendingQuestion) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.question != nil {
+		return false
+	}
+	s.question = &q
+	return true
+}
+
+func (s *suspension) pendingQuestion() *PendingQuestion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.question == nil {
+		return nil
+	}
+	q := *s.question
+	return &q
+}
+
+func (s *suspension) suspended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.approvals) > 0 || s.question != nil
+}
+
+// stopReason returns the StopReason of a suspended run, or StopReasonCompleted if not suspended.
+// Pending approvals take precedence, since they must be decided before the run can continue.
+func (s *suspension) stopReason() StopReason {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(s.approvals) > 0:
+		return StopReasonPendingApproval
+	case s.question != nil:
+		return StopReasonNeedsInput
+	}
+	return StopReasonCompleted
+}
+
+// isPendingResult reports whether result is the placeholder of a tool call that suspended the run,
+// awaiting approval or the user's answer. The real result replaces it once the run is resumed.
+func isPendingResult(result string) bool {
+	return result == pendingApprovalResult || result == pendingAnswerResult
+}
+
+// suspensionFromCtx returns the suspension of the current execution, or nil.
+func suspensionFromCtx(ctx context.Context) *suspension {
+	if v, ok := ctx.Value(suspensionCtxKey).(*suspension); ok {
+		return v
+	}
+	return nil
+}
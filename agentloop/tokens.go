@@ -1,30 +1,90 @@
 package agentloop
 
 import (
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/cloudwego/eino/schema"
 )
 
-// Tokenizer counts tokens using a simple len/4 approximation.
-type Tokenizer struct{}
+// Tokenizer counts tokens for context window budgeting: MaxTokens, compaction, tool result
+// offloading and Budget. Select one with AgentConfig.Tokenizer.
+//
+// Built-in implementations: [NewTokenizer] (CJK-aware heuristic, the default) and
+// bpe.NewTokenizer in package agentloop/bpe (exact BPE counts). Use [NewTokenizerFunc] to plug in
+// another one.
+type Tokenizer interface {
+	// CountTokens returns the token count of text.
+	CountTokens(text string) int
+
+	// CountMessageTokens returns the token count of a message, including role and tool calls.
+	CountMessageTokens(msg *schema.Message) int
+
+	// CountMessagesTokens returns the total token count of messages, including reply priming.
+	CountMessagesTokens(messages []*schema.Message) int
+}
 
-// NewTokenizer creates a new Tokenizer.
+// NewTokenizer creates the default Tokenizer, see [NewHeuristicTokenizer].
 func NewTokenizer() Tokenizer {
-	return Tokenizer{}
+	return NewHeuristicTokenizer()
+}
+
+// NewHeuristicTokenizer creates a Tokenizer that estimates token counts without a vocabulary:
+// one token per CJK character and 4 bytes per token for everything else.
+//
+// The 4 bytes per token heuristic (as used by opencode) holds for English prose and code, but
+// underestimates Chinese, Japanese and Korean text by 25% or more, where BPE vocabularies spend
+// about one token per character. It is cheap and model-agnostic; use bpe.NewTokenizer (package
+// agentloop/bpe) when exact counts matter.
+func NewHeuristicTokenizer() Tokenizer {
+	return NewTokenizerFunc(countTokensHeuristic)
+}
+
+// NewTokenizerFunc creates a Tokenizer that counts the tokens of text with count.
+// Message overheads are added the same way as the built-in tokenizers.
+func NewTokenizerFunc(count func(text string) int) Tokenizer {
+	return textTokenizer{count: count}
+}
+
+// countTokensHeuristic counts CJK characters as one token each and other text as 4 bytes per token.
+func countTokensHeuristic(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+	}
+	return cjk + other/4
 }
 
-// CountTokens returns an approximate token count for the given text.
-// Uses the same heuristic as opencode: 4 characters per token on average.
-// This is model-agnostic and avoids model-specific tokenizer dependencies.
-// Accuracy varies by content (~4 chars/token for English prose, less accurate
-// for code or non-Latin scripts), but is sufficient for context window budgeting.
-func (t Tokenizer) CountTokens(text string) int {
-	return len(text) / 4
+// isCJK reports whether r is a Chinese, Japanese or Korean character, or CJK/fullwidth punctuation.
+func isCJK(r rune) bool {
+	if r < 0x2E80 {
+		return false
+	}
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJK symbols and punctuation
+		(r >= 0xFF00 && r <= 0xFFEF) // Halfwidth and fullwidth forms
+}
+
+// textTokenizer implements Tokenizer on top of a text token counter.
+type textTokenizer struct {
+	count func(text string) int
+}
+
+func (t textTokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return t.count(text)
 }
 
 // CountMessageTokens returns the token count for a message.
 // This follows OpenAI's token counting methodology for chat messages.
 // See: https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
-func (t Tokenizer) CountMessageTokens(msg *schema.Message) int {
+func (t textTokenizer) CountMessageTokens(msg *schema.Message) int {
 	if msg == nil {
 		return 0
 	}
@@ -59,7 +119,7 @@ func (t Tokenizer) CountMessageTokens(msg *schema.Message) int {
 
 // CountMessagesTokens returns the total token count for a slice of messages.
 // Includes the 3 token priming for assistant reply.
-func (t Tokenizer) CountMessagesTokens(messages []*schema.Message) int {
+func (t textTokenizer) CountMessagesTokens(messages []*schema.Message) int {
 	total := 0
 	for _, msg := range messages {
 		total += t.CountMessageTokens(msg)
@@ -68,3 +128,13 @@ func (t Tokenizer) CountMessagesTokens(messages []*schema.Message) int {
 	total += 3
 	return total
 }
+
+// sumMessageTokens returns the sum of CountMessageTokens over msgs. Unlike CountMessagesTokens,
+// it does not include the reply priming, so the counts of parts of a history can be added up.
+func sumMessageTokens(tokenizer Tokenizer, msgs []*schema.Message) int {
+	total := 0
+	for _, msg := range msgs {
+		total += tokenizer.CountMessageTokens(msg)
+	}
+	return total
+}
@@ -0,0 +1,135 @@
+package agentloop
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// minCalibrationTokens is the smallest estimated prompt used for calibration;
+	// the ratio of smaller prompts is dominated by message overheads.
+	minCalibrationTokens = 256
+
+	// The ratio is clamped so a single odd usage report cannot derail compaction.
+	minTokenRatio = 0.5
+	maxTokenRatio = 4.0
+)
+
+// tokenCalibration corrects the estimates of the agent's Tokenizer for a session with the
+// prompt tokens the provider reports after each chat_model call. The ratio is carried between
+// executions of the session by Checkpoint.TokenRatio and Conversation.TokenRatio.
+//
+// modelPreHandle records the estimate of the prompt about to be sent with expect, and the trace
+// callback reports the actual prompt tokens with observe. The ratio of actual to estimated tokens
+// is averaged over the calls and applied to the counts of [calibratedTokenizer].
+type tokenCalibration struct {
+	mu        sync.Mutex
+	ratio     float64 // 0 until the first observation
+	estimated int     // estimate of the pending chat_model call; 0 if none
+}
+
+// tokenCalibrationFromCtx returns the tokenCalibration of the execution, or nil.
+func tokenCalibrationFromCtx(ctx context.Context) *tokenCalibration {
+	c, _ := ctx.Value(tokenCalibrationCtxKey).(*tokenCalibration)
+	return c
+}
+
+// expect records the estimated prompt tokens of the chat_model call about to be made.
+func (c *tokenCalibration) expect(estimated int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.estimated = estimated
+}
+
+// observe updates the ratio with the prompt tokens reported for the pending call.
+// It returns the new ratio, and false if the call was not used for calibration.
+func (c *tokenCalibration) observe(actual int) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	estimated := c.estimated
+	c.estimated = 0
+	if estimated < minCalibrationTokens || actual <= 0 {
+		return c.ratio, false
+	}
+	r := min(max(float64(actual)/float64(estimated), minTokenRatio), maxTokenRatio)
+	if c.ratio == 0 {
+		c.ratio = r
+	} else {
+		c.ratio = (c.ratio + r) / 2
+	}
+	return c.ratio, true
+}
+
+// getRatio returns the current ratio, or 0 if nothing has been observed.
+func (c *tokenCalibration) getRatio() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ratio
+}
+
+// restore sets the ratio carried over from a checkpoint.
+func (c *tokenCalibration) restore(ratio float64) {
+	if ratio <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ratio = min(max(ratio, minTokenRatio), maxTokenRatio)
+}
+
+// scale applies the ratio to n.
+func (c *tokenCalibration) scale(n int) int {
+	r := c.getRatio()
+	if r == 0 {
+		return n
+	}
+	return int(math.Round(float64(n) * r))
+}
+
+// calibratedTokenizer scales the counts of a Tokenizer with a tokenCalibration.
+type calibratedTokenizer struct {
+	t Tokenizer
+	c *tokenCalibration
+}
+
+func (t calibratedTokenizer) CountTokens(text string) int {
+	return t.c.scale(t.t.CountTokens(text))
+}
+
+func (t calibratedTokenizer) CountMessageTokens(msg *schema.Message) int {
+	return t.c.scale(t.t.CountMessageTokens(msg))
+}
+
+func (t calibratedTokenizer) CountMessagesTokens(messages []*schema.Message) int {
+	return t.c.scale(t.t.CountMessagesTokens(messages))
+}
+
+// tokenizerFor returns the agent's Tokenizer, calibrated for the execution of ctx.
+func (a *Agent) tokenizerFor(ctx context.Context) Tokenizer {
+	if c := tokenCalibrationFromCtx(ctx); c != nil {
+		return calibratedTokenizer{t: a.tokenizer, c: c}
+	}
+	return a.tokenizer
+}
+
+// estimateToolTokens estimates the prompt tokens spent on tool definitions, which the provider
+// counts as part of the prompt but are not in the messages.
+func estimateToolTokens(tokenizer Tokenizer, infos []*schema.ToolInfo) int {
+	total := 0
+	for _, info := range infos {
+		total += tokenizer.CountTokens(info.Name) + tokenizer.CountTokens(info.Desc)
+		if info.ParamsOneOf == nil {
+			continue
+		}
+		if js, err := info.ParamsOneOf.ToJSONSchema(); err == nil && js != nil {
+			if buf, err := json.Marshal(js); err == nil {
+				total += tokenizer.CountTokens(string(buf))
+			}
+		}
+	}
+	return total
+}
@@ -171,3 +171,51 @@ func TestTokenizer_CountMessagesTokens(t *testing.T) {
 		})
 	}
 }
+
+func TestHeuristicTokenizer_CJK(t *testing.T) {
+	tokenizer := NewHeuristicTokenizer()
+
+	// 14 Chinese characters and 2 fullwidth punctuation marks, about one token each.
+	text := "今天天气很好，我们去公园散步吧。"
+	if got := tokenizer.CountTokens(text); got != 16 {
+		t.Errorf("CountTokens(%q) = %d, want 16", text, got)
+	}
+	if got := tokenizer.CountTokens("Hello 世界"); got != 3 {
+		t.Errorf("CountTokens(mixed) = %d, want 3", got)
+	}
+}
+
+func TestTokenCalibration(t *testing.T) {
+	c := &tokenCalibration{}
+	tokenizer := calibratedTokenizer{t: NewHeuristicTokenizer(), c: c}
+	text := "abcdefgh" // 2 tokens
+
+	if got := tokenizer.CountTokens(text); got != 2 {
+		t.Errorf("uncalibrated CountTokens() = %d, want 2", got)
+	}
+
+	// Too small to calibrate.
+	c.expect(100)
+	if _, ok := c.observe(300); ok {
+		t.Error("observe() should skip prompts below minCalibrationTokens")
+	}
+
+	c.expect(1000)
+	if ratio, ok := c.observe(1500); !ok || ratio != 1.5 {
+		t.Errorf("observe() = %v, %v, want 1.5, true", ratio, ok)
+	}
+	if got := tokenizer.CountTokens(text); got != 3 {
+		t.Errorf("calibrated CountTokens() = %d, want 3", got)
+	}
+
+	// Averaged with the previous ratio, after clamping to maxTokenRatio.
+	c.expect(1000)
+	if ratio, _ := c.observe(10000); ratio != (1.5+maxTokenRatio)/2 {
+		t.Errorf("observe() ratio = %v, want %v", ratio, (1.5+maxTokenRatio)/2)
+	}
+
+	// No pending estimate.
+	if _, ok := c.observe(1000); ok {
+		t.Error("observe() without expect() should be skipped")
+	}
+}
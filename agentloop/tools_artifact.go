@@ -46,3 +46,11 @@ func (am *ArtifactManager) ListArtifacts() []Artifact {
 func (am *ArtifactManager) GetArtifacts() []Artifact {
 	return am.ListArtifacts()
 }
+
+// FromState restores the artifacts from state, replacing any existing ones.
+func (am *ArtifactManager) FromState(artifacts []Artifact) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.artifacts = append(make([]Artifact, 0, len(artifacts)), artifacts...)
+}
@@ -0,0 +1,69 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// pendingAnswerResult is the placeholder tool result of an ask_user call awaiting the answer.
+// It is replaced with the user's answer when the run is resumed.
+const pendingAnswerResult = "[awaiting user answer]"
+
+// PendingQuestion is a question asked via the ask_user tool that is awaiting the user's answer.
+type PendingQuestion struct {
+	ToolCallID string `json:"toolCallId"`
+	Question   string `json:"question"`
+}
+
+type AskUserArgs struct {
+	Question string `json:"question"`
+}
+
+// newAskUserTool creates the ask_user tool, which suspends the run until the caller resumes it
+// with the user's answer. See AgentConfig.EnableAskUserTool.
+func newAskUserTool() Tool {
+	return NewTypedCtxAwareToolFunc(
+		"ask_user",
+		"Ask the user a clarifying question and wait for the answer. Use it when the request is ambiguous or you need information only the user can provide. "+
+			"Ask one specific question at a time; the answer is returned as the tool result.",
+		map[string]*schema.ParameterInfo{
+			"question": StringParam("The question to ask the user", true),
+		},
+		func(ctx context.Context, agentCtx AgentContext, args AskUserArgs) (string, error) {
+			if args.Question == "" {
+				return "", errs.NewErrf("question cannot be empty")
+			}
+			s := suspensionFromCtx(ctx)
+			if s == nil {
+				return "", errs.NewErrf("ask_user is not available: the run cannot be suspended")
+			}
+			if !s.setQuestion(PendingQuestion{ToolCallID: compose.GetToolCallID(ctx), Question: args.Question}) {
+				return "", errs.NewErrf("another question is already pending, ask one question at a time")
+			}
+			return pendingAnswerResult, nil
+		},
+	)
+}
+
+// resolvePendingQuestion replaces the placeholder tool result of the pending ask_user call with the user's answer.
+func resolvePendingQuestion(msgs []*schema.Message, q *PendingQuestion, answer string) ([]*schema.Message, error) {
+	out := make([]*schema.Message, len(msgs))
+	found := false
+	for i, msg := range msgs {
+		out[i] = msg
+		if msg.Role == schema.Tool && msg.ToolCallID == q.ToolCallID {
+			cp := *msg
+			cp.Content = fmt.Sprintf("User answered: %s", answer)
+			out[i] = &cp
+			found = true
+		}
+	}
+	if !found {
+		return nil, errs.NewErrf("tool result of pending question %q not found in checkpoint", q.ToolCallID)
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package agentloop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestBuiltinTools_AskUser(t *testing.T) {
+	if _, ok := BuiltinTools().Get("ask_user"); ok {
+		t.Fatal("ask_user should not be registered by default")
+	}
+	tool, ok := BuiltinTools(WithEnableAskUserTool(true)).Get("ask_user")
+	if !ok {
+		t.Fatal("ask_user tool not found")
+	}
+
+	s := &suspension{}
+	ctx := context.WithValue(context.Background(), suspensionCtxKey, s)
+
+	result, err := tool.(SelfInvokeTool).ExecuteJson(ctx, `{"question":"Which region?"}`)
+	if err != nil {
+		t.Fatalf("ask_user error = %v", err)
+	}
+	if result != pendingAnswerResult {
+		t.Errorf("result = %q, want %q", result, pendingAnswerResult)
+	}
+	if s.stopReason() != StopReasonNeedsInput {
+		t.Errorf("stopReason() = %v, want %v", s.stopReason(), StopReasonNeedsInput)
+	}
+	if q := s.pendingQuestion(); q == nil || q.Question != "Which region?" {
+		t.Errorf("pendingQuestion() = %+v", q)
+	}
+
+	// Only one question at a time.
+	if _, err := tool.(SelfInvokeTool).ExecuteJson(ctx, `{"question":"And which year?"}`); err == nil {
+		t.Error("expected error for a second question in the same round")
+	}
+
+	// Without a suspension the tool cannot pause the run.
+	if _, err := tool.(SelfInvokeTool).ExecuteJson(context.Background(), `{"question":"?"}`); err == nil {
+		t.Error("expected error without a suspension in ctx")
+	}
+}
+
+func TestSuspension_StopReason(t *testing.T) {
+	s := &suspension{}
+	if s.suspended() || s.stopReason() != StopReasonCompleted {
+		t.Fatalf("empty suspension: suspended %v, stopReason %v", s.suspended(), s.stopReason())
+	}
+	s.setQuestion(PendingQuestion{ToolCallID: "c1", Question: "?"})
+	s.addApproval(PendingToolCall{ToolCallID: "c2", Name: "write_file"})
+	if got := s.stopReason(); got != StopReasonPendingApproval {
+		t.Errorf("stopReason() = %v, want approvals to take precedence", got)
+	}
+}
+
+func TestResolvePendingQuestion(t *testing.T) {
+	msgs := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("task"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{ID: "c1", Function: schema.FunctionCall{Name: "ask_user"}}}},
+		schema.ToolMessage(pendingAnswerResult, "c1"),
+	}
+	got, err := resolvePendingQuestion(msgs, &PendingQuestion{ToolCallID: "c1", Question: "Which region?"}, "EU")
+	if err != nil {
+		t.Fatalf("resolvePendingQuestion() error = %v", err)
+	}
+	if got[3].Content != "User answered: EU" {
+		t.Errorf("tool result = %q", got[3].Content)
+	}
+	if msgs[3].Content != pendingAnswerResult {
+		t.Error("resolvePendingQuestion mutated its input messages")
+	}
+
+	if _, err := resolvePendingQuestion(msgs, &PendingQuestion{ToolCallID: "c9"}, "EU"); err == nil {
+		t.Error("expected error for unknown tool call ID")
+	}
+}
@@ -71,6 +71,15 @@ type BuiltinToolsOption struct {
 	// EnableTodoTool enables the todo management tools: add_todo, update_todo, list_todos,
 	// delete_todo. Default: false.
 	EnableTodoTool bool
+
+	// EnableAskUserTool enables the ask_user tool, which suspends the run until the user answers
+	// a clarifying question. Default: false.
+	EnableAskUserTool bool
+
+	// EnableSkillTool enables the skill tools: activate_skill, which activates a skill
+	// explicitly, and load_skill, which returns a skill's instructions and bundled files.
+	// Default: false.
+	EnableSkillTool bool
 }
 
 // WithEnableFileTool enables or disables the built-in file tools (read_file, write_file,
@@ -89,6 +98,20 @@ func WithEnableTodoTool(v bool) func(o *BuiltinToolsOption) {
 	}
 }
 
+// WithEnableAskUserTool enables or disables the built-in ask_user tool.
+func WithEnableAskUserTool(v bool) func(o *BuiltinToolsOption) {
+	return func(o *BuiltinToolsOption) {
+		o.EnableAskUserTool = v
+	}
+}
+
+// WithEnableSkillTool enables or disables the built-in skill tools (activate_skill, load_skill).
+func WithEnableSkillTool(v bool) func(o *BuiltinToolsOption) {
+	return func(o *BuiltinToolsOption) {
+		o.EnableSkillTool = v
+	}
+}
+
 // BuiltinTools returns the built-in tools configured by the provided options.
 // By default (no options), no tools are registered; use WithEnableFileTool or
 // WithEnableTodoTool to opt in.
@@ -268,6 +291,15 @@ func BuiltinTools(ops ...func(o *BuiltinToolsOption)) *ToolRegistry {
 		))
 	} // end if o.EnableFileTool
 
+	if o.EnableAskUserTool {
+		registry.Register(newAskUserTool())
+	}
+
+	if o.EnableSkillTool {
+		registry.Register(newActivateSkillTool())
+		registry.Register(newLoadSkillTool())
+	}
+
 	if o.EnableTodoTool {
 		registry.Register(NewTypedCtxAwareToolFunc(
 			"add_todo",
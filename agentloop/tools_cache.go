@@ -0,0 +1,235 @@
+package agentloop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/middleware/redis"
+)
+
+// ToolCacheScope controls which tool calls share cached results.
+type ToolCacheScope string
+
+const (
+	// ToolCacheScopeSession shares results within one session (AgentContext.SessionId),
+	// including sub-agents run by [NewSubAgentTool], which inherit the session.
+	ToolCacheScopeSession ToolCacheScope = "session"
+
+	// ToolCacheScopeGlobal shares results across all sessions using the same ToolCacheStore.
+	ToolCacheScopeGlobal ToolCacheScope = "global"
+)
+
+// ToolCacheStore stores the results cached by [NewToolCacheMiddleware].
+type ToolCacheStore interface {
+	// Get returns the cached result of key. ok is false if there is none or it has expired.
+	Get(ctx context.Context, key string) (result string, ok bool, err error)
+
+	// Set caches result under key for ttl.
+	Set(ctx context.Context, key string, result string, ttl time.Duration) error
+}
+
+// ToolCacheOption configures [NewToolCacheMiddleware].
+type ToolCacheOption func(o *toolCacheConfig)
+
+type toolCacheConfig struct {
+	store ToolCacheStore
+	scope ToolCacheScope
+	ttl   time.Duration
+}
+
+// WithToolCacheStore sets the store of cached results. Default: a new [MemoryToolCacheStore].
+func WithToolCacheStore(s ToolCacheStore) ToolCacheOption {
+	return func(o *toolCacheConfig) {
+		o.store = s
+	}
+}
+
+// WithToolCacheScope sets the scope of cached results. Default: [ToolCacheScopeSession].
+func WithToolCacheScope(scope ToolCacheScope) ToolCacheOption {
+	return func(o *toolCacheConfig) {
+		o.scope = scope
+	}
+}
+
+// WithToolCacheTTL sets how long results are cached. Default: 10 minutes.
+func WithToolCacheTTL(ttl time.Duration) ToolCacheOption {
+	return func(o *toolCacheConfig) {
+		o.ttl = ttl
+	}
+}
+
+// toolCacheMiddleware returns cached results for repeated calls of the configured tools.
+type toolCacheMiddleware struct {
+	BaseMiddleware
+	tools map[string]bool
+	conf  toolCacheConfig
+}
+
+// NewToolCacheMiddleware returns a middleware that caches the results of the named tools, keyed
+// by tool name and arguments. Arguments are canonicalized first, so calls that differ only in the
+// order of JSON keys or in whitespace share a result. Error results are not cached, nor are the
+// placeholders of calls that suspend the run (awaiting approval or the user's answer).
+//
+// Middlewares run in the order they are added, so add this middleware after
+// [NewToolApprovalMiddleware]: calls are then approved before a cached result is returned, and
+// the cache only sees approved calls.
+//
+// Only cache tools without side effects whose results do not change within the TTL, e.g. web
+// search or knowledge base retrieval. To share results with sub-agents, add the same middleware
+// instance to the sub-agents, or use a shared store such as [NewRedisToolCacheStore].
+//
+// Example:
+//
+//	cache := agentloop.NewToolCacheMiddleware([]string{"tavily_search", "dify_retrieval"},
+//	    agentloop.WithToolCacheTTL(30*time.Minute))
+func NewToolCacheMiddleware(tools []string, opts ...ToolCacheOption) Middleware {
+	conf := toolCacheConfig{scope: ToolCacheScopeSession, ttl: 10 * time.Minute}
+	for _, o := range opts {
+		o(&conf)
+	}
+	if conf.store == nil {
+		conf.store = NewMemoryToolCacheStore()
+	}
+	m := &toolCacheMiddleware{tools: make(map[string]bool, len(tools)), conf: conf}
+	for _, t := range tools {
+		m.tools[t] = true
+	}
+	return m
+}
+
+func (m *toolCacheMiddleware) Name() string { return "tool_cache" }
+
+func (m *toolCacheMiddleware) WrapToolCall(ctx context.Context, req *ToolCallRequest, next ToolCallHandler) (*ToolCallResponse, error) {
+	if !m.tools[req.Name] {
+		return next(ctx, req)
+	}
+	rail := flow.NewRail(ctx)
+	key, err := m.cacheKey(ctx, req)
+	if err != nil {
+		rail.Warnf("[tool_cache] failed to build cache key of tool %v, %v", req.Name, err)
+		return next(ctx, req)
+	}
+	if result, ok, err := m.conf.store.Get(ctx, key); err != nil {
+		rail.Warnf("[tool_cache] failed to read cached result of tool %v, %v", req.Name, err)
+	} else if ok {
+		rail.Infof("[tool_cache] Cache hit, tool: %v, args: %v", req.Name, req.RawInput)
+		return &ToolCallResponse{Result: result}, nil
+	}
+
+	resp, err := next(ctx, req)
+	if err != nil || resp == nil || resp.IsError || isPendingResult(resp.Result) {
+		return resp, err
+	}
+	if err := m.conf.store.Set(ctx, key, resp.Result, m.conf.ttl); err != nil {
+		rail.Warnf("[tool_cache] failed to cache result of tool %v, %v", req.Name, err)
+	}
+	return resp, nil
+}
+
+// cacheKey returns the key of a call: scope, tool name and a hash of the canonicalized args.
+func (m *toolCacheMiddleware) cacheKey(ctx context.Context, req *ToolCallRequest) (string, error) {
+	args := req.Args
+	if args == nil && req.RawInput != "" {
+		if err := json.Unmarshal([]byte(req.RawInput), &args); err != nil {
+			return "", errs.Wrapf(err, "failed to parse tool args")
+		}
+	}
+	// encoding/json writes map keys in sorted order, which makes the encoding canonical.
+	buf, err := json.Marshal(args)
+	if err != nil {
+		return "", errs.Wrapf(err, "failed to marshal tool args")
+	}
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+
+	if m.conf.scope == ToolCacheScopeGlobal {
+		return fmt.Sprintf("global:%v:%v", req.Name, hash), nil
+	}
+	agentCtx, _ := ctx.Value(agentCtxKey).(AgentContext)
+	return fmt.Sprintf("session:%v:%v:%v", agentCtx.SessionId, req.Name, hash), nil
+}
+
+// MemoryToolCacheStore is an in-process ToolCacheStore. Expired entries are removed lazily.
+type MemoryToolCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryToolCacheEntry
+	sets    int
+}
+
+type memoryToolCacheEntry struct {
+	result    string
+	expiresAt time.Time // zero means no expiration
+}
+
+func (e memoryToolCacheEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// NewMemoryToolCacheStore creates an empty MemoryToolCacheStore.
+func NewMemoryToolCacheStore() *MemoryToolCacheStore {
+	return &MemoryToolCacheStore{entries: map[string]memoryToolCacheEntry{}}
+}
+
+func (s *MemoryToolCacheStore) Get(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	if e.expired(time.Now()) {
+		delete(s.entries, key)
+		return "", false, nil
+	}
+	return e.result, true, nil
+}
+
+// Set caches result under key; a ttl of 0 means no expiration.
+func (s *MemoryToolCacheStore) Set(_ context.Context, key string, result string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e := memoryToolCacheEntry{result: result}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	s.entries[key] = e
+
+	// Sweep expired entries now and then so results that are never read again do not pile up.
+	s.sets++
+	if s.sets%256 == 0 {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+// RedisToolCacheStore is a ToolCacheStore backed by Redis, shared by all processes using it.
+// Redis must be initialized via miso's redis middleware before use.
+type RedisToolCacheStore struct {
+	keyPat string
+}
+
+// NewRedisToolCacheStore creates a RedisToolCacheStore.
+func NewRedisToolCacheStore() *RedisToolCacheStore {
+	return &RedisToolCacheStore{keyPat: "miso-agent:agentloop:tool-cache:%v"}
+}
+
+func (s *RedisToolCacheStore) Get(ctx context.Context, key string) (string, bool, error) {
+	return redis.Get(flow.NewRail(ctx), fmt.Sprintf(s.keyPat, key))
+}
+
+// Set caches result under key; a ttl of 0 means no expiration.
+func (s *RedisToolCacheStore) Set(ctx context.Context, key string, result string, ttl time.Duration) error {
+	return redis.Set(flow.NewRail(ctx), fmt.Sprintf(s.keyPat, key), result, ttl)
+}
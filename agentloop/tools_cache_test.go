@@ -0,0 +1,83 @@
+package agentloop
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestToolCacheMiddleware(t *testing.T) {
+	calls := 0
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		calls++
+		if req.Args["query"] == "bad" {
+			return &ToolCallResponse{Result: "Error: bad query", IsError: true}, nil
+		}
+		if req.Args["query"] == "pending" {
+			return &ToolCallResponse{Result: pendingApprovalResult}, nil
+		}
+		return &ToolCallResponse{Result: "results of " + req.Args["query"].(string)}, nil
+	}
+	call := func(m Middleware, session, tool string, args map[string]any) string {
+		ctx := context.WithValue(context.Background(), agentCtxKey, AgentContext{SessionId: session})
+		resp, err := m.WrapToolCall(ctx, &ToolCallRequest{Name: tool, Args: args}, next)
+		if err != nil {
+			t.Fatalf("WrapToolCall() error = %v", err)
+		}
+		return resp.Result
+	}
+
+	t.Run("session scope", func(t *testing.T) {
+		calls = 0
+		m := NewToolCacheMiddleware([]string{"search"})
+		call(m, "s1", "search", map[string]any{"query": "go", "limit": 5})
+		if got := call(m, "s1", "search", map[string]any{"limit": 5, "query": "go"}); got != "results of go" || calls != 1 {
+			t.Errorf("identical call: result %q after %d calls, want a cache hit", got, calls)
+		}
+		call(m, "s2", "search", map[string]any{"query": "go", "limit": 5})
+		if calls != 2 {
+			t.Errorf("other session: %d calls, want 2", calls)
+		}
+		call(m, "s1", "fetch", map[string]any{"query": "go"})
+		call(m, "s1", "fetch", map[string]any{"query": "go"})
+		if calls != 4 {
+			t.Errorf("uncached tool: %d calls, want 4", calls)
+		}
+		call(m, "s1", "search", map[string]any{"query": "bad"})
+		call(m, "s1", "search", map[string]any{"query": "bad"})
+		if calls != 6 {
+			t.Errorf("error results should not be cached: %d calls, want 6", calls)
+		}
+	})
+
+	t.Run("pending results", func(t *testing.T) {
+		calls = 0
+		m := NewToolCacheMiddleware([]string{"search"})
+		call(m, "s1", "search", map[string]any{"query": "pending"})
+		call(m, "s1", "search", map[string]any{"query": "pending"})
+		if calls != 2 {
+			t.Errorf("pending placeholders should not be cached: %d calls, want 2", calls)
+		}
+	})
+
+	t.Run("global scope", func(t *testing.T) {
+		calls = 0
+		m := NewToolCacheMiddleware([]string{"search"}, WithToolCacheScope(ToolCacheScopeGlobal))
+		call(m, "s1", "search", map[string]any{"query": "go"})
+		call(m, "s2", "search", map[string]any{"query": "go"})
+		if calls != 1 {
+			t.Errorf("%d calls, want 1", calls)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		calls = 0
+		m := NewToolCacheMiddleware([]string{"search"}, WithToolCacheTTL(time.Millisecond))
+		call(m, "s1", "search", map[string]any{"query": "go"})
+		time.Sleep(5 * time.Millisecond)
+		call(m, "s1", "search", map[string]any{"query": "go"})
+		if calls != 2 {
+			t.Errorf("%d calls, want 2 after the result expired", calls)
+		}
+	})
+}
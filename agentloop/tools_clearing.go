@@ -0,0 +1,87 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// clearedToolResultPrefix starts the stub replacing a tool result cleared by clearStaleToolResults.
+const clearedToolResultPrefix = "[result cleared"
+
+// clearStaleToolResults replaces the content of stale tool results in msgs with a short stub.
+//
+// A tool result is stale when more than keepRounds newer rounds (assistant messages with tool
+// calls) follow its own round, or when the newer tool results and itself exceed keepTokens.
+// A zero keepRounds or keepTokens disables the respective condition. The results of the latest
+// round are never stale, like in pruneMessages, so the model always sees the results it just asked
+// for even if they exceed keepTokens on their own.
+//
+// Unless the tool is in offloadExcludedTools, the full result is saved to the store like an
+// offloaded result, so the stub points to a path the model can read. Results that were offloaded
+// already point to the existing file. If store is nil, results are cleared without being saved.
+// msgs is not modified.
+func clearStaleToolResults(ctx context.Context, msgs []*schema.Message, store FileStore, tokenizer Tokenizer, keepRounds int, keepTokens int, pathPrefix string) []*schema.Message {
+	if keepRounds <= 0 && keepTokens <= 0 {
+		return msgs
+	}
+	if pathPrefix == "" {
+		pathPrefix = defaultLargeToolResultsPathPrefix
+	}
+
+	callIDToName := make(map[string]string)
+	for _, msg := range msgs {
+		for _, tc := range msg.ToolCalls {
+			callIDToName[tc.ID] = tc.Function.Name
+		}
+	}
+
+	var out []*schema.Message
+	rounds, recentTokens := 0, 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		if msg.Role == schema.Assistant && len(msg.ToolCalls) > 0 {
+			rounds++
+			continue
+		}
+		if msg.Role != schema.Tool || strings.HasPrefix(msg.Content, clearedToolResultPrefix) {
+			continue
+		}
+		// Tool results precede the next assistant message, so they belong to round rounds+1.
+		recentTokens += tokenizer.CountMessageTokens(msg)
+		stale := rounds > 0 && ((keepRounds > 0 && rounds+1 > keepRounds) || (keepTokens > 0 && recentTokens > keepTokens))
+		if !stale {
+			continue
+		}
+		if out == nil {
+			out = make([]*schema.Message, len(msgs))
+			copy(out, msgs)
+		}
+		cp := *msg
+		cp.Content = clearedToolResultStub(ctx, msg, callIDToName[msg.ToolCallID], store, pathPrefix)
+		out[i] = &cp
+	}
+	if out == nil {
+		return msgs
+	}
+	return out
+}
+
+// clearedToolResultStub returns the stub replacing the tool result msg, saving its content first if needed.
+func clearedToolResultStub(ctx context.Context, msg *schema.Message, toolName string, store FileStore, pathPrefix string) string {
+	if p, ok := strings.CutPrefix(msg.Content, offloadedToolResultPrefix); ok {
+		if end := strings.IndexByte(p, '\n'); end > 0 {
+			return fmt.Sprintf("%s, saved at %s]", clearedToolResultPrefix, p[:end])
+		}
+	}
+	if store == nil || msg.ToolCallID == "" || offloadExcludedTools[toolName] {
+		return clearedToolResultPrefix + "]"
+	}
+	filePath, ok := saveToolResult(ctx, msg, store, pathPrefix)
+	if !ok {
+		return clearedToolResultPrefix + "]"
+	}
+	return fmt.Sprintf("%s, saved at %s]", clearedToolResultPrefix, filePath)
+}
@@ -0,0 +1,77 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestClearStaleToolResults(t *testing.T) {
+	tokenizer := NewTokenizer()
+	big := strings.Repeat("result ", 100)
+	msgs := []*schema.Message{
+		schema.SystemMessage("system"),
+		schema.UserMessage("task"),
+		toolCallMsg("call_1", "web_search", `{}`),
+		schema.ToolMessage(big, "call_1"),
+		toolCallMsg("call_2", "read_file", `{"path":"/input/a.txt"}`),
+		schema.ToolMessage(big, "call_2"),
+		toolCallMsg("call_3", "web_fetch", `{}`),
+		schema.ToolMessage(offloadedToolResultPrefix+"/prefix/call_3\n\npreview", "call_3"),
+		toolCallMsg("call_4", "web_search", `{}`),
+		schema.ToolMessage(big, "call_4"),
+	}
+
+	t.Run("disabled → passthrough", func(t *testing.T) {
+		out := clearStaleToolResults(context.Background(), msgs, newMockFileStore(), tokenizer, 0, 0, "/prefix")
+		if &out[0] != &msgs[0] {
+			t.Error("expected the original slice when clearing is disabled")
+		}
+	})
+
+	t.Run("older than keepRounds → cleared", func(t *testing.T) {
+		store := newMockFileStore()
+		out := clearStaleToolResults(context.Background(), msgs, store, tokenizer, 1, 0, "/prefix")
+		want := map[int]string{
+			3: "[result cleared, saved at /prefix/call_1]",
+			5: "[result cleared]", // read_file results are not saved
+			7: "[result cleared, saved at /prefix/call_3]",
+			9: big,
+		}
+		for i, content := range want {
+			if out[i].Content != content {
+				t.Errorf("message %d = %q, want %q", i, out[i].Content, content)
+			}
+		}
+		if string(store.files["/prefix/call_1"]) != big || len(store.files) != 1 {
+			t.Errorf("store = %v, want only call_1 saved", store.files)
+		}
+		if msgs[3].Content != big {
+			t.Error("input messages must not be modified")
+		}
+
+		again := clearStaleToolResults(context.Background(), out, store, tokenizer, 1, 0, "/prefix")
+		if &again[0] != &out[0] {
+			t.Error("cleared results should not be cleared again")
+		}
+	})
+
+	t.Run("beyond keepTokens → cleared", func(t *testing.T) {
+		out := clearStaleToolResults(context.Background(), msgs, nil, tokenizer, 0, tokenizer.CountMessageTokens(msgs[9])+1, "/prefix")
+		if out[9].Content != big || out[7].Content == msgs[7].Content || out[3].Content != "[result cleared]" {
+			t.Errorf("want all but the latest result cleared, got %q, %q, %q", out[3].Content, out[7].Content, out[9].Content)
+		}
+	})
+
+	t.Run("latest round beyond keepTokens → kept", func(t *testing.T) {
+		out := clearStaleToolResults(context.Background(), msgs, nil, tokenizer, 0, tokenizer.CountMessageTokens(msgs[9])/2, "/prefix")
+		if out[9].Content != big {
+			t.Errorf("latest result = %q, want it kept", out[9].Content)
+		}
+		if out[5].Content != "[result cleared]" {
+			t.Errorf("older result = %q, want it cleared", out[5].Content)
+		}
+	})
+}
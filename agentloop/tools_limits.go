@@ -0,0 +1,141 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// toolCallLimiter enforces AgentConfig.MaxParallelToolCalls and MaxToolCallsPerTurn for one execution.
+type toolCallLimiter struct {
+	sem        chan struct{} // nil when parallelism is unlimited
+	maxPerTurn int           // 0 = unlimited
+
+	mu      sync.Mutex
+	skipped map[string]bool // tool call IDs of the current round beyond maxPerTurn
+}
+
+func newToolCallLimiter(maxParallel, maxPerTurn int) *toolCallLimiter {
+	l := &toolCallLimiter{maxPerTurn: maxPerTurn}
+	if maxParallel > 0 {
+		l.sem = make(chan struct{}, maxParallel)
+	}
+	return l
+}
+
+// startTurn is called before each tools node run with the tool calls of the round.
+// Calls beyond maxPerTurn, in the order the model made them, are marked as skipped.
+func (l *toolCallLimiter) startTurn(calls []schema.ToolCall) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.skipped = nil
+	if l.maxPerTurn <= 0 || len(calls) <= l.maxPerTurn {
+		return
+	}
+	l.skipped = make(map[string]bool, len(calls)-l.maxPerTurn)
+	for _, c := range calls[l.maxPerTurn:] {
+		l.skipped[c.ID] = true
+	}
+}
+
+func (l *toolCallLimiter) isSkipped(callID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.skipped[callID]
+}
+
+// acquire blocks until a parallel slot is free or ctx is done.
+func (l *toolCallLimiter) acquire(ctx context.Context) error {
+	if l.sem == nil {
+		return nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *toolCallLimiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// toolCallLimiterFromCtx returns the toolCallLimiter of the current execution, or nil.
+func toolCallLimiterFromCtx(ctx context.Context) *toolCallLimiter {
+	if v, ok := ctx.Value(toolLimiterCtxKey).(*toolCallLimiter); ok {
+		return v
+	}
+	return nil
+}
+
+// toolTimeout returns the timeout of the named tool: its ToolTimeouts entry, else ToolTimeout.
+func (c *AgentConfig) toolTimeout(name string) time.Duration {
+	if d, ok := c.ToolTimeouts[name]; ok {
+		return d
+	}
+	return c.ToolTimeout
+}
+
+// buildToolLimitMiddleware returns the tools node middleware that applies the per-turn cap,
+// the parallelism limit and the per-tool timeouts. The timeout is set as the ctx deadline
+// (exposed to middleware via ToolCallRequest.Deadline); a tool that ignores ctx is abandoned
+// once the deadline passes and the model is told it timed out. An abandoned tool keeps its
+// parallel slot until it actually returns, so MaxParallelToolCalls bounds the running tools.
+func buildToolLimitMiddleware(config *AgentConfig) compose.InvokableToolMiddleware {
+	return func(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+		return func(ctx context.Context, input *compose.ToolInput) (*compose.ToolOutput, error) {
+			release := func() {}
+			if l := toolCallLimiterFromCtx(ctx); l != nil {
+				if l.isSkipped(input.CallID) {
+					return &compose.ToolOutput{Result: fmt.Sprintf(
+						"Error: tool call skipped, at most %d tool calls are executed per turn. Call it again in the next turn if still needed.", l.maxPerTurn)}, nil
+				}
+				if err := l.acquire(ctx); err != nil {
+					return nil, err
+				}
+				release = l.release
+			}
+
+			timeout := config.toolTimeout(input.Name)
+			if timeout <= 0 {
+				defer release()
+				return next(ctx, input)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			type result struct {
+				out *compose.ToolOutput
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer release()
+				defer func() {
+					if v := recover(); v != nil {
+						done <- result{err: errs.NewErrf("tool %q panicked: %v", input.Name, v)}
+					}
+				}()
+				out, err := next(ctx, input)
+				done <- result{out: out, err: err}
+			}()
+			select {
+			case r := <-done:
+				return r.out, r.err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return &compose.ToolOutput{Result: fmt.Sprintf("Error: tool %q timed out after %v", input.Name, timeout)}, nil
+				}
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
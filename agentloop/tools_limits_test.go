@@ -0,0 +1,140 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestToolLimitMiddleware_PerTurnCap(t *testing.T) {
+	l := newToolCallLimiter(0, 2)
+	l.startTurn([]schema.ToolCall{{ID: "c1"}, {ID: "c2"}, {ID: "c3"}})
+	ctx := context.WithValue(context.Background(), toolLimiterCtxKey, l)
+
+	var ran []string
+	endpoint := buildToolLimitMiddleware(&AgentConfig{})(func(_ context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		ran = append(ran, in.CallID)
+		return &compose.ToolOutput{Result: "ok"}, nil
+	})
+	for _, id := range []string{"c1", "c2", "c3"} {
+		out, err := endpoint(ctx, &compose.ToolInput{Name: "glob", CallID: id})
+		if err != nil {
+			t.Fatalf("%s: error = %v", id, err)
+		}
+		if id == "c3" && !strings.Contains(out.Result, "skipped") {
+			t.Errorf("c3 result = %q, want skipped", out.Result)
+		}
+	}
+	if strings.Join(ran, ",") != "c1,c2" {
+		t.Errorf("ran = %v, want [c1 c2]", ran)
+	}
+
+	// The cap applies per turn.
+	l.startTurn([]schema.ToolCall{{ID: "c3"}})
+	if l.isSkipped("c3") {
+		t.Error("c3 should not be skipped in a new turn")
+	}
+}
+
+func TestToolLimitMiddleware_MaxParallel(t *testing.T) {
+	l := newToolCallLimiter(2, 0)
+	ctx := context.WithValue(context.Background(), toolLimiterCtxKey, l)
+
+	var running, peak int32
+	endpoint := buildToolLimitMiddleware(&AgentConfig{})(func(_ context.Context, _ *compose.ToolInput) (*compose.ToolOutput, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &compose.ToolOutput{Result: "ok"}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = endpoint(ctx, &compose.ToolInput{Name: "search"})
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak)
+	}
+}
+
+func TestToolLimitMiddleware_Timeout(t *testing.T) {
+	config := &AgentConfig{
+		ToolTimeout:  time.Second,
+		ToolTimeouts: map[string]time.Duration{"slow_search": 20 * time.Millisecond},
+	}
+	deadlines := make(chan time.Time, 1)
+	endpoint := buildToolLimitMiddleware(config)(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		if in.Name == "slow_search" {
+			time.Sleep(200 * time.Millisecond) // ignores ctx
+			return &compose.ToolOutput{Result: "ok"}, nil
+		}
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		return &compose.ToolOutput{Result: "ok"}, nil
+	})
+
+	start := time.Now()
+	out, err := endpoint(context.Background(), &compose.ToolInput{Name: "slow_search"})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if !strings.Contains(out.Result, "timed out") {
+		t.Errorf("result = %q, want timeout", out.Result)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("timed-out call took %v, should be abandoned at the deadline", elapsed)
+	}
+
+	out, err = endpoint(context.Background(), &compose.ToolInput{Name: "glob"})
+	if err != nil || out.Result != "ok" {
+		t.Fatalf("glob: out %+v, err %v", out, err)
+	}
+	if deadline := <-deadlines; deadline.IsZero() || time.Until(deadline) > time.Second {
+		t.Errorf("deadline = %v, want ~1s from now via ToolTimeout", deadline)
+	}
+}
+
+func TestToolLimitMiddleware_TimedOutToolHoldsSlot(t *testing.T) {
+	config := &AgentConfig{ToolTimeout: 20 * time.Millisecond}
+	ctx := context.WithValue(context.Background(), toolLimiterCtxKey, newToolCallLimiter(1, 0))
+	finished := make(chan struct{})
+	endpoint := buildToolLimitMiddleware(config)(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		if in.Name == "slow_search" {
+			time.Sleep(100 * time.Millisecond) // ignores ctx
+			close(finished)
+		}
+		return &compose.ToolOutput{Result: "ok"}, nil
+	})
+
+	out, err := endpoint(ctx, &compose.ToolInput{Name: "slow_search"})
+	if err != nil || !strings.Contains(out.Result, "timed out") {
+		t.Fatalf("slow_search: out %+v, err %v, want timeout", out, err)
+	}
+
+	// The only slot is held by the abandoned call until it returns.
+	if _, err := endpoint(ctx, &compose.ToolInput{Name: "glob"}); err != nil {
+		t.Fatalf("glob: error = %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("glob ran while the timed-out call still held the only parallel slot")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
 
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 
 	"github.com/curtisnewbie/miso/flow"
@@ -14,6 +16,10 @@ const (
 	defaultLargeToolResultsPathPrefix = "/large_tool_results"
 	offloadPreviewHeadChars           = 2000
 	offloadPreviewTailChars           = 1000
+	offloadSummaryInputChars          = 100000 // head of the content passed to the summary model
+
+	// offloadedToolResultPrefix starts the content of an offloaded tool result, followed by the path.
+	offloadedToolResultPrefix = "Tool result was too large and has been saved to: "
 )
 
 // offloadExcludedTools is the static set of tool names whose results are never
@@ -36,25 +42,41 @@ func sanitizeForPath(s string) string {
 	return invalidPathCharsRe.ReplaceAllString(s, "_")
 }
 
-// buildPreview returns a head+tail preview of text with an omission separator.
-// If text fits within the combined head+tail budget, it is returned as-is.
+// buildPreview returns a preview of text. If text fits within the combined head+tail budget, it
+// is returned as-is. JSON, CSV and Markdown are described by their shape, rows or outline (see
+// buildStructuredPreview), anything else by a head+tail preview with an omission separator.
 func buildPreview(text string) string {
 	runes := []rune(text)
 	if len(runes) <= offloadPreviewHeadChars+offloadPreviewTailChars {
 		return text
 	}
+	if p, ok := buildStructuredPreview(text); ok {
+		return p
+	}
 	head := string(runes[:offloadPreviewHeadChars])
 	tail := string(runes[len(runes)-offloadPreviewTailChars:])
 	omitted := len(runes) - offloadPreviewHeadChars - offloadPreviewTailChars
 	return fmt.Sprintf("%s\n\n[... %d characters omitted ...]\n\n%s", head, omitted, tail)
 }
 
+// saveToolResult writes the content of the tool result msg to {pathPrefix}/{sanitized_tool_call_id}
+// in store and returns the path. On write failure it logs the error and returns false.
+func saveToolResult(ctx context.Context, msg *schema.Message, store FileStore, pathPrefix string) (string, bool) {
+	filePath := pathPrefix + "/" + sanitizeForPath(msg.ToolCallID)
+	if err := store.WriteFile(ctx, filePath, []byte(msg.Content)); err != nil {
+		flow.NewRail(ctx).Errorf("offload tool result (non-fatal): failed to write %s: %v", filePath, err)
+		return "", false
+	}
+	return filePath, true
+}
+
 // maybeOffloadToolResult checks whether the tool result message content exceeds
 // tokenLimit tokens and, if so, writes it to store and returns a replacement
 // message with a preview and a file pointer. Non-tool messages and excluded tools
 // are returned unchanged. On write failure the original message is returned
-// (best-effort, non-fatal).
-func maybeOffloadToolResult(ctx context.Context, msg *schema.Message, toolName string, store FileStore, tokenizer Tokenizer, tokenLimit int, pathPrefix string) *schema.Message {
+// (best-effort, non-fatal). If summaryModel is not nil, the replacement message also
+// includes a summary of the content written by summaryModel.
+func maybeOffloadToolResult(ctx context.Context, msg *schema.Message, toolName string, store FileStore, tokenizer Tokenizer, tokenLimit int, pathPrefix string, summaryModel model.BaseChatModel) *schema.Message {
 	if msg.Role != schema.Tool {
 		return msg
 	}
@@ -68,18 +90,28 @@ func maybeOffloadToolResult(ctx context.Context, msg *schema.Message, toolName s
 		return msg
 	}
 
-	filePath := pathPrefix + "/" + sanitizeForPath(msg.ToolCallID)
-
-	if err := store.WriteFile(ctx, filePath, []byte(msg.Content)); err != nil {
-		flow.NewRail(ctx).Errorf("offload tool result (non-fatal): failed to write %s: %v", filePath, err)
+	filePath, ok := saveToolResult(ctx, msg, store, pathPrefix)
+	if !ok {
 		return msg
 	}
 
+	var summary string
+	if summaryModel != nil {
+		var err error
+		if summary, err = summarizeToolResult(ctx, summaryModel, toolName, msg.Content); err != nil {
+			flow.NewRail(ctx).Warnf("offload tool result (non-fatal): failed to summarize %s: %v", filePath, err)
+		}
+	}
+
 	preview := buildPreview(msg.Content)
 	replacement := fmt.Sprintf(
-		"Tool result was too large and has been saved to: %s\n\nUse the file-read tool on that path to retrieve the full content (supports pagination).\n\nPreview (head and tail):\n\n%s",
-		filePath, preview,
+		offloadedToolResultPrefix+"%s\n\nUse the file-read tool on that path to retrieve the full content (supports pagination).\n\n",
+		filePath,
 	)
+	if summary != "" {
+		replacement += "Summary:\n\n" + summary + "\n\n"
+	}
+	replacement += "Preview:\n\n" + preview
 
 	out := *msg
 	out.Content = replacement
@@ -90,7 +122,7 @@ func maybeOffloadToolResult(ctx context.Context, msg *schema.Message, toolName s
 // accumulated is the current state.messages slice (before the new msgs are appended).
 // The most recent assistant message in accumulated provides the callID→toolName mapping.
 // Returns the (possibly replaced) messages. Safe to call on non-tool messages (they pass through).
-func offloadToolResults(ctx context.Context, msgs []*schema.Message, accumulated []*schema.Message, store FileStore, tokenizer Tokenizer, tokenLimit int, pathPrefix string) []*schema.Message {
+func offloadToolResults(ctx context.Context, msgs []*schema.Message, accumulated []*schema.Message, store FileStore, tokenizer Tokenizer, tokenLimit int, pathPrefix string, summaryModel model.BaseChatModel) []*schema.Message {
 	if tokenLimit <= 0 || store == nil {
 		return msgs
 	}
@@ -112,7 +144,23 @@ func offloadToolResults(ctx context.Context, msgs []*schema.Message, accumulated
 
 	out := make([]*schema.Message, len(msgs))
 	for i, msg := range msgs {
-		out[i] = maybeOffloadToolResult(ctx, msg, callIDToName[msg.ToolCallID], store, tokenizer, tokenLimit, pathPrefix)
+		out[i] = maybeOffloadToolResult(ctx, msg, callIDToName[msg.ToolCallID], store, tokenizer, tokenLimit, pathPrefix, summaryModel)
 	}
 	return out
 }
+
+// summarizeToolResult asks m for a short summary of the tool result content.
+func summarizeToolResult(ctx context.Context, m model.BaseChatModel, toolName string, content string) (string, error) {
+	prompt := fmt.Sprintf(
+		"<tool-result tool=%q>\n%s\n</tool-result>\n\n"+
+			"The tool result above is too large to be shown in full. Summarize it in at most 200 words for the agent "+
+			"that called the tool: what it contains, the key facts, identifiers and numbers, and what is worth reading in full. "+
+			"Reply with the summary only.",
+		toolName, headOf(content, offloadSummaryInputChars),
+	)
+	resp, err := m.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
@@ -0,0 +1,199 @@
+package agentloop
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/curtisnewbie/miso/util/strutil"
+)
+
+const (
+	structuredPreviewHeadChars = 1000 // head included after the shape, CSV rows or Markdown outline
+	jsonShapeMaxDepth          = 4
+	jsonShapeMaxKeys           = 30
+	csvPreviewRows             = 5
+	markdownOutlineMaxHeadings = 50
+)
+
+// buildStructuredPreview returns a format-aware preview of text if it is JSON, CSV or Markdown.
+func buildStructuredPreview(text string) (string, bool) {
+	if p, ok := buildJSONPreview(text); ok {
+		return p, true
+	}
+	if p, ok := buildCSVPreview(text); ok {
+		return p, true
+	}
+	return buildMarkdownPreview(text)
+}
+
+// headOf returns the first n runes of text, noting how many were omitted.
+func headOf(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return fmt.Sprintf("%s\n\n[... %d characters omitted ...]", string(runes[:n]), len(runes)-n)
+}
+
+// buildJSONPreview describes the shape of a JSON document: the keys of objects and the lengths
+// of arrays, followed by its head.
+func buildJSONPreview(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return "", false
+	}
+	var shape strings.Builder
+	writeJSONShape(&shape, v, "", 0)
+
+	sb := strutil.NewBuilder()
+	sb.Printlnf("Format: JSON, %d characters", len([]rune(text)))
+	sb.Println("Shape:")
+	sb.Println(headOf(shape.String(), offloadPreviewHeadChars))
+	sb.Println("")
+	sb.Println("Head:")
+	sb.WriteString(headOf(trimmed, structuredPreviewHeadChars))
+	return sb.String(), true
+}
+
+// writeJSONShape writes the shape of v. Arrays are described by their length and the shape of
+// their first item.
+func writeJSONShape(sb *strings.Builder, v any, indent string, depth int) {
+	switch v := v.(type) {
+	case map[string]any:
+		fmt.Fprintf(sb, "object with %d keys", len(v))
+		if depth >= jsonShapeMaxDepth {
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for i, k := range keys {
+			if i == jsonShapeMaxKeys {
+				fmt.Fprintf(sb, "\n%s  ... %d more keys", indent, len(keys)-i)
+				break
+			}
+			fmt.Fprintf(sb, "\n%s  %s: ", indent, k)
+			writeJSONShape(sb, v[k], indent+"  ", depth+1)
+		}
+	case []any:
+		fmt.Fprintf(sb, "array of %d items", len(v))
+		if len(v) > 0 && depth < jsonShapeMaxDepth {
+			sb.WriteString(", first item: ")
+			writeJSONShape(sb, v[0], indent, depth+1)
+		}
+	case string:
+		sb.WriteString("string")
+	case float64:
+		sb.WriteString("number")
+	case bool:
+		sb.WriteString("boolean")
+	default:
+		sb.WriteString("null")
+	}
+}
+
+// buildCSVPreview describes a CSV (or TSV) document by its header, row count and first rows.
+func buildCSVPreview(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	firstLine, _, multiline := strings.Cut(trimmed, "\n")
+	if !multiline {
+		return "", false
+	}
+	r := csv.NewReader(strings.NewReader(trimmed))
+	if strings.Contains(firstLine, "\t") && !strings.Contains(firstLine, ",") {
+		r.Comma = '\t'
+	} else if !strings.Contains(firstLine, ",") {
+		return "", false
+	}
+	records, err := r.ReadAll()
+	if err != nil || len(records) < 2 || len(records[0]) < 2 {
+		return "", false
+	}
+
+	var rows strings.Builder
+	w := csv.NewWriter(&rows)
+	w.Comma = r.Comma
+	w.WriteAll(records[1:min(len(records), csvPreviewRows+1)])
+
+	sb := strutil.NewBuilder()
+	sb.Printlnf("Format: CSV, %d rows (excluding the header), %d columns", len(records)-1, len(records[0]))
+	sb.Printlnf("Header: %s", strings.Join(records[0], ", "))
+	sb.Println("")
+	sb.Printlnf("First %d rows:", min(len(records)-1, csvPreviewRows))
+	sb.WriteString(headOf(strings.TrimRight(rows.String(), "\n"), offloadPreviewHeadChars))
+	return sb.String(), true
+}
+
+var (
+	markdownLinkRe     = regexp.MustCompile(`(^|[^\w\])])\[[^\]]+\]\([^)\s]+\)`) // not an index expression like a[i](x)
+	markdownStrongRe   = regexp.MustCompile(`(^|\W)\*\*[^*\s]([^*]*[^*\s])?\*\*(\W|$)`)
+	markdownTableSepRe = regexp.MustCompile(`^\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)+\|?\s*$`)
+)
+
+// hasMarkdownSyntax reports whether line, outside a fenced code block, uses Markdown syntax
+// other than a heading: a link, strong emphasis or a table separator row.
+func hasMarkdownSyntax(line string) bool {
+	return markdownLinkRe.MatchString(line) || markdownStrongRe.MatchString(line) || markdownTableSepRe.MatchString(line)
+}
+
+// buildMarkdownPreview describes a Markdown document by its heading outline, followed by its head.
+//
+// Lines starting with "# " are also comments in shell, Python or YAML, so text is only taken for
+// Markdown if it has at least two headings and another Markdown signal: a fenced code block, a
+// link, strong emphasis or a table. Other text is previewed by its head and tail.
+func buildMarkdownPreview(text string) (string, bool) {
+	var outline []string
+	headings := 0
+	inFence, signal := false, false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+			signal = true
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			signal = signal || hasMarkdownSyntax(line)
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		title, ok := strings.CutPrefix(line[level:], " ")
+		if level > 6 || !ok || strings.TrimSpace(title) == "" {
+			continue
+		}
+		headings++
+		if len(outline) < markdownOutlineMaxHeadings {
+			outline = append(outline, strings.Repeat("  ", level-1)+"- "+strings.TrimSpace(title))
+		}
+	}
+	if headings < 2 || !signal {
+		return "", false
+	}
+
+	sb := strutil.NewBuilder()
+	sb.Printlnf("Format: Markdown, %d characters, %d headings", len([]rune(text)), headings)
+	sb.Println("Outline:")
+	for _, o := range outline {
+		sb.Println(o)
+	}
+	if headings > len(outline) {
+		sb.Printlnf("... %d more headings", headings-len(outline))
+	}
+	sb.Println("")
+	sb.Println("Head:")
+	sb.WriteString(headOf(text, structuredPreviewHeadChars))
+	return sb.String(), true
+}
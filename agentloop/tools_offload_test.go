@@ -122,7 +122,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 	t.Run("non-tool message returned as-is", func(t *testing.T) {
 		msg := schema.UserMessage("hello world")
 		store := newMockFileStore()
-		got := maybeOffloadToolResult(context.Background(), msg, "some_tool", store, tokenizer, tokenLimit, "/prefix")
+		got := maybeOffloadToolResult(context.Background(), msg, "some_tool", store, tokenizer, tokenLimit, "/prefix", nil)
 		if got != msg {
 			t.Errorf("expected original message pointer, got different")
 		}
@@ -132,7 +132,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 		msg := &schema.Message{Role: schema.Tool, Content: bigContent, ToolCallID: "id1"}
 		store := newMockFileStore()
 		for toolName := range offloadExcludedTools {
-			got := maybeOffloadToolResult(context.Background(), msg, toolName, store, tokenizer, tokenLimit, "/prefix")
+			got := maybeOffloadToolResult(context.Background(), msg, toolName, store, tokenizer, tokenLimit, "/prefix", nil)
 			if got != msg {
 				t.Errorf("excluded tool %q: expected original message pointer", toolName)
 			}
@@ -143,7 +143,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 		smallContent := strings.Repeat("a", tokenLimit*4-4) // < tokenLimit tokens
 		msg := &schema.Message{Role: schema.Tool, Content: smallContent, ToolCallID: "id2"}
 		store := newMockFileStore()
-		got := maybeOffloadToolResult(context.Background(), msg, "some_tool", store, tokenizer, tokenLimit, "/prefix")
+		got := maybeOffloadToolResult(context.Background(), msg, "some_tool", store, tokenizer, tokenLimit, "/prefix", nil)
 		if got != msg {
 			t.Errorf("expected original message pointer for small content")
 		}
@@ -152,7 +152,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 	t.Run("content over threshold, write succeeds → replacement returned", func(t *testing.T) {
 		msg := &schema.Message{Role: schema.Tool, Content: bigContent, ToolCallID: "call_abc123"}
 		store := newMockFileStore()
-		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/large_tool_results")
+		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/large_tool_results", nil)
 		if got == msg {
 			t.Fatal("expected a new replacement message, got original")
 		}
@@ -178,7 +178,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 		msg := &schema.Message{Role: schema.Tool, Content: bigContent, ToolCallID: "call_fail"}
 		store := newMockFileStore()
 		store.failOn = "/prefix/call_fail"
-		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/prefix")
+		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/prefix", nil)
 		if got != msg {
 			t.Errorf("on write failure, original message should be returned")
 		}
@@ -187,7 +187,7 @@ func TestMaybeOffloadToolResult(t *testing.T) {
 	t.Run("unsafe call ID sanitized in file path", func(t *testing.T) {
 		msg := &schema.Message{Role: schema.Tool, Content: bigContent, ToolCallID: "call/abc:123"}
 		store := newMockFileStore()
-		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/prefix")
+		got := maybeOffloadToolResult(context.Background(), msg, "web_search", store, tokenizer, tokenLimit, "/prefix", nil)
 		if got == msg {
 			t.Fatal("expected replacement message")
 		}
@@ -207,7 +207,7 @@ func TestOffloadToolResults(t *testing.T) {
 
 	t.Run("tokenLimit zero → passthrough", func(t *testing.T) {
 		msgs := []*schema.Message{schema.UserMessage("hello")}
-		out := offloadToolResults(context.Background(), msgs, nil, newMockFileStore(), tokenizer, 0, "/prefix")
+		out := offloadToolResults(context.Background(), msgs, nil, newMockFileStore(), tokenizer, 0, "/prefix", nil)
 		if len(out) != 1 || out[0] != msgs[0] {
 			t.Errorf("expected passthrough of original slice when tokenLimit is 0")
 		}
@@ -215,7 +215,7 @@ func TestOffloadToolResults(t *testing.T) {
 
 	t.Run("store nil → passthrough", func(t *testing.T) {
 		msgs := []*schema.Message{schema.UserMessage("hello")}
-		out := offloadToolResults(context.Background(), msgs, nil, nil, tokenizer, tokenLimit, "/prefix")
+		out := offloadToolResults(context.Background(), msgs, nil, nil, tokenizer, tokenLimit, "/prefix", nil)
 		if len(out) != 1 || out[0] != msgs[0] {
 			t.Errorf("expected passthrough when store is nil")
 		}
@@ -234,7 +234,7 @@ func TestOffloadToolResults(t *testing.T) {
 		toolMsg := &schema.Message{Role: schema.Tool, Content: bigContent, ToolCallID: "call_xyz"}
 		msgs := []*schema.Message{toolMsg}
 
-		out := offloadToolResults(context.Background(), msgs, accumulated, store, tokenizer, tokenLimit, "/prefix")
+		out := offloadToolResults(context.Background(), msgs, accumulated, store, tokenizer, tokenLimit, "/prefix", nil)
 		if len(out) != 1 {
 			t.Fatalf("expected 1 output message, got %d", len(out))
 		}
@@ -253,9 +253,115 @@ func TestOffloadToolResults(t *testing.T) {
 		store := newMockFileStore()
 		userMsg := schema.UserMessage(bigContent)
 		msgs := []*schema.Message{userMsg}
-		out := offloadToolResults(context.Background(), msgs, nil, store, tokenizer, tokenLimit, "/prefix")
+		out := offloadToolResults(context.Background(), msgs, nil, store, tokenizer, tokenLimit, "/prefix", nil)
 		if len(out) != 1 || out[0] != userMsg {
 			t.Errorf("non-tool message should be passed through unchanged")
 		}
 	})
 }
+
+// TestBuildPreview_Formats verifies JSON, CSV and Markdown are previewed by their structure.
+func TestBuildPreview_Formats(t *testing.T) {
+	var items []string
+	for i := 0; i < 100; i++ {
+		items = append(items, `{"id":1,"title":"a search result","tags":["a","b"]}`)
+	}
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "json",
+			text: `{"results":[` + strings.Join(items, ",") + `],"total":100}`,
+			want: []string{"Format: JSON", "results: array of 100 items, first item: object with 3 keys", "    tags: array of 2 items", "  total: number"},
+		},
+		{
+			name: "csv",
+			text: "name,age,city\n" + strings.Repeat("bob,3,\"New York, US\"\n", 200),
+			want: []string{"Format: CSV, 200 rows (excluding the header), 3 columns", "Header: name, age, city", "First 5 rows:\nbob,3,\"New York, US\"\n"},
+		},
+		{
+			name: "markdown",
+			text: "# Report\n## Findings\n```\n# comment in code\n```\n### Detail\n## Sources\n" + strings.Repeat("text ", 1000),
+			want: []string{"Format: Markdown", "4 headings", "- Report\n  - Findings\n    - Detail\n  - Sources\n"},
+		},
+		{
+			name: "markdown without code blocks",
+			text: "# Report\n\nSee [the docs](https://example.com).\n\n## Findings\n" + strings.Repeat("text ", 1000),
+			want: []string{"Format: Markdown", "2 headings"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildPreview(tt.text)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("preview missing %q:\n%s", want, got)
+				}
+			}
+			if len(got) >= len(tt.text) {
+				t.Errorf("preview is %d chars, want shorter than the %d chars text", len(got), len(tt.text))
+			}
+		})
+	}
+}
+
+// TestBuildPreview_CommentedCode verifies that code and config full of "# " comments are not
+// previewed as Markdown, but by their head and tail.
+func TestBuildPreview_CommentedCode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "shell",
+			text: "#!/bin/sh\n# Install dependencies\napt-get install -y curl\n\n# Build\nmake all\n" + strings.Repeat("echo done\n", 300) + "# Cleanup\nrm -rf build\n",
+		},
+		{
+			name: "python",
+			text: "# Parse the input\ndef run(*args, **kwargs):\n    return handlers[name](args)\n\n# Entry point\n" + strings.Repeat("print(a**2 + b**2)\n", 200) + "# End\nrun()\n",
+		},
+		{
+			name: "yaml",
+			text: "# Server settings\nserver:\n  port: 8080\n\n# Database settings\ndb:\n" + strings.Repeat("  - host: localhost\n", 200) + "# Logging\nlog: info\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildPreview(tt.text)
+			if strings.Contains(got, "Format: Markdown") {
+				t.Errorf("previewed as Markdown:\n%s", got)
+			}
+			lines := strings.Split(strings.TrimRight(tt.text, "\n"), "\n")
+			if last := lines[len(lines)-1]; !strings.HasSuffix(got, last+"\n") {
+				t.Errorf("preview should keep the tail %q:\n%s", last, got)
+			}
+		})
+	}
+}
+
+// TestMaybeOffloadToolResult_Summary verifies the summary of the summary model is included.
+func TestMaybeOffloadToolResult_Summary(t *testing.T) {
+	var prompt string
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		prompt = input[0].Content
+		return schema.AssistantMessage("Ten results about Go generics.", nil), nil
+	}}
+	msg := &schema.Message{Role: schema.Tool, Content: strings.Repeat("result ", 100), ToolCallID: "call_1"}
+	got := maybeOffloadToolResult(context.Background(), msg, "web_search", newMockFileStore(), NewTokenizer(), 10, "/prefix", m)
+	if !strings.Contains(prompt, `tool="web_search"`) {
+		t.Errorf("summary prompt should name the tool:\n%s", prompt)
+	}
+	if !strings.Contains(got.Content, "Summary:\n\nTen results about Go generics.\n\nPreview:") {
+		t.Errorf("replacement should include the summary before the preview, got: %s", got.Content)
+	}
+
+	failing := &scriptedModel{respond: func([]*schema.Message, bool) (*schema.Message, error) {
+		return nil, errors.New("model down")
+	}}
+	got = maybeOffloadToolResult(context.Background(), msg, "web_search", newMockFileStore(), NewTokenizer(), 10, "/prefix", failing)
+	if strings.Contains(got.Content, "Summary:") || !strings.HasPrefix(got.Content, offloadedToolResultPrefix+"/prefix/call_1") {
+		t.Errorf("a failed summary should still offload without one, got: %s", got.Content)
+	}
+}
@@ -0,0 +1,190 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// DefaultPolicyPathArgs lists the tool arguments holding file paths checked by
+// PolicyRule.Path, covering the built-in file tools and transform_csv_lua.
+var DefaultPolicyPathArgs = []string{"path", "input_path", "output_path"}
+
+// PolicyEffect is the decision of a matching [PolicyRule].
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// PolicyRule allows or denies tool calls matching all of its conditions.
+//
+// Patterns are globs: * and ? do not match '/', and a ** segment matches zero or more
+// path segments (e.g. "/output/**").
+type PolicyRule struct {
+	Effect PolicyEffect
+	Tool   string            // Tool name pattern (e.g. "write_file", "*_file"); empty matches every tool
+	Path   string            // Pattern matched against each path argument, see ToolPolicy.PathArgs; empty matches any call
+	Args   map[string]string // Patterns matched against other string arguments by name; all must match
+	Reason string            // Told to the model when a call is denied by this rule
+}
+
+// ToolPolicy is the configuration of [NewToolPolicyMiddleware].
+type ToolPolicy struct {
+	Rules       []PolicyRule
+	DefaultDeny bool     // Deny calls matched by no rule; by default they are allowed
+	PathArgs    []string // Arguments holding file paths; defaults to DefaultPolicyPathArgs
+}
+
+// toolPolicyMiddleware denies tool calls that violate a ToolPolicy.
+type toolPolicyMiddleware struct {
+	BaseMiddleware
+	policy ToolPolicy
+}
+
+// NewToolPolicyMiddleware returns a middleware that checks every tool call against policy.
+// A denied call is not executed; the model gets an error result with the reason.
+//
+// Each path argument of a call (see ToolPolicy.PathArgs) is checked separately: the first rule
+// matching the tool, the path and the other arguments decides, and the call is denied if any of
+// its paths is denied. Paths are cleaned before matching, so "/output/../secrets/key" is matched
+// as "/secrets/key". A call without path arguments is decided by the first rule without Path
+// that matches it. Rules are evaluated in order, so put narrower rules first.
+//
+// Example:
+//
+//	// write_file only under /output, read_file anywhere but /secrets
+//	policy, err := agentloop.NewToolPolicyMiddleware(agentloop.ToolPolicy{
+//	    Rules: []agentloop.PolicyRule{
+//	        {Effect: agentloop.PolicyAllow, Tool: "write_file", Path: "/output/**"},
+//	        {Effect: agentloop.PolicyDeny, Tool: "write_file", Reason: "files can only be written under /output"},
+//	        {Effect: agentloop.PolicyDeny, Tool: "read_file", Path: "/secrets/**"},
+//	    },
+//	})
+func NewToolPolicyMiddleware(policy ToolPolicy) (Middleware, error) {
+	if policy.PathArgs == nil {
+		policy.PathArgs = DefaultPolicyPathArgs
+	}
+	for i, r := range policy.Rules {
+		if r.Effect != PolicyAllow && r.Effect != PolicyDeny {
+			return nil, errs.NewErrf("policy rule %d: invalid effect %q", i, r.Effect)
+		}
+		patterns := []string{r.Tool, r.Path}
+		for _, p := range r.Args {
+			patterns = append(patterns, p)
+		}
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, errs.Wrapf(err, "policy rule %d: invalid pattern %q", i, p)
+			}
+		}
+	}
+	return &toolPolicyMiddleware{policy: policy}, nil
+}
+
+func (m *toolPolicyMiddleware) Name() string { return "tool_policy" }
+
+func (m *toolPolicyMiddleware) WrapToolCall(ctx context.Context, req *ToolCallRequest, next ToolCallHandler) (*ToolCallResponse, error) {
+	if reason, ok := m.check(req); !ok {
+		return &ToolCallResponse{Result: "Error: tool call denied by policy, " + reason, IsError: true}, nil
+	}
+	return next(ctx, req)
+}
+
+// check reports whether the call is allowed, or the reason it is denied.
+func (m *toolPolicyMiddleware) check(req *ToolCallRequest) (reason string, ok bool) {
+	var paths []string
+	for _, name := range m.policy.PathArgs {
+		if v, isStr := req.Args[name].(string); isStr && v != "" {
+			paths = append(paths, cleanPolicyPath(v))
+		}
+	}
+	if len(paths) == 0 {
+		return m.decide(req, "", false)
+	}
+	for _, p := range paths {
+		if reason, ok := m.decide(req, p, true); !ok {
+			return reason, false
+		}
+	}
+	return "", true
+}
+
+// decide applies the first rule matching the call and one of its paths (if hasPath).
+func (m *toolPolicyMiddleware) decide(req *ToolCallRequest, p string, hasPath bool) (reason string, ok bool) {
+	for _, r := range m.policy.Rules {
+		if !r.matches(req, p, hasPath) {
+			continue
+		}
+		if r.Effect == PolicyAllow {
+			return "", true
+		}
+		return denyReason(r.Reason, req.Name, p), false
+	}
+	if m.policy.DefaultDeny {
+		return denyReason("", req.Name, p), false
+	}
+	return "", true
+}
+
+func (r PolicyRule) matches(req *ToolCallRequest, p string, hasPath bool) bool {
+	if r.Tool != "" && !matchPolicyGlob(r.Tool, req.Name) {
+		return false
+	}
+	if r.Path != "" && (!hasPath || !matchPolicyGlob(r.Path, p)) {
+		return false
+	}
+	for name, pattern := range r.Args {
+		v, isStr := req.Args[name].(string)
+		if !isStr || !matchPolicyGlob(pattern, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func denyReason(reason, tool, p string) string {
+	if reason != "" {
+		return reason
+	}
+	if p != "" {
+		return fmt.Sprintf("tool %q is not allowed to access %q", tool, p)
+	}
+	return fmt.Sprintf("tool %q is not allowed", tool)
+}
+
+// cleanPolicyPath returns the absolute, cleaned form of a virtual file path.
+func cleanPolicyPath(p string) string {
+	return path.Clean("/" + strings.TrimSpace(p))
+}
+
+// matchPolicyGlob reports whether name matches pattern. * and ? do not match '/', and a
+// ** segment matches zero or more segments.
+func matchPolicyGlob(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchGlobSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchGlobSegments(pattern[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segs[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -0,0 +1,81 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestToolPolicyMiddleware(t *testing.T) {
+	m, err := NewToolPolicyMiddleware(ToolPolicy{
+		Rules: []PolicyRule{
+			{Effect: PolicyAllow, Tool: "write_file", Path: "/output/**"},
+			{Effect: PolicyDeny, Tool: "write_file", Reason: "files can only be written under /output"},
+			{Effect: PolicyDeny, Tool: "*_file", Path: "/secrets/**"},
+			{Effect: PolicyDeny, Tool: "transform_csv_lua", Path: "/secrets/**"},
+			{Effect: PolicyDeny, Tool: "run_sql", Args: map[string]string{"query": "DROP *"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewToolPolicyMiddleware() error = %v", err)
+	}
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		return &ToolCallResponse{Result: "ok"}, nil
+	}
+
+	tests := []struct {
+		tool    string
+		args    map[string]any
+		allowed bool
+	}{
+		{"write_file", map[string]any{"path": "/output/report.md"}, true},
+		{"write_file", map[string]any{"path": "/output/a/b/c.md"}, true},
+		{"write_file", map[string]any{"path": "/tmp/report.md"}, false},
+		{"write_file", map[string]any{"path": "/output/../tmp/report.md"}, false},
+		{"read_file", map[string]any{"path": "/input/data.csv"}, true},
+		{"read_file", map[string]any{"path": "secrets/key"}, false},
+		{"edit_file", map[string]any{"path": "/secrets/key"}, false},
+		{"transform_csv_lua", map[string]any{"input_path": "/input/a.csv", "output_path": "/output/b.csv"}, true},
+		{"transform_csv_lua", map[string]any{"input_path": "/secrets/a.csv", "output_path": "/output/b.csv"}, false},
+		{"run_sql", map[string]any{"query": "SELECT 1"}, true},
+		{"run_sql", map[string]any{"query": "DROP TABLE users"}, false},
+		{"ls", map[string]any{"path": "/"}, true},
+	}
+	for _, tt := range tests {
+		resp, err := m.WrapToolCall(context.Background(), &ToolCallRequest{Name: tt.tool, Args: tt.args}, next)
+		if err != nil {
+			t.Fatalf("%s %v: error = %v", tt.tool, tt.args, err)
+		}
+		if allowed := !resp.IsError; allowed != tt.allowed {
+			t.Errorf("%s %v: allowed = %v, want %v (%s)", tt.tool, tt.args, allowed, tt.allowed, resp.Result)
+		}
+	}
+
+	resp, _ := m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "write_file", Args: map[string]any{"path": "/tmp/x"}}, next)
+	if !strings.Contains(resp.Result, "only be written under /output") {
+		t.Errorf("result = %q, want the rule's reason", resp.Result)
+	}
+}
+
+func TestToolPolicyMiddleware_DefaultDeny(t *testing.T) {
+	m, err := NewToolPolicyMiddleware(ToolPolicy{
+		Rules:       []PolicyRule{{Effect: PolicyAllow, Tool: "read_file", Path: "/input/**"}},
+		DefaultDeny: true,
+	})
+	if err != nil {
+		t.Fatalf("NewToolPolicyMiddleware() error = %v", err)
+	}
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		return &ToolCallResponse{Result: "ok"}, nil
+	}
+	for tool, allowed := range map[string]bool{"read_file": true, "write_file": false, "glob": false} {
+		resp, _ := m.WrapToolCall(context.Background(), &ToolCallRequest{Name: tool, Args: map[string]any{"path": "/input/a.txt"}}, next)
+		if resp.IsError == allowed {
+			t.Errorf("%s: allowed = %v, want %v", tool, !resp.IsError, allowed)
+		}
+	}
+
+	if _, err := NewToolPolicyMiddleware(ToolPolicy{Rules: []PolicyRule{{Effect: PolicyDeny, Path: "/a/[b"}}}); err == nil {
+		t.Error("invalid pattern: error = nil, want error")
+	}
+}
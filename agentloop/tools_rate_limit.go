@@ -0,0 +1,54 @@
+package agentloop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/curtisnewbie/miso-agent/agents"
+)
+
+// toolRateLimitMiddleware waits for the rate limit of a tool before calling it.
+type toolRateLimitMiddleware struct {
+	BaseMiddleware
+	limits map[string]agents.RateLimit
+}
+
+// ToolRateLimitKey returns the rate limit key used by [NewToolRateLimitMiddleware] for the named tool.
+func ToolRateLimitKey(tool string) string {
+	return "tool:" + tool
+}
+
+// NewToolRateLimitMiddleware returns a middleware that limits the QPS and concurrency of calls to
+// the tools in limits, keyed by tool name. Limits are shared by every Agent in the process
+// (and across processes with RateLimit.Redis), including sub-agents created with
+// [NewSubAgentTool], see [agents.AcquireRateLimit].
+//
+// A call that is still waiting when its ToolCallRequest.Deadline passes is not executed and the
+// model is told it was rate limited.
+//
+// Example:
+//
+//	rateLimit := agentloop.NewToolRateLimitMiddleware(map[string]agents.RateLimit{
+//	    "web_search": {QPS: 2, MaxConcurrent: 4},
+//	})
+func NewToolRateLimitMiddleware(limits map[string]agents.RateLimit) Middleware {
+	return &toolRateLimitMiddleware{limits: limits}
+}
+
+func (m *toolRateLimitMiddleware) Name() string { return "tool_rate_limit" }
+
+func (m *toolRateLimitMiddleware) WrapToolCall(ctx context.Context, req *ToolCallRequest, next ToolCallHandler) (*ToolCallResponse, error) {
+	limit, ok := m.limits[req.Name]
+	if !ok {
+		return next(ctx, req)
+	}
+	release, err := agents.AcquireRateLimit(ctx, ToolRateLimitKey(req.Name), limit)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return &ToolCallResponse{Result: fmt.Sprintf("Error: tool %q is rate limited, timed out waiting for its turn", req.Name), IsError: true}, nil
+		}
+		return nil, err
+	}
+	defer release()
+	return next(ctx, req)
+}
@@ -0,0 +1,92 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/curtisnewbie/miso-agent/agents"
+)
+
+func TestToolRateLimitMiddleware_Concurrency(t *testing.T) {
+	limits := map[string]agents.RateLimit{"rl_concurrency_search": {MaxConcurrent: 2}}
+	var inFlight, peak, calls atomic.Int32
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		calls.Add(1)
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+		return &ToolCallResponse{Result: "ok"}, nil
+	}
+
+	// Separate middleware instances, as used by separate agents, share the limit.
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		m := NewToolRateLimitMiddleware(limits)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "rl_concurrency_search"}, next); err != nil {
+				t.Errorf("WrapToolCall() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 6 {
+		t.Errorf("calls = %d, want 6", calls.Load())
+	}
+	if peak.Load() > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak.Load())
+	}
+}
+
+func TestToolRateLimitMiddleware_QPS(t *testing.T) {
+	m := NewToolRateLimitMiddleware(map[string]agents.RateLimit{"rl_qps_fetch": {QPS: 20}})
+	next := func(_ context.Context, req *ToolCallRequest) (*ToolCallResponse, error) {
+		return &ToolCallResponse{Result: "ok"}, nil
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "rl_qps_fetch"}, next); err != nil {
+			t.Fatalf("WrapToolCall() error = %v", err)
+		}
+	}
+	// The first call starts right away, the other 3 are spaced 50ms apart.
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("elapsed = %v, want >= 150ms", elapsed)
+	}
+
+	// Unlimited tools are not delayed.
+	start = time.Now()
+	for i := 0; i < 4; i++ {
+		m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "glob"}, next)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("unlimited tool elapsed = %v, want no wait", elapsed)
+	}
+
+	// A call whose deadline passes while waiting is not executed.
+	m.WrapToolCall(context.Background(), &ToolCallRequest{Name: "rl_qps_fetch"}, next)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp, err := m.WrapToolCall(ctx, &ToolCallRequest{Name: "rl_qps_fetch"}, func(context.Context, *ToolCallRequest) (*ToolCallResponse, error) {
+		t.Error("call executed after its deadline")
+		return &ToolCallResponse{}, nil
+	})
+	if err != nil {
+		t.Fatalf("WrapToolCall() error = %v", err)
+	}
+	if !resp.IsError || !strings.Contains(resp.Result, "rate limited") {
+		t.Errorf("result = %+v, want rate limited error", resp)
+	}
+}
@@ -83,7 +83,8 @@ func (w *toolWrapper) InvokableRun(ctx context.Context, input string, opts ...to
 		if args == nil {
 			args = map[string]interface{}{}
 		}
-		resp, err := w.toolCallChain(ctx, &ToolCallRequest{Name: w.tool.Name(), Args: args, RawInput: input})
+		deadline, _ := ctx.Deadline()
+		resp, err := w.toolCallChain(ctx, &ToolCallRequest{Name: w.tool.Name(), Args: args, RawInput: input, Deadline: deadline})
 		if err != nil {
 			return fmt.Sprintf("Error: %v", err), nil
 		}
@@ -104,8 +104,22 @@ func NewSubAgentTool(specs ...*AgentSpec) Tool {
 			}
 
 			if parentAcc, ok := ctx.Value(tokenAccCtxKey).(*tokenAccumulator); ok && parentAcc != nil {
-				tu := out.TokenUsage
-				parentAcc.add(tu.PromptTokens, tu.CompletionTokens, tu.CachedTokens)
+				parentAcc.merge(out.TokenUsage)
+			}
+
+			// A suspended sub-agent cannot be resumed through the parent, and its partial response is
+			// not an answer; report why it stopped and drop the checkpoint nobody will resume.
+			if out.StopReason == StopReasonPendingApproval || out.StopReason == StopReasonNeedsInput {
+				if store := agent.config.CheckpointStore; store != nil {
+					rail := flow.NewRail(cleanCtx)
+					if err := store.Delete(rail, agent.config.Name, agentCtx.SessionId); err != nil {
+						rail.Warnf("failed to delete checkpoint of sub-agent %s (non-fatal), %v", args.AgentName, err)
+					}
+				}
+				if out.StopReason == StopReasonNeedsInput {
+					return "", errs.NewErrf("sub-agent %s stopped before finishing (%s), it asked: %s", args.AgentName, out.StopReason, out.Question)
+				}
+				return "", errs.NewErrf("sub-agent %s stopped before finishing (%s)", args.AgentName, out.StopReason)
 			}
 
 			return out.Response, nil
@@ -0,0 +1,45 @@
+package agentloop
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/util/ptr"
+)
+
+func TestSubAgentTool_SuspendedSubAgent(t *testing.T) {
+	sub := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		return toolCallMsg("sub_1", "ask_user", `{"question":"Which region?"}`), nil
+	}}
+	spec := &AgentSpec{
+		Name:         "helper",
+		Capabilities: "helps",
+		Builder: func(AgentContext) (*Agent, error) {
+			return NewAgent(AgentConfig{Name: "Helper", Model: sub, EnableAskUserTool: ptr.ValPtr(true)})
+		},
+	}
+
+	var toolResult string
+	parent := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		last := input[len(input)-1]
+		if last.Role != schema.Tool {
+			return toolCallMsg("call_1", "task", `{"agent_name":"helper","task":"deploy"}`), nil
+		}
+		toolResult = last.Content
+		return schema.AssistantMessage("done", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: parent, Tools: []Tool{NewSubAgentTool(spec)}})
+
+	out, err := a.Execute(flow.EmptyRail(), AgentRequest{UserInput: "deploy"})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.StopReason != StopReasonCompleted {
+		t.Errorf("StopReason = %v, want %v", out.StopReason, StopReasonCompleted)
+	}
+	if !strings.Contains(toolResult, string(StopReasonNeedsInput)) || !strings.Contains(toolResult, "Which region?") {
+		t.Errorf("task tool result = %q, want the stop reason and the question", toolResult)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	einotool "github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso-agent/agents"
 	"github.com/curtisnewbie/miso/flow"
 	"github.com/curtisnewbie/miso/util/hash"
 )
@@ -29,20 +30,126 @@ const (
 // tokenAccumulator collects cumulative token usage across all LLM calls in one execution.
 type tokenAccumulator struct {
 	mu               sync.Mutex
+	price            *agents.ModelPrice            // price of the agent's model; nil if unknown
+	model            string                        // name of the agent's model; "" if unknown
+	fetchPrices      bool                          // whether prices of other serving models may be fetched, see AgentConfig.EnableModelsFetch
+	servedPrices     map[string]*agents.ModelPrice // prices of other serving models by name; nil if unknown
 	promptTokens     int
 	completionTokens int
 	cachedTokens     int
+	cost             float64
+	byModel          map[string]ModelUsage
+	calls            int // model calls of this agent, excluding merged sub-agent usage
+	ownCompletion    int // completion tokens of the calls, excluding merged sub-agent usage
 	step             int
 }
 
+// unknownModel keys TokenUsage.ByModel for models whose name is unknown.
+const unknownModel = "unknown"
+
+// addModelUsage adds u to byModel[model]. Caller must hold a.mu.
+func (a *tokenAccumulator) addModelUsage(model string, u ModelUsage) {
+	if model == "" {
+		model = unknownModel
+	}
+	if a.byModel == nil {
+		a.byModel = make(map[string]ModelUsage)
+	}
+	m := a.byModel[model]
+	m.PromptTokens += u.PromptTokens
+	m.CompletionTokens += u.CompletionTokens
+	m.CachedTokens += u.CachedTokens
+	m.Cost += u.Cost
+	a.byModel[model] = m
+}
+
+// add records the usage of one model call of this agent.
 func (a *tokenAccumulator) add(prompt, completion, cached int) {
 	a.mu.Lock()
+	a.addLocked(a.model, a.price, prompt, completion, cached)
+	a.mu.Unlock()
+}
+
+// addServed records the usage of one model call of this agent served by model, e.g. a fallback
+// (see agents.ServingModelName). Unless model is the agent's model, the usage is priced at the
+// price of model looked up by name, and keyed by model in TokenUsage.ByModel.
+func (a *tokenAccumulator) addServed(rail flow.Rail, model string, prompt, completion, cached int) {
+	if model == "" || model == a.model {
+		a.add(prompt, completion, cached)
+		return
+	}
+	a.mu.Lock()
+	price, found := a.servedPrices[model]
+	a.mu.Unlock()
+	if !found {
+		if p, ok := agents.LookupModelPrice(rail, model, a.fetchPrices); ok {
+			price = &p
+		}
+	}
+	a.mu.Lock()
+	if a.servedPrices == nil {
+		a.servedPrices = make(map[string]*agents.ModelPrice)
+	}
+	a.servedPrices[model] = price
+	a.addLocked(model, price, prompt, completion, cached)
+	a.mu.Unlock()
+}
+
+// addLocked records the usage of one model call served by model at price. Caller must hold a.mu.
+func (a *tokenAccumulator) addLocked(model string, price *agents.ModelPrice, prompt, completion, cached int) {
 	a.promptTokens += prompt
 	a.completionTokens += completion
 	a.cachedTokens += cached
+	var cost float64
+	if price != nil {
+		cost = price.Cost(prompt, completion, cached)
+	}
+	a.cost += cost
+	a.addModelUsage(model, ModelUsage{PromptTokens: prompt, CompletionTokens: completion, CachedTokens: cached, Cost: cost})
+	a.calls++
+	a.ownCompletion += completion
+}
+
+// merge adds usage reported elsewhere (a sub-agent run or a resumed checkpoint), including its cost.
+func (a *tokenAccumulator) merge(tu TokenUsage) {
+	a.mu.Lock()
+	a.promptTokens += tu.PromptTokens
+	a.completionTokens += tu.CompletionTokens
+	a.cachedTokens += tu.CachedTokens
+	a.cost += tu.Cost
+	if len(tu.ByModel) == 0 {
+		if tu.PromptTokens > 0 || tu.CompletionTokens > 0 {
+			a.addModelUsage("", ModelUsage{PromptTokens: tu.PromptTokens, CompletionTokens: tu.CompletionTokens, CachedTokens: tu.CachedTokens, Cost: tu.Cost})
+		}
+	}
+	for model, u := range tu.ByModel {
+		a.addModelUsage(model, u)
+	}
 	a.mu.Unlock()
 }
 
+// checkBudget projects the usage after the next model call, whose prompt is nextPrompt tokens
+// and whose completion is assumed to be the average of this agent's calls so far (merged usage
+// has no call count), and returns the first limit of b that it would exceed, or "" if none.
+func (a *tokenAccumulator) checkBudget(b Budget, nextPrompt int) BudgetLimit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	avgCompletion := 0
+	if a.calls > 0 {
+		avgCompletion = a.ownCompletion / a.calls
+	}
+	if b.MaxPromptTokens > 0 && a.promptTokens+nextPrompt > b.MaxPromptTokens {
+		return BudgetLimitPromptTokens
+	}
+	if b.MaxCompletionTokens > 0 && a.completionTokens+avgCompletion > b.MaxCompletionTokens {
+		return BudgetLimitCompletionTokens
+	}
+	if b.MaxCost > 0 && a.price != nil && a.cost+a.price.Cost(nextPrompt, avgCompletion, 0) > b.MaxCost {
+		return BudgetLimitCost
+	}
+	return ""
+}
+
 func (a *tokenAccumulator) incStep() int {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -59,11 +166,19 @@ func (a *tokenAccumulator) getStep() int {
 func (a *tokenAccumulator) snapshot() TokenUsage {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	return TokenUsage{
+	tu := TokenUsage{
 		PromptTokens:     a.promptTokens,
 		CompletionTokens: a.completionTokens,
 		CachedTokens:     a.cachedTokens,
+		Cost:             a.cost,
 	}
+	if len(a.byModel) > 0 {
+		tu.ByModel = make(map[string]ModelUsage, len(a.byModel))
+		for k, v := range a.byModel {
+			tu.ByModel[k] = v
+		}
+	}
+	return tu
 }
 
 // accStep returns the current step from acc, or 0 if acc is nil.
@@ -132,9 +247,10 @@ var traceEntryIdxCtxKey = traceEntryIdxCtxKeyType{}
 // ToolEvent is emitted during agent execution for each tool invocation.
 // If ToolEventCallback is set in AgentConfig, it is called synchronously for each event.
 type ToolEvent struct {
-	Kind ToolEventKind
-	Name string // tool name
-	Args string // raw JSON args string
+	Kind   ToolEventKind
+	Name   string // tool name
+	Args   string // raw JSON args string
+	Result string // tool result; only populated for ToolEventKindResult
 }
 
 var toolAliasMap = hash.NewStrRWMap[string]()
@@ -229,16 +345,26 @@ func buildTraceHandler(name string, ops agentOps, acc *tokenAccumulator, traceAc
 			}
 			if ops.toolEventCallback != nil && ri.Component == "Tool" {
 				args, _ := ctx.Value(toolArgsCtxKey).(string)
+				result := ""
+				if co := einotool.ConvCallbackOutput(output); co != nil {
+					result = co.Response
+				}
 				ops.toolEventCallback(ToolEvent{
-					Kind: ToolEventKindResult,
-					Name: ri.Name,
-					Args: args,
+					Kind:   ToolEventKindResult,
+					Name:   ri.Name,
+					Args:   args,
+					Result: result,
 				})
 			}
 			if ri.Component == "ChatModel" {
 				inToken, outToken, cachedToken, ok := agentTokenUsage(output)
 				if ok && acc != nil {
-					acc.add(inToken, outToken, cachedToken)
+					acc.addServed(flow.NewRail(ctx), agents.ServingModelName(agentExtractMessage(output)), inToken, outToken, cachedToken)
+				}
+				if c := tokenCalibrationFromCtx(ctx); ok && c != nil {
+					if ratio, updated := c.observe(inToken); updated {
+						flow.NewRail(ctx).Debugf("[%v] Token estimate ratio (reported / estimated): %.2f", name, ratio)
+					}
 				}
 				{
 					rail := flow.NewRail(ctx)
@@ -2,11 +2,14 @@ package agentloop
 
 import (
 	"context"
+	"math"
 	"testing"
 
 	"github.com/cloudwego/eino/callbacks"
 	"github.com/cloudwego/eino/components"
 	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/curtisnewbie/miso-agent/agents"
+	"github.com/curtisnewbie/miso/flow"
 )
 
 func TestBuildTraceHandler_ToolEventCallback(t *testing.T) {
@@ -140,3 +143,69 @@ func TestBuildTraceHandler_ToolResultEvent(t *testing.T) {
 		}
 	})
 }
+
+func TestTokenAccumulator_ByModel(t *testing.T) {
+	acc := &tokenAccumulator{price: &agents.ModelPrice{Input: 1, Output: 2}, model: "parent-model"}
+	acc.add(1_000_000, 500_000, 0)
+
+	// Sub-agent usage is merged per model.
+	acc.merge(TokenUsage{
+		PromptTokens: 300, CompletionTokens: 30, Cost: 0.25,
+		ByModel: map[string]ModelUsage{
+			"child-model":  {PromptTokens: 200, CompletionTokens: 20, Cost: 0.2},
+			"parent-model": {PromptTokens: 100, CompletionTokens: 10, Cost: 0.05},
+		},
+	})
+	// Usage without a breakdown is attributed to "unknown".
+	acc.merge(TokenUsage{PromptTokens: 5, CompletionTokens: 1})
+
+	tu := acc.snapshot()
+	if got := tu.ByModel["parent-model"]; got.PromptTokens != 1_000_100 || got.CompletionTokens != 500_010 || math.Abs(got.Cost-2.05) > 1e-9 {
+		t.Errorf("parent-model = %+v", got)
+	}
+	if got := tu.ByModel["child-model"]; got.PromptTokens != 200 || math.Abs(got.Cost-0.2) > 1e-9 {
+		t.Errorf("child-model = %+v", got)
+	}
+	if got := tu.ByModel[unknownModel]; got.PromptTokens != 5 {
+		t.Errorf("unknown = %+v", got)
+	}
+	if math.Abs(tu.Cost-2.25) > 1e-9 {
+		t.Errorf("Cost = %v, want 2.25", tu.Cost)
+	}
+
+	// The snapshot does not alias the accumulator.
+	tu.ByModel["child-model"] = ModelUsage{}
+	if acc.snapshot().ByModel["child-model"].PromptTokens != 200 {
+		t.Error("snapshot ByModel aliases the accumulator")
+	}
+}
+
+func TestTokenAccumulator_AddServed(t *testing.T) {
+	acc := &tokenAccumulator{price: &agents.ModelPrice{Input: 1, Output: 2}, model: "primary-model"}
+	acc.servedPrices = map[string]*agents.ModelPrice{"backup-model": {Input: 4, Output: 8}}
+	rail := flow.EmptyRail()
+
+	acc.addServed(rail, "", 1_000_000, 0, 0)
+	acc.addServed(rail, "primary-model", 1_000_000, 0, 0)
+	// A call served by a fallback is priced at, and keyed by, the fallback.
+	acc.addServed(rail, "backup-model", 1_000_000, 1_000_000, 0)
+	// A fallback with an unknown price has no cost.
+	acc.addServed(rail, "unpriced-model", 1_000_000, 0, 0)
+
+	tu := acc.snapshot()
+	if got := tu.ByModel["primary-model"]; got.PromptTokens != 2_000_000 || math.Abs(got.Cost-2) > 1e-9 {
+		t.Errorf("primary-model = %+v", got)
+	}
+	if got := tu.ByModel["backup-model"]; got.PromptTokens != 1_000_000 || math.Abs(got.Cost-12) > 1e-9 {
+		t.Errorf("backup-model = %+v", got)
+	}
+	if got := tu.ByModel["unpriced-model"]; got.PromptTokens != 1_000_000 || got.Cost != 0 {
+		t.Errorf("unpriced-model = %+v", got)
+	}
+	if math.Abs(tu.Cost-14) > 1e-9 {
+		t.Errorf("Cost = %v, want 14", tu.Cost)
+	}
+	if acc.calls != 4 {
+		t.Errorf("calls = %d, want 4", acc.calls)
+	}
+}
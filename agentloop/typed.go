@@ -0,0 +1,136 @@
+package agentloop
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/curtisnewbie/miso-agent/agents"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/util/llm"
+)
+
+// typedOutputCheckAttempts is the maxAttempts of the JsonOutputCheck used by [ExecuteTyped]
+// when the model does not support structured output.
+const typedOutputCheckAttempts = 2
+
+// typedOutput describes the JSON output expected by [ExecuteTyped] for one execution.
+type typedOutput struct {
+	schema    string          // JSON schema of the output, included in the system prompt when modelOpts is empty
+	modelOpts []model.Option  // response_format options passed to every model call; empty if unsupported
+	check     OutputCheckFunc // JsonOutputCheck used when the model does not support structured output
+}
+
+var schemaNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// newTypedOutput derives the JSON schema of T and decides how the output is enforced with m.
+func newTypedOutput[T any](m model.BaseChatModel) (to *typedOutput, err error) {
+	// The schema reflector panics on types it cannot describe, e.g. channels and funcs.
+	defer func() {
+		if v := recover(); v != nil {
+			to, err = nil, errs.NewErrf("failed to derive JSON schema of %v: %v", reflect.TypeFor[T](), v)
+		}
+	}()
+	paramsOneOf, err := utils.GoStruct2ParamsOneOf[T](utils.WithSchemaModifier(autoSchemaModifier))
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to derive JSON schema of %v", reflect.TypeFor[T]())
+	}
+	js, err := paramsOneOf.ToJSONSchema()
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to derive JSON schema of %v", reflect.TypeFor[T]())
+	}
+	buf, err := json.Marshal(js)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to marshal JSON schema of %v", reflect.TypeFor[T]())
+	}
+
+	to = &typedOutput{schema: string(buf)}
+	if agents.SupportsJSONSchema(m) {
+		name := schemaNameInvalidChars.ReplaceAllString(reflect.TypeFor[T]().Name(), "_")
+		if name == "" {
+			name = "output"
+		}
+		to.modelOpts = []model.Option{agents.WithJSONSchemaResponseFormat(name, js)}
+	} else {
+		to.check = JsonOutputCheck[T](typedOutputCheckAttempts)
+	}
+	return to, nil
+}
+
+// ExecuteTyped runs the agent like [Agent.Execute] and parses the final response as JSON of type T.
+//
+// The JSON schema of T is derived with the same reflection and struct tags as
+// [NewAutoTypedCtxAwareToolFunc]. If the model supports structured output (see
+// [agents.StructuredOutputModel]), the schema is sent as the response_format of every model call.
+// Otherwise the schema is added to the system prompt and responses are checked with
+// [JsonOutputCheck] (after AgentConfig.OutputCheck, if any).
+//
+// If the run fails, or the response cannot be parsed, an error is returned with the zero value of T
+// and the TaskOutput of the run. If no JSON schema can be derived from T, nothing is run and the
+// TaskOutput only has the SessionId of req and StopReasonError.
+//
+// Example:
+//
+//	type Verdict struct {
+//	    Score  int    `json:"score"  desc:"Score from 1 to 10"`
+//	    Reason string `json:"reason" desc:"Why the score was given"`
+//	}
+//
+//	verdict, out, err := agentloop.ExecuteTyped[Verdict](agent, rail, agentloop.AgentRequest{UserInput: input})
+func ExecuteTyped[T any](a *Agent, rail flow.Rail, req AgentRequest) (T, TaskOutput, error) {
+	var t T
+	typed, err := newTypedOutput[T](a.config.Model)
+	if err != nil {
+		return t, TaskOutput{SessionId: req.SessionId, StopReason: StopReasonError}, err
+	}
+	out, err := a.execute(rail, req, typed)
+	if err != nil {
+		return t, out, err
+	}
+	_, content := llm.ParseThink(out.Response)
+	t, err = llm.ParseLLMJsonAs[T](content)
+	if err != nil {
+		return t, out, errs.Wrapf(err, "failed to parse response as %v, StopReason: %v", reflect.TypeFor[T](), out.StopReason)
+	}
+	return t, out, nil
+}
+
+// outputCheckOf returns the output check of the execution: AgentConfig.OutputCheck followed by
+// the check of [ExecuteTyped], or nil if there is none.
+func outputCheckOf(agent *Agent, typed *typedOutput) OutputCheckFunc {
+	configured := agent.config.OutputCheck
+	if typed == nil || typed.check == nil {
+		return configured
+	}
+	if configured == nil {
+		return typed.check
+	}
+	return func(ctx context.Context, agentCtx AgentContext, attempt int, output string) (string, bool, error) {
+		hint, ok, err := configured(ctx, agentCtx, attempt, output)
+		if err != nil || !ok {
+			return hint, ok, err
+		}
+		return typed.check(ctx, agentCtx, attempt, output)
+	}
+}
+
+// typedModelOpts returns the model call options of [ExecuteTyped] for the execution, if any.
+func typedModelOpts(typed *typedOutput) []model.Option {
+	if typed == nil {
+		return nil
+	}
+	return typed.modelOpts
+}
+
+// typedOutputSchema returns the schema to include in the system prompt, i.e. when structured
+// output is not used.
+func typedOutputSchema(typed *typedOutput) string {
+	if typed == nil || len(typed.modelOpts) > 0 {
+		return ""
+	}
+	return typed.schema
+}
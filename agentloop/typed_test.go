@@ -0,0 +1,109 @@
+package agentloop
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+type typedTestVerdict struct {
+	Score  int    `json:"score" desc:"Score from 1 to 10"`
+	Reason string `json:"reason"`
+}
+
+// structuredModel is a scriptedModel that supports structured output and records the
+// number of options of each call.
+type structuredModel struct {
+	scriptedModel
+	optCounts []int
+}
+
+func (m *structuredModel) SupportsJSONSchema() bool { return true }
+
+func (m *structuredModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.optCounts = append(m.optCounts, len(opts))
+	return m.scriptedModel.Generate(ctx, input, opts...)
+}
+
+func TestExecuteTyped_OutputCheckFallback(t *testing.T) {
+	n := 0
+	var systemPrompt string
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		n++
+		systemPrompt = input[0].Content
+		if n == 1 {
+			return schema.AssistantMessage("The score is 8.", nil), nil
+		}
+		return schema.AssistantMessage("```json\n{\"score\": 8, \"reason\": \"good\"}\n```", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	v, out, err := ExecuteTyped[typedTestVerdict](a, flow.EmptyRail(), AgentRequest{UserInput: "score it"})
+	if err != nil {
+		t.Fatalf("ExecuteTyped() error = %v", err)
+	}
+	if v.Score != 8 || v.Reason != "good" {
+		t.Errorf("v = %+v", v)
+	}
+	if n != 2 || out.StopReason != StopReasonCompleted {
+		t.Errorf("%d calls, StopReason = %v, want 2 calls and %v", n, out.StopReason, StopReasonCompleted)
+	}
+	if !strings.Contains(systemPrompt, "<output_format>") || !strings.Contains(systemPrompt, `"score"`) {
+		t.Errorf("system prompt should contain the output schema:\n%s", systemPrompt)
+	}
+}
+
+func TestExecuteTyped_StructuredOutput(t *testing.T) {
+	var systemPrompt string
+	m := &structuredModel{scriptedModel: scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		systemPrompt = input[0].Content
+		return schema.AssistantMessage(`{"score": 3, "reason": "weak"}`, nil), nil
+	}}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	v, _, err := ExecuteTyped[typedTestVerdict](a, flow.EmptyRail(), AgentRequest{UserInput: "score it"})
+	if err != nil {
+		t.Fatalf("ExecuteTyped() error = %v", err)
+	}
+	if v.Score != 3 || v.Reason != "weak" {
+		t.Errorf("v = %+v", v)
+	}
+	if len(m.optCounts) != 1 || m.optCounts[0] != 1 {
+		t.Errorf("option counts = %v, want the response_format option on the only call", m.optCounts)
+	}
+	if strings.Contains(systemPrompt, "<output_format>") {
+		t.Errorf("system prompt should not contain the output schema with structured output")
+	}
+}
+
+func TestExecuteTyped_Unparsable(t *testing.T) {
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		return schema.AssistantMessage("no idea", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	_, out, err := ExecuteTyped[typedTestVerdict](a, flow.EmptyRail(), AgentRequest{UserInput: "score it"})
+	if err == nil {
+		t.Fatal("ExecuteTyped() should fail")
+	}
+	if out.StopReason != StopReasonOutputCheckExhausted || out.Response != "no idea" {
+		t.Errorf("out = %+v", out)
+	}
+}
+
+func TestExecuteTyped_InvalidSchema(t *testing.T) {
+	calls := 0
+	m := &scriptedModel{respond: func(input []*schema.Message, _ bool) (*schema.Message, error) {
+		calls++
+		return schema.AssistantMessage("{}", nil), nil
+	}}
+	a := newTestAgent(t, AgentConfig{Model: m})
+	_, out, err := ExecuteTyped[chan int](a, flow.EmptyRail(), AgentRequest{SessionId: "sess_1", UserInput: "score it"})
+	if err == nil {
+		t.Fatal("ExecuteTyped() should fail")
+	}
+	if calls != 0 || out.StopReason != StopReasonError || out.SessionId != "sess_1" {
+		t.Errorf("%d calls, out = %+v; want no call and StopReasonError", calls, out)
+	}
+}
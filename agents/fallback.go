@@ -0,0 +1,215 @@
+package agents
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/errs"
+	"github.com/curtisnewbie/miso/flow"
+)
+
+// DefaultFallbackOn lists the error classes on which [NewFallbackChatModel] moves to the next model
+// by default: the retries of the current model were exhausted, the provider failed or its circuit
+// breaker is open, or the prompt does not fit the context window of the current model.
+var DefaultFallbackOn = []ModelErrorClass{
+	ModelErrorRetriesExhausted,
+	ModelErrorServer,
+	ModelErrorCircuitOpen,
+	ModelErrorContextOverflow,
+}
+
+// FallbackChatModelOpt is a functional option for [NewFallbackChatModel].
+type FallbackChatModelOpt = func(o *fallbackConfig)
+
+type fallbackConfig struct {
+	fallbackOn []ModelErrorClass
+}
+
+// WithFallbackOn sets the error classes on which the next model is tried, replacing [DefaultFallbackOn].
+func WithFallbackOn(classes ...ModelErrorClass) func(o *fallbackConfig) {
+	return func(o *fallbackConfig) {
+		o.fallbackOn = classes
+	}
+}
+
+// FallbackChatModel is a chat model that calls its models in order and moves to the next one
+// when a call fails with one of the configured error classes. Created by [NewFallbackChatModel].
+type FallbackChatModel struct {
+	models []model.ToolCallingChatModel
+	conf   fallbackConfig
+}
+
+// NewFallbackChatModel creates a chat model that uses primary, and the fallbacks in the given order
+// when a call fails with an error in [DefaultFallbackOn] (see [WithFallbackOn]). Other errors, and
+// the error of the last model, are returned as is. A cancelled context never falls back.
+//
+// Each model should handle its own retries, see [WithRetry]; the next model is tried right away.
+// For Stream, only errors returned before the stream is opened fall back.
+//
+// Example:
+//
+//	primary, _ := NewOpenAIChatModel("qwen3-max", dashscopeKey, WithRetry(2))
+//	backup, _ := NewOpenAIChatModel("deepseek-chat", deepseekKey, WithBaseURL(DeepseekBaseURL))
+//	m := NewFallbackChatModel(primary, backup)
+func NewFallbackChatModel(primary model.ToolCallingChatModel, fallbacks ...model.ToolCallingChatModel) *FallbackChatModel {
+	return newFallbackChatModel(append([]model.ToolCallingChatModel{primary}, fallbacks...))
+}
+
+// NewFallbackChatModelWithOpts is like [NewFallbackChatModel] with options; models[0] is the primary.
+// It returns an error if models is empty or contains a nil model.
+func NewFallbackChatModelWithOpts(models []model.ToolCallingChatModel, ops ...FallbackChatModelOpt) (*FallbackChatModel, error) {
+	if len(models) == 0 {
+		return nil, errs.NewErrf("fallback chat model requires at least one model")
+	}
+	for i, m := range models {
+		if m == nil {
+			return nil, errs.NewErrf("fallback chat model: models[%d] is nil", i)
+		}
+	}
+	return newFallbackChatModel(slices.Clone(models), ops...), nil
+}
+
+func newFallbackChatModel(models []model.ToolCallingChatModel, ops ...FallbackChatModelOpt) *FallbackChatModel {
+	conf := fallbackConfig{fallbackOn: DefaultFallbackOn}
+	for _, op := range ops {
+		op(&conf)
+	}
+	return &FallbackChatModel{models: models, conf: conf}
+}
+
+// servingModelExtraKey keys the name of the model that served a call in schema.Message.Extra.
+const servingModelExtraKey = "agents_serving_model"
+
+// ServingModelName returns the name of the model that produced msg, as recorded by
+// [FallbackChatModel] in the message (or, for Stream, in its first chunk), or "" if not recorded.
+// Usage reported with msg is that of the serving model, which may not be the primary.
+func ServingModelName(msg *schema.Message) string {
+	if msg == nil {
+		return ""
+	}
+	name, _ := msg.Extra[servingModelExtraKey].(string)
+	return name
+}
+
+// withServingModel returns a copy of msg recording name as its serving model, see [ServingModelName].
+func withServingModel(msg *schema.Message, name string) *schema.Message {
+	if msg == nil || name == "" {
+		return msg
+	}
+	cp := *msg
+	cp.Extra = maps.Clone(msg.Extra)
+	if cp.Extra == nil {
+		cp.Extra = make(map[string]any, 1)
+	}
+	cp.Extra[servingModelExtraKey] = name
+	return &cp
+}
+
+// ModelName returns the name of the primary model, or "" if it does not implement [ModelNamer].
+// The model that served a call is recorded in its response, see [ServingModelName].
+func (f *FallbackChatModel) ModelName() string {
+	return modelNameOf(f.models[0])
+}
+
+func (f *FallbackChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	var served string
+	msg, err := callWithFallback(ctx, f, func(m model.ToolCallingChatModel) (*schema.Message, error) {
+		served = modelNameOf(m)
+		return m.Generate(ctx, input, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withServingModel(msg, served), nil
+}
+
+func (f *FallbackChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	var served string
+	sr, err := callWithFallback(ctx, f, func(m model.ToolCallingChatModel) (*schema.StreamReader[*schema.Message], error) {
+		served = modelNameOf(m)
+		return m.Stream(ctx, input, opts...)
+	})
+	if err != nil || served == "" {
+		return sr, err
+	}
+	// Only the first chunk records the serving model, so concatenating the chunks keeps the name intact.
+	first := true
+	return schema.StreamReaderWithConvert(sr, func(chunk *schema.Message) (*schema.Message, error) {
+		if !first || chunk == nil {
+			return chunk, nil
+		}
+		first = false
+		return withServingModel(chunk, served), nil
+	}), nil
+}
+
+// SupportsJSONSchema reports whether every model accepts a JSON schema response_format.
+func (f *FallbackChatModel) SupportsJSONSchema() bool {
+	for _, m := range f.models {
+		if !SupportsJSONSchema(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTools binds tools to every model and returns a new FallbackChatModel with the same options.
+func (f *FallbackChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	models := make([]model.ToolCallingChatModel, 0, len(f.models))
+	for _, m := range f.models {
+		bound, err := m.WithTools(tools)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, bound)
+	}
+	return &FallbackChatModel{models: models, conf: f.conf}, nil
+}
+
+// shouldFallback reports whether err matches one of the configured error classes.
+func (f *FallbackChatModel) shouldFallback(err error) bool {
+	class := ClassifyModelError(err)
+	if class == ModelErrorCancelled {
+		return false
+	}
+	if IsRetryExhausted(err) && slices.Contains(f.conf.fallbackOn, ModelErrorRetriesExhausted) {
+		return true
+	}
+	return slices.Contains(f.conf.fallbackOn, class)
+}
+
+func callWithFallback[T any](ctx context.Context, f *FallbackChatModel, call func(m model.ToolCallingChatModel) (T, error)) (T, error) {
+	var t T
+	var err error
+	for i, m := range f.models {
+		t, err = call(m)
+		if err == nil {
+			return t, nil
+		}
+		if i == len(f.models)-1 || ctx.Err() != nil || !f.shouldFallback(err) {
+			return t, err
+		}
+		flow.NewRail(ctx).Warnf("Model %v failed (%v), falling back to model %v, %v",
+			fallbackModelName(m, i), ClassifyModelError(err), fallbackModelName(f.models[i+1], i+1), err)
+	}
+	return t, err
+}
+
+// modelNameOf returns the name of m, or "" if it does not implement [ModelNamer].
+func modelNameOf(m model.ToolCallingChatModel) string {
+	if namer, ok := m.(ModelNamer); ok {
+		return namer.ModelName()
+	}
+	return ""
+}
+
+// fallbackModelName returns the name of m for logs, or its index if it does not implement [ModelNamer].
+func fallbackModelName(m model.ToolCallingChatModel, i int) any {
+	if name := modelNameOf(m); name != "" {
+		return name
+	}
+	return i
+}
@@ -0,0 +1,36 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+)
+
+func TestNewFallbackChatModelWithOpts_Invalid(t *testing.T) {
+	if _, err := NewFallbackChatModelWithOpts(nil); err == nil {
+		t.Error("expected error for no models")
+	}
+	if _, err := NewFallbackChatModelWithOpts([]model.ToolCallingChatModel{&stubChatModel{}, nil}); err == nil {
+		t.Error("expected error for a nil model")
+	}
+}
+
+func TestFallbackChatModel_Generate(t *testing.T) {
+	primary := &stubChatModel{errs: []error{apiError(http.StatusInternalServerError), apiError(http.StatusBadRequest)}}
+	backup := &stubChatModel{}
+	f, err := NewFallbackChatModelWithOpts([]model.ToolCallingChatModel{primary, backup})
+	if err != nil {
+		t.Fatalf("NewFallbackChatModelWithOpts() error = %v", err)
+	}
+
+	// A server error falls back to the next model.
+	if _, err := f.Generate(context.Background(), nil); err != nil || backup.calls != 1 {
+		t.Fatalf("Generate() error = %v, backup calls = %d; want the backup to answer", err, backup.calls)
+	}
+	// A bad request would fail on any model.
+	if _, err := f.Generate(context.Background(), nil); err == nil || backup.calls != 1 {
+		t.Errorf("Generate() error = %v, backup calls = %d; want the bad request without fallback", err, backup.calls)
+	}
+}
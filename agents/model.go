@@ -11,7 +11,6 @@ import (
 	"github.com/cloudwego/eino/schema"
 	"github.com/curtisnewbie/miso/flow"
 	"github.com/curtisnewbie/miso/util/ptr"
-	"github.com/curtisnewbie/miso/util/retry"
 )
 
 var (
@@ -53,7 +52,10 @@ type openAiModelConfig struct {
 	temperature       float32
 	baseURL           string
 	retry             int
+	retryPolicy       RetryPolicy
 	streamingToolCall bool
+	jsonSchema        *bool
+	rateLimit         RateLimit
 }
 
 func WithTemperature(n float32) func(o *openAiModelConfig) {
@@ -68,6 +70,8 @@ func WithMaxToken(n int) func(o *openAiModelConfig) {
 	}
 }
 
+// WithRetry sets the number of retries of a failed call; 0 disables retries.
+// See [WithRetryPolicy] for which errors are retried and how long to wait.
 func WithRetry(n int) func(o *openAiModelConfig) {
 	return func(o *openAiModelConfig) {
 		o.retry = n
@@ -90,21 +94,46 @@ func WithStreamingToolCall() func(o *openAiModelConfig) {
 	}
 }
 
+// WithJSONSchemaSupport declares whether the endpoint accepts a JSON schema response_format
+// (structured output). By default only OpenAIBaseURL and OpenRouterBaseURL are assumed to.
+// See [StructuredOutputModel].
+func WithJSONSchemaSupport(supported bool) func(o *openAiModelConfig) {
+	return func(o *openAiModelConfig) {
+		o.jsonSchema = &supported
+	}
+}
+
+// WithRateLimit limits the calls of the model, see [AcquireRateLimit]. The limit is shared by
+// every model created with the same base URL and model name in the process, so agents and
+// parallel executions using separate model instances do not exceed it together.
+// Each retry counts as a call.
+//
+// Use [NewRateLimitChatModel] with [ModelRateLimitKey] to limit all models of a base URL.
+func WithRateLimit(limit RateLimit) func(o *openAiModelConfig) {
+	return func(o *openAiModelConfig) {
+		o.rateLimit = limit
+	}
+}
+
 // ModelNamer is implemented by chat models that expose their underlying model name.
 type ModelNamer interface {
 	ModelName() string
 }
 
 // OpenAIChatModel is the public concrete type returned by NewOpenAIChatModel.
-// It wraps the internal layered model (retry → contentFix → optionally streamingTool)
+// It wraps the internal layered model (rateLimit → retry → contentFix → optionally streamingTool)
 // and exposes the model name via ModelName().
 type OpenAIChatModel struct {
-	name  string
-	inner model.ToolCallingChatModel
+	name       string
+	jsonSchema bool
+	inner      model.ToolCallingChatModel
 }
 
 func (m *OpenAIChatModel) ModelName() string { return m.name }
 
+// SupportsJSONSchema reports whether the endpoint accepts a JSON schema response_format.
+func (m *OpenAIChatModel) SupportsJSONSchema() bool { return m.jsonSchema }
+
 func (m *OpenAIChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
 	return m.inner.Generate(ctx, input, opts...)
 }
@@ -118,7 +147,7 @@ func (m *OpenAIChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCalling
 	if err != nil {
 		return nil, err
 	}
-	return &OpenAIChatModel{name: m.name, inner: inner}, nil
+	return &OpenAIChatModel{name: m.name, jsonSchema: m.jsonSchema, inner: inner}, nil
 }
 
 // NewOpenAIChatModel creates a new OpenAI-compatible chat model.
@@ -152,6 +181,7 @@ func NewOpenAIChatModel(modelName, apiKey string, ops ...func(o *openAiModelConf
 	}
 
 	cm, err := openai.NewChatModel(context.TODO(), &openai.ChatModelConfig{
+		HTTPClient:          newRetryAfterHTTPClient(),
 		BaseURL:             o.baseURL,
 		APIKey:              apiKey,
 		Model:               modelName,
@@ -162,12 +192,21 @@ func NewOpenAIChatModel(modelName, apiKey string, ops ...func(o *openAiModelConf
 		return nil, err
 	}
 
-	// wrap with retry
 	var result model.ToolCallingChatModel = cm
-	if o.retry > 0 {
+	if o.rateLimit.QPS > 0 || o.rateLimit.MaxConcurrent > 0 {
+		result = NewRateLimitChatModel(result, ModelRateLimitKey(o.baseURL, modelName), o.rateLimit)
+	}
+
+	// wrap with retry
+	policy := o.retryPolicy.withDefaults()
+	if policy.MaxRetries <= 0 {
+		policy.MaxRetries = o.retry
+	}
+	if policy.MaxRetries > 0 || policy.CircuitBreaker != nil {
 		result = &retryChatModel{
-			retry: o.retry,
-			c:     result,
+			policy:  policy,
+			baseURL: o.baseURL,
+			c:       result,
 		}
 	}
 
@@ -179,52 +218,94 @@ func NewOpenAIChatModel(modelName, apiKey string, ops ...func(o *openAiModelConf
 		result = &streamingToolModel{inner: result}
 	}
 
-	return &OpenAIChatModel{name: modelName, inner: result}, nil
+	jsonSchema := o.baseURL == OpenAIBaseURL || o.baseURL == OpenRouterBaseURL
+	if o.jsonSchema != nil {
+		jsonSchema = *o.jsonSchema
+	}
+
+	return &OpenAIChatModel{name: modelName, jsonSchema: jsonSchema, inner: result}, nil
 }
 
+// retryChatModel retries failed calls according to a RetryPolicy.
 type retryChatModel struct {
-	retry int
-	c     model.ToolCallingChatModel
+	policy  RetryPolicy
+	baseURL string // keys the shared circuit breaker
+	c       model.ToolCallingChatModel
 }
 
 func (r *retryChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
-	return retry.GetOneDyn(func() (*schema.Message, error) {
+	return retryCall(ctx, r, func(ctx context.Context) (*schema.Message, error) {
 		return r.c.Generate(ctx, input, opts...)
-	}, func(i int, err error) (wait time.Duration, doRetry bool) {
-		return r.gapFunc(ctx, i, err)
 	})
 }
 
 func (r *retryChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
-	return retry.GetOneDyn(func() (*schema.StreamReader[*schema.Message], error) {
+	return retryCall(ctx, r, func(ctx context.Context) (*schema.StreamReader[*schema.Message], error) {
 		return r.c.Stream(ctx, input, opts...)
-	}, func(i int, err error) (wait time.Duration, doRetry bool) {
-		return r.gapFunc(ctx, i, err)
 	})
 }
 
-func (r *retryChatModel) gapFunc(ctx context.Context, i int, err error) (time.Duration, bool) {
-	// exponential backoff: 1s, 2s, 4s, 8s, capped at 10s
-	wait := time.Duration(1<<uint(i-1)) * time.Second
-	if wait > 10*time.Second {
-		wait = 10 * time.Second
+// retryCall runs call until it succeeds, fails with an error class that is not retried, or the
+// retries are exhausted, in which case the last error is wrapped in a RetryExhaustedError (unless
+// no retry was made at all).
+func retryCall[T any](ctx context.Context, r *retryChatModel, call func(ctx context.Context) (T, error)) (T, error) {
+	var cb *circuitBreaker
+	if r.policy.CircuitBreaker != nil {
+		cb = circuitBreakerFor(r.baseURL)
 	}
-	doRetry := i <= r.retry
-	if doRetry {
-		flow.NewRail(ctx).Warnf("Retrying, i: %v, wait: %v, %v", i, wait, err)
+	for i := 1; ; i++ {
+		if cb != nil && !cb.allow(time.Now()) {
+			var zero T
+			return zero, circuitOpenError(r.baseURL)
+		}
+		hint := &retryAfterHint{}
+		t, err := call(context.WithValue(ctx, retryAfterCtxKey{}, hint))
+		if cb != nil {
+			cb.record(r.policy.CircuitBreaker, err, time.Now())
+		}
+		if err == nil {
+			return t, nil
+		}
+
+		class := ClassifyModelError(err)
+		if ctx.Err() != nil || !r.policy.shouldRetry(class) {
+			return t, err
+		}
+		if i > r.policy.MaxRetries {
+			if i == 1 {
+				// No retry was attempted, e.g. WithRetry(0) with a circuit breaker.
+				return t, err
+			}
+			return t, &RetryExhaustedError{Attempts: i, Err: err}
+		}
+		wait := r.policy.backoff(i)
+		if ra := hint.get(); ra > 0 {
+			if ra > r.policy.MaxRetryAfter {
+				flow.NewRail(ctx).Warnf("Not retrying, Retry-After %v exceeds %v, %v", ra, r.policy.MaxRetryAfter, err)
+				return t, err
+			}
+			wait = ra
+		}
+		flow.NewRail(ctx).Warnf("Retrying, i: %v, class: %v, wait: %v, %v", i, class, wait, err)
+		if err := sleepCtx(ctx, wait); err != nil {
+			return t, err
+		}
 	}
-	return wait, doRetry
 }
 
 func (r *retryChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
-	return r.c.WithTools(tools)
+	c, err := r.c.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &retryChatModel{policy: r.policy, baseURL: r.baseURL, c: c}, nil
 }
 
-// RetryChatModel wraps c with a default retry count of 5.
+// RetryChatModel wraps c with [DefaultRetryPolicy].
 func RetryChatModel(c model.ToolCallingChatModel) model.ToolCallingChatModel {
 	return &retryChatModel{
-		c:     c,
-		retry: defModelRetry,
+		c:      c,
+		policy: DefaultRetryPolicy,
 	}
 }
 
@@ -0,0 +1,126 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+// ModelErrorClass is the category of a failed model call. See [ClassifyModelError].
+type ModelErrorClass string
+
+const (
+	ModelErrorRateLimit       ModelErrorClass = "rate_limit"       // HTTP 429
+	ModelErrorServer          ModelErrorClass = "server"           // HTTP 5xx
+	ModelErrorAuth            ModelErrorClass = "auth"             // HTTP 401, 403
+	ModelErrorBadRequest      ModelErrorClass = "bad_request"      // Other HTTP 4xx; retrying the same request will not succeed
+	ModelErrorContextOverflow ModelErrorClass = "context_overflow" // The prompt exceeds the context window of the model
+	ModelErrorNetwork         ModelErrorClass = "network"          // Connection failures and timeouts of the HTTP client
+	ModelErrorCancelled       ModelErrorClass = "cancelled"        // The context of the call was cancelled
+	ModelErrorCircuitOpen     ModelErrorClass = "circuit_open"     // Not sent: the circuit breaker of the base URL is open, see [CircuitBreakerPolicy]
+	ModelErrorUnknown         ModelErrorClass = "unknown"
+
+	// ModelErrorRetriesExhausted is not returned by ClassifyModelError; it matches errors wrapped
+	// in a [RetryExhaustedError] where a class is expected, e.g. in [WithFallbackOn].
+	ModelErrorRetriesExhausted ModelErrorClass = "retries_exhausted"
+)
+
+// contextOverflowMarkers are lowercase fragments of the error messages providers return when
+// the prompt is too long. They are usually sent with HTTP 400. Each is specific to an overflow:
+// looser fragments like "too many tokens" also match rate limits on tokens per minute.
+var contextOverflowMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",                       // OpenAI, DeepSeek, vLLM, OpenRouter
+	"exceeds the context window",                   // OpenAI Responses
+	"prompt is too long",                           // Anthropic
+	"exceeds the maximum number of tokens allowed", // Gemini
+	"range of input length",                        // DashScope
+}
+
+// RetryExhaustedError is returned by a model created with [WithRetry] when every attempt failed.
+// Err is the error of the last attempt.
+type RetryExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("model call failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryExhaustedError) Unwrap() error { return e.Err }
+
+// IsRetryExhausted reports whether err was returned after all retry attempts failed.
+func IsRetryExhausted(err error) bool {
+	var re *RetryExhaustedError
+	return errors.As(err, &re)
+}
+
+// ModelErrorStatusCode returns the HTTP status code of a failed OpenAI-compatible API call, or 0.
+func ModelErrorStatusCode(err error) int {
+	var apiErr *goopenai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *goopenai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// ClassifyModelError returns the class of an error returned by a chat model call.
+// Errors of OpenAI-compatible APIs are classified by HTTP status code and error message.
+func ClassifyModelError(err error) ModelErrorClass {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return ModelErrorCancelled
+	}
+	var circuitErr *circuitOpenErr
+	if errors.As(err, &circuitErr) {
+		return ModelErrorCircuitOpen
+	}
+	code := ModelErrorStatusCode(err)
+	if code != http.StatusTooManyRequests && isContextOverflow(err) {
+		return ModelErrorContextOverflow
+	}
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ModelErrorRateLimit
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ModelErrorAuth
+	case code >= 500:
+		return ModelErrorServer
+	case code >= 400:
+		return ModelErrorBadRequest
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return ModelErrorNetwork
+	}
+	return ModelErrorUnknown
+}
+
+func isContextOverflow(err error) bool {
+	var apiErr *goopenai.APIError
+	if errors.As(err, &apiErr) {
+		if code, ok := apiErr.Code.(string); ok && code == "context_length_exceeded" {
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range contextOverflowMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
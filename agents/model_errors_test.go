@@ -0,0 +1,56 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+func TestClassifyModelError(t *testing.T) {
+	overflow := func(msg string) error {
+		return &goopenai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: msg}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want ModelErrorClass
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "rate limit", err: apiError(http.StatusTooManyRequests), want: ModelErrorRateLimit},
+		{name: "rate limit on tokens per minute", err: &goopenai.APIError{HTTPStatusCode: http.StatusTooManyRequests,
+			Message: "Rate limit reached: too many tokens per minute, the maximum context length does not matter"}, want: ModelErrorRateLimit},
+		{name: "unauthorized", err: apiError(http.StatusUnauthorized), want: ModelErrorAuth},
+		{name: "forbidden", err: apiError(http.StatusForbidden), want: ModelErrorAuth},
+		{name: "server", err: apiError(http.StatusServiceUnavailable), want: ModelErrorServer},
+		{name: "request error", err: &goopenai.RequestError{HTTPStatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}, want: ModelErrorServer},
+		{name: "bad request", err: apiError(http.StatusBadRequest), want: ModelErrorBadRequest},
+		{name: "bad request mentioning tokens", err: overflow("max_tokens is too large: too many tokens requested"), want: ModelErrorBadRequest},
+		{name: "bad request mentioning context length", err: overflow("invalid context length parameter"), want: ModelErrorBadRequest},
+		{name: "overflow code", err: &goopenai.APIError{HTTPStatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}, want: ModelErrorContextOverflow},
+		{name: "overflow openai", err: overflow("This model's maximum context length is 128000 tokens. However, your messages resulted in 130000 tokens."), want: ModelErrorContextOverflow},
+		{name: "overflow anthropic", err: overflow("prompt is too long: 210000 tokens > 200000 maximum"), want: ModelErrorContextOverflow},
+		{name: "overflow gemini", err: overflow("The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."), want: ModelErrorContextOverflow},
+		{name: "overflow dashscope", err: overflow("Range of input length should be [1, 30720]"), want: ModelErrorContextOverflow},
+		{name: "overflow wrapped", err: fmt.Errorf("call failed: %w", overflow("Prompt is too long")), want: ModelErrorContextOverflow},
+		{name: "cancelled", err: fmt.Errorf("call failed: %w", context.Canceled), want: ModelErrorCancelled},
+		{name: "deadline", err: context.DeadlineExceeded, want: ModelErrorNetwork},
+		{name: "net error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: ModelErrorNetwork},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: ModelErrorNetwork},
+		{name: "circuit open", err: circuitOpenError("http://x"), want: ModelErrorCircuitOpen},
+		{name: "retries exhausted", err: &RetryExhaustedError{Attempts: 3, Err: apiError(http.StatusTooManyRequests)}, want: ModelErrorRateLimit},
+		{name: "unknown", err: errors.New("something odd"), want: ModelErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyModelError(tt.err); got != tt.want {
+				t.Errorf("ClassifyModelError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
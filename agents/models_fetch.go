@@ -3,6 +3,7 @@ package agents
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/curtisnewbie/miso/errs"
@@ -17,6 +18,24 @@ type modelsDevEntry struct {
 	Limit struct {
 		Context int `json:"context"`
 	} `json:"limit"`
+	Cost *struct {
+		Input     float64 `json:"input"`
+		Output    float64 `json:"output"`
+		CacheRead float64 `json:"cache_read"`
+	} `json:"cost"`
+}
+
+// rank orders the entries of a model listed by several providers: an entry with both a price and
+// a context window first, then one with a price, then one with a context window only.
+func (m modelsDevEntry) rank() int {
+	r := 0
+	if m.Cost != nil && (m.Cost.Input > 0 || m.Cost.Output > 0) {
+		r += 2
+	}
+	if m.Limit.Context > 0 {
+		r++
+	}
+	return r
 }
 
 type modelsDevProvider struct {
@@ -25,6 +44,8 @@ type modelsDevProvider struct {
 
 var modelCache = hash.NewStrRWMap[int]()
 
+var priceCache = hash.NewStrRWMap[ModelPrice]()
+
 var modelsDevClient = &http.Client{Timeout: 5 * time.Second}
 
 // LookupModelContextWindow returns the context window size for a model.
@@ -41,40 +62,93 @@ func LookupModelContextWindow(rail flow.Rail, modelName string, enableFetch bool
 	if !enableFetch {
 		return 0, false
 	}
-	fetched, err := fetchModelContextWindows()
+	windows, _, err := fetchModelsDev()
 	if err != nil {
 		rail.Errorf("models_fetch: failed to fetch model context windows: %v", err)
 		return 0, false
 	}
-	for k, v := range fetched {
-		modelCache.Put(k, v)
-	}
-	n, ok := fetched[modelName]
+	n, ok := windows[modelName]
 	return n, ok
 }
 
-func fetchModelContextWindows() (map[string]int, error) {
+// LookupModelPrice returns the price of a model in USD per million tokens.
+// First checks the build-time generated map (ModelPriceTable), then the
+// process-level in-memory cache. If not found and enableFetch is true,
+// fetches from models.dev and populates the cache.
+func LookupModelPrice(rail flow.Rail, modelName string, enableFetch bool) (ModelPrice, bool) {
+	if p, ok := ModelPriceTable[modelName]; ok {
+		return p, true
+	}
+	if p, ok := priceCache.Get(modelName); ok {
+		return p, true
+	}
+	if !enableFetch {
+		return ModelPrice{}, false
+	}
+	_, prices, err := fetchModelsDev()
+	if err != nil {
+		rail.Errorf("models_fetch: failed to fetch model prices: %v", err)
+		return ModelPrice{}, false
+	}
+	p, ok := prices[modelName]
+	return p, ok
+}
+
+// fetchModelsDev fetches models.dev, populates the caches, and returns the context windows and prices.
+func fetchModelsDev() (map[string]int, map[string]ModelPrice, error) {
 	resp, err := modelsDevClient.Get(modelsDevURL) //nolint:gosec
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, nil, errs.Wrap(err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, errs.NewErrf("models.dev returned status %d", resp.StatusCode)
+		return nil, nil, errs.NewErrf("models.dev returned status %d", resp.StatusCode)
 	}
 
 	var providers map[string]modelsDevProvider
 	if err := json.NewDecoder(resp.Body).Decode(&providers); err != nil {
-		return nil, errs.Wrap(err)
+		return nil, nil, errs.Wrap(err)
 	}
 
-	result := make(map[string]int)
-	for _, p := range providers {
-		for _, m := range p.Models {
-			if m.ID != "" && m.Limit.Context > 0 {
-				result[m.ID] = m.Limit.Context
+	// A model listed by several providers takes its context window and price from the same entry:
+	// the best ranked one, the first by provider name among equals, like script/gen_models.go.
+	chosen := make(map[string]modelsDevEntry)
+	for _, name := range sortedKeys(providers) {
+		p := providers[name]
+		for _, key := range sortedKeys(p.Models) {
+			m := p.Models[key]
+			if m.ID == "" || m.rank() == 0 {
+				continue
+			}
+			if c, ok := chosen[m.ID]; !ok || m.rank() > c.rank() {
+				chosen[m.ID] = m
 			}
 		}
 	}
-	return result, nil
+	windows := make(map[string]int)
+	prices := make(map[string]ModelPrice)
+	for id, m := range chosen {
+		if m.Limit.Context > 0 {
+			windows[id] = m.Limit.Context
+		}
+		if m.rank() >= 2 {
+			prices[id] = ModelPrice{Input: m.Cost.Input, Output: m.Cost.Output, CacheRead: m.Cost.CacheRead}
+		}
+	}
+	for k, v := range windows {
+		modelCache.Put(k, v)
+	}
+	for k, v := range prices {
+		priceCache.Put(k, v)
+	}
+	return windows, prices, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
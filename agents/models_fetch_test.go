@@ -0,0 +1,44 @@
+package agents
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestFetchModelsDev_DuplicateIDs(t *testing.T) {
+	body := `{
+		"a-provider": {"models": {
+			"m1": {"id": "shared", "limit": {"context": 8000}},
+			"m2": {"id": "only-window", "limit": {"context": 1000}}
+		}},
+		"b-provider": {"models": {
+			"m1": {"id": "shared", "limit": {"context": 128000}, "cost": {"input": 1, "output": 2}}
+		}},
+		"c-provider": {"models": {
+			"m1": {"id": "shared", "limit": {"context": 64000}, "cost": {"input": 5, "output": 10}}
+		}}
+	}`
+	old := modelsDevClient
+	defer func() { modelsDevClient = old }()
+	modelsDevClient = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})}
+
+	windows, prices, err := fetchModelsDev()
+	if err != nil {
+		t.Fatalf("fetchModelsDev() error = %v", err)
+	}
+	// The window and the price of "shared" come from the same entry: the first priced one.
+	if windows["shared"] != 128000 || prices["shared"] != (ModelPrice{Input: 1, Output: 2}) {
+		t.Errorf("shared: window %d, price %+v; want 128000 and the b-provider price", windows["shared"], prices["shared"])
+	}
+	if _, ok := prices["only-window"]; ok || windows["only-window"] != 1000 {
+		t.Errorf("only-window: window %d, price found %v", windows["only-window"], ok)
+	}
+}
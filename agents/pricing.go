@@ -0,0 +1,22 @@
+package agents
+
+// ModelPrice is the price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input     float64 // Prompt tokens not served from cache
+	Output    float64 // Completion tokens
+	CacheRead float64 // Prompt tokens served from cache; if 0, Input is used
+}
+
+// Cost returns the estimated cost in USD of a call with the given token counts.
+// cached is the part of prompt served from cache, as reported by the provider.
+func (p ModelPrice) Cost(prompt, completion, cached int) float64 {
+	cacheRead := p.CacheRead
+	if cacheRead == 0 {
+		cacheRead = p.Input
+	}
+	uncached := prompt - cached
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.Input + float64(cached)*cacheRead + float64(completion)*p.Output) / 1_000_000
+}
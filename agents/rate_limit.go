@@ -0,0 +1,257 @@
+package agents
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/curtisnewbie/miso/flow"
+	"github.com/curtisnewbie/miso/middleware/redis"
+)
+
+// RateLimit limits the calls made under a key, see [AcquireRateLimit].
+type RateLimit struct {
+	QPS           float64 // Calls started per second; 0 means unlimited
+	Burst         int     // Calls that may start at once after being idle; defaults to 1, so calls are spaced 1/QPS apart
+	MaxConcurrent int     // Calls in flight at once; 0 means unlimited
+
+	// Redis enforces QPS across processes with miso's redis rate limiter (Burst is ignored).
+	// Redis must be initialized via miso's redis middleware. MaxConcurrent is always per process.
+	// If Redis fails, the process-local QPS limit is used instead.
+	Redis bool
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return 1
+}
+
+// rateLimiter enforces one RateLimit, shared by every caller using the same key.
+type rateLimiter struct {
+	key   string
+	limit RateLimit
+	sem   chan struct{} // nil if MaxConcurrent is unlimited
+
+	mu  sync.Mutex
+	tat time.Time // theoretical arrival time of the next call (GCRA)
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rateLimiter{}
+)
+
+// rateLimiterFor returns the process-wide limiter of key. The limit of a key is fixed by its
+// first use; later callers share it regardless of the limit they pass.
+func rateLimiterFor(key string, limit RateLimit) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	l, ok := rateLimiters[key]
+	if !ok {
+		l = &rateLimiter{key: key, limit: limit}
+		if limit.MaxConcurrent > 0 {
+			l.sem = make(chan struct{}, limit.MaxConcurrent)
+		}
+		rateLimiters[key] = l
+	}
+	return l
+}
+
+// AcquireRateLimit waits until a call under key is allowed by limit, and returns a func that
+// must be called once the call completes. Limits are shared by every caller in the process
+// using the same key (and across processes when RateLimit.Redis is set), e.g. all agents
+// calling the same model or tool. The limit of a key is fixed by its first use.
+//
+// Returns ctx.Err() if ctx is done before the call is allowed.
+func AcquireRateLimit(ctx context.Context, key string, limit RateLimit) (release func(), err error) {
+	if limit.QPS <= 0 && limit.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	l := rateLimiterFor(key, limit)
+	start := time.Now()
+
+	release = func() {}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-l.sem }) }
+	}
+
+	if l.limit.QPS > 0 {
+		if err := l.waitQPS(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	if waited := time.Since(start); waited >= time.Second {
+		flow.NewRail(ctx).Debugf("Rate limited, key: %v, waited: %v", key, waited)
+	}
+	return release, nil
+}
+
+func (l *rateLimiter) waitQPS(ctx context.Context) error {
+	if l.limit.Redis {
+		err := l.waitRedisQPS(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		flow.NewRail(ctx).Warnf("Redis rate limiter failed, using process-local limit, key: %v, %v", l.key, err)
+	}
+	if err := sleepCtx(ctx, l.reserve(time.Now())); err != nil {
+		// The call will not be made; give its slot back to the callers after it.
+		l.unreserve()
+		return err
+	}
+	return nil
+}
+
+func (l *rateLimiter) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.limit.QPS)
+}
+
+// reserve reserves the next call slot and returns how long to wait before it starts.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	interval := l.interval()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	allowAt := tat.Add(-time.Duration(l.limit.burst()-1) * interval)
+	l.tat = tat.Add(interval)
+	if allowAt.Before(now) {
+		return 0
+	}
+	return allowAt.Sub(now)
+}
+
+// unreserve cancels a slot taken by reserve.
+func (l *rateLimiter) unreserve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tat = l.tat.Add(-l.interval())
+}
+
+// waitRedisQPS polls miso's redis rate limiter until a call is allowed.
+func (l *rateLimiter) waitRedisQPS(ctx context.Context) error {
+	n, period := 1, time.Duration(float64(time.Second)/l.limit.QPS)
+	if l.limit.QPS >= 1 {
+		n, period = int(math.Round(l.limit.QPS)), time.Second
+	}
+	rl := redis.NewRateLimiter("miso-agent:ratelimit:"+l.key, n, period)
+	poll := max(period/time.Duration(n), 10*time.Millisecond)
+	for {
+		ok, err := rl.Acquire()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if err := sleepCtx(ctx, poll); err != nil {
+			return err
+		}
+	}
+}
+
+// ModelRateLimitKey returns the rate limit key used by [WithRateLimit] for modelName at
+// baseURL. Pass an empty modelName to get a key shared by all models of the base URL.
+func ModelRateLimitKey(baseURL, modelName string) string {
+	if modelName == "" {
+		return "model:" + baseURL
+	}
+	return "model:" + baseURL + ":" + modelName
+}
+
+// rateLimitChatModel acquires a rate limit before every call of the inner model.
+type rateLimitChatModel struct {
+	key   string
+	limit RateLimit
+	inner model.ToolCallingChatModel
+}
+
+// NewRateLimitChatModel wraps m so that every call waits for the rate limit of key, see
+// [AcquireRateLimit]. For Stream, the concurrency slot is held until the stream is fully
+// received or closed.
+//
+// Use [ModelRateLimitKey] to share the limit with models created with [WithRateLimit].
+//
+// Example:
+//
+//	// at most 5 requests per second to DeepSeek, whichever model is used
+//	key := agents.ModelRateLimitKey(agents.DeepseekBaseURL, "")
+//	m = agents.NewRateLimitChatModel(m, key, agents.RateLimit{QPS: 5})
+func NewRateLimitChatModel(m model.ToolCallingChatModel, key string, limit RateLimit) model.ToolCallingChatModel {
+	return &rateLimitChatModel{key: key, limit: limit, inner: m}
+}
+
+// ModelName returns the name of the inner model, or "" if it does not implement [ModelNamer].
+func (r *rateLimitChatModel) ModelName() string {
+	if namer, ok := r.inner.(ModelNamer); ok {
+		return namer.ModelName()
+	}
+	return ""
+}
+
+// SupportsJSONSchema reports whether the inner model accepts a JSON schema response_format.
+func (r *rateLimitChatModel) SupportsJSONSchema() bool {
+	return SupportsJSONSchema(r.inner)
+}
+
+func (r *rateLimitChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	release, err := AcquireRateLimit(ctx, r.key, r.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return r.inner.Generate(ctx, input, opts...)
+}
+
+func (r *rateLimitChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	release, err := AcquireRateLimit(ctx, r.key, r.limit)
+	if err != nil {
+		return nil, err
+	}
+	sr, err := r.inner.Stream(ctx, input, opts...)
+	if err != nil || r.limit.MaxConcurrent <= 0 {
+		release()
+		return sr, err
+	}
+
+	out, w := schema.Pipe[*schema.Message](0)
+	go func() {
+		defer release()
+		defer sr.Close()
+		defer w.Close()
+		for {
+			msg, err := sr.Recv()
+			if err == io.EOF {
+				return
+			}
+			if closed := w.Send(msg, err); closed || err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (r *rateLimitChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	inner, err := r.inner.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitChatModel{key: r.key, limit: r.limit, inner: inner}, nil
+}
@@ -0,0 +1,41 @@
+package agents
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	l := &rateLimiter{key: "test", limit: RateLimit{QPS: 2, Burst: 2}}
+	now := time.Now()
+
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got := l.reserve(now); got != want {
+			t.Errorf("reserve() #%d = %v, want %v", i+1, got, want)
+		}
+	}
+	// After being idle, the burst is available again.
+	if got := l.reserve(now.Add(10 * time.Second)); got != 0 {
+		t.Errorf("reserve() after idle = %v, want 0", got)
+	}
+}
+
+func TestRateLimiter_CancelledWaitGivesBackSlot(t *testing.T) {
+	l := &rateLimiter{key: "test", limit: RateLimit{QPS: 1}}
+	if err := l.waitQPS(context.Background()); err != nil {
+		t.Fatalf("waitQPS() error = %v", err)
+	}
+
+	// The second call would wait ~1s, but its context is done first.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.waitQPS(ctx); err == nil {
+		t.Fatal("waitQPS() should fail when ctx is done before the slot")
+	}
+
+	// The cancelled call does not push back the next one.
+	if got := l.reserve(time.Now()); got > time.Second {
+		t.Errorf("reserve() after a cancelled wait = %v, want <= 1s", got)
+	}
+}
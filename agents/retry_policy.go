@@ -0,0 +1,276 @@
+package agents
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/curtisnewbie/miso/errs"
+)
+
+// RetryPolicy controls how a model created by [NewOpenAIChatModel] retries failed calls.
+// Errors are classified with [ClassifyModelError]. Zero fields take the defaults of [DefaultRetryPolicy].
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt; if 0, the value of WithRetry (default 5) is used
+	BaseDelay  time.Duration // Delay before the first retry; doubled for every further retry
+	MaxDelay   time.Duration // Cap of the exponential delay
+
+	// Jitter randomizes each delay by up to ±Jitter of its value, e.g. 0.2 for ±20%,
+	// so concurrent callers do not retry in lockstep. Negative disables jitter.
+	Jitter float64
+
+	// RetryOn lists the error classes that are retried. Other errors, e.g. bad requests or
+	// context overflows that would fail again, are returned right away.
+	RetryOn []ModelErrorClass
+
+	// MaxRetryAfter caps the delay requested by a Retry-After header. A longer delay is not
+	// waited for: the call fails with its rate limit or server error instead.
+	MaxRetryAfter time.Duration
+
+	// CircuitBreaker, if set, opens a circuit breaker shared by all models with the same base URL.
+	CircuitBreaker *CircuitBreakerPolicy
+}
+
+// CircuitBreakerPolicy configures the circuit breaker of a [RetryPolicy].
+//
+// After FailureThreshold consecutive rate limit, server or network errors, calls to the base URL
+// fail right away with [ModelErrorCircuitOpen] for OpenDuration. Then one trial call is let
+// through; it closes the breaker on success and opens it again on failure.
+type CircuitBreakerPolicy struct {
+	FailureThreshold int           // Defaults to 5
+	OpenDuration     time.Duration // Defaults to 30s
+}
+
+// DefaultRetryPolicy is used by [NewOpenAIChatModel] when no [WithRetryPolicy] is given.
+// It retries 5 times with 1s, 2s, 4s, 8s, 10s (±20%) between attempts, honors Retry-After
+// up to 60s, and has no circuit breaker.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    defModelRetry,
+	BaseDelay:     time.Second,
+	MaxDelay:      10 * time.Second,
+	Jitter:        0.2,
+	RetryOn:       []ModelErrorClass{ModelErrorRateLimit, ModelErrorServer, ModelErrorNetwork, ModelErrorUnknown},
+	MaxRetryAfter: time.Minute,
+}
+
+// WithRetryPolicy sets the retry policy of the model. See [RetryPolicy].
+func WithRetryPolicy(p RetryPolicy) func(o *openAiModelConfig) {
+	return func(o *openAiModelConfig) {
+		o.retryPolicy = p
+	}
+}
+
+// withDefaults returns p with zero fields set from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = d.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = d.MaxDelay
+	}
+	if p.Jitter == 0 {
+		p.Jitter = d.Jitter
+	}
+	if len(p.RetryOn) == 0 {
+		p.RetryOn = d.RetryOn
+	}
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = d.MaxRetryAfter
+	}
+	if cb := p.CircuitBreaker; cb != nil {
+		c := *cb
+		if c.FailureThreshold <= 0 {
+			c.FailureThreshold = 5
+		}
+		if c.OpenDuration <= 0 {
+			c.OpenDuration = 30 * time.Second
+		}
+		p.CircuitBreaker = &c
+	}
+	return p
+}
+
+// backoff returns the delay before retry i (1-based), with jitter.
+func (p RetryPolicy) backoff(i int) time.Duration {
+	wait := p.BaseDelay << uint(min(i-1, 30))
+	if wait > p.MaxDelay || wait <= 0 {
+		wait = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		wait = time.Duration(float64(wait) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return wait
+}
+
+// shouldRetry reports whether a call failing with class may be retried.
+func (p RetryPolicy) shouldRetry(class ModelErrorClass) bool {
+	return slices.Contains(p.RetryOn, class)
+}
+
+// retryAfterCtxKey holds the *retryAfterHint of the current attempt in the request context.
+type retryAfterCtxKey struct{}
+
+// retryAfterHint receives the delay requested by the provider in a Retry-After header.
+type retryAfterHint struct {
+	mu   sync.Mutex
+	wait time.Duration
+}
+
+func (h *retryAfterHint) set(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.wait = d
+}
+
+func (h *retryAfterHint) get() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.wait
+}
+
+// retryAfterTransport records the Retry-After header of 429 and 503 responses in the
+// retryAfterHint of the request context, if any.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if h, ok := req.Context().Value(retryAfterCtxKey{}).(*retryAfterHint); ok {
+			h.set(parseRetryAfter(resp.Header, time.Now()))
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter returns the delay requested by the retry-after-ms or Retry-After header,
+// the latter in seconds or as an HTTP date. It returns 0 if neither is present or valid.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.ParseFloat(v, 64); err == nil {
+		if sec <= 0 {
+			return 0
+		}
+		return time.Duration(sec * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// newRetryAfterHTTPClient returns an HTTP client that records Retry-After headers for the retry policy.
+func newRetryAfterHTTPClient() *http.Client {
+	return &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+}
+
+// circuitBreaker tracks consecutive failures of one base URL.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // a trial call is in flight after the open period
+}
+
+var (
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   = map[string]*circuitBreaker{}
+)
+
+// circuitBreakerFor returns the process-wide circuit breaker of baseURL.
+func circuitBreakerFor(baseURL string) *circuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	cb, ok := circuitBreakers[baseURL]
+	if !ok {
+		cb = &circuitBreaker{}
+		circuitBreakers[baseURL] = cb
+	}
+	return cb
+}
+
+// allow reports whether a call may be made now. Once the open period has passed, only one
+// trial call is allowed until its outcome is recorded.
+func (c *circuitBreaker) allow(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(c.openUntil) || c.trial {
+		return false
+	}
+	c.trial = true
+	return true
+}
+
+// record records the outcome of a call; err is nil on success.
+func (c *circuitBreaker) record(p *CircuitBreakerPolicy, err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.failures = 0
+		c.openUntil = time.Time{}
+		c.trial = false
+		return
+	}
+	switch ClassifyModelError(err) {
+	case ModelErrorRateLimit, ModelErrorServer, ModelErrorNetwork:
+	case ModelErrorCancelled:
+		// Says nothing about the provider; let another trial call through.
+		c.trial = false
+		return
+	default:
+		// The provider is reachable; errors caused by the request itself do not count.
+		if c.trial {
+			c.failures = 0
+			c.openUntil = time.Time{}
+			c.trial = false
+		}
+		return
+	}
+	c.failures++
+	if c.trial || c.failures >= p.FailureThreshold {
+		c.openUntil = now.Add(p.OpenDuration)
+		c.trial = false
+	}
+}
+
+// circuitOpenError is returned without calling the provider while the circuit breaker is open.
+func circuitOpenError(baseURL string) error {
+	return &circuitOpenErr{err: errs.NewErrf("circuit breaker open for %v", baseURL)}
+}
+
+type circuitOpenErr struct{ err error }
+
+func (e *circuitOpenErr) Error() string { return e.err.Error() }
+func (e *circuitOpenErr) Unwrap() error { return e.err }
+
+// sleepCtx waits for d, returning early with the context error if ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,185 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	goopenai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+// stubChatModel fails with errs in turn, then succeeds.
+type stubChatModel struct {
+	errs  []error
+	calls int
+}
+
+func (m *stubChatModel) Generate(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.calls <= len(m.errs) {
+		return nil, m.errs[m.calls-1]
+	}
+	return schema.AssistantMessage("ok", nil), nil
+}
+
+func (m *stubChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+func (m *stubChatModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func apiError(status int) error {
+	return &goopenai.APIError{HTTPStatusCode: status, Message: http.StatusText(status)}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	p := RetryPolicy{}.withDefaults()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limit", err: apiError(http.StatusTooManyRequests), want: true},
+		{name: "server", err: apiError(http.StatusBadGateway), want: true},
+		{name: "network", err: context.DeadlineExceeded, want: true},
+		{name: "unknown", err: errors.New("something odd"), want: true},
+		{name: "bad request", err: apiError(http.StatusBadRequest), want: false},
+		{name: "auth", err: apiError(http.StatusUnauthorized), want: false},
+		{name: "context overflow", err: &goopenai.APIError{HTTPStatusCode: 400, Code: "context_length_exceeded"}, want: false},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "circuit open", err: circuitOpenError("http://x"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.shouldRetry(ClassifyModelError(tt.err)); got != tt.want {
+				t.Errorf("shouldRetry(%v) = %v, want %v", ClassifyModelError(tt.err), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{name: "none", want: 0},
+		{name: "seconds", header: map[string]string{"Retry-After": "3"}, want: 3 * time.Second},
+		{name: "fractional seconds", header: map[string]string{"Retry-After": "1.5"}, want: 1500 * time.Millisecond},
+		{name: "http date", header: map[string]string{"Retry-After": now.Add(10 * time.Second).Format(http.TimeFormat)}, want: 10 * time.Second},
+		{name: "date in the past", header: map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, want: 0},
+		{name: "negative", header: map[string]string{"Retry-After": "-1"}, want: 0},
+		{name: "garbage", header: map[string]string{"Retry-After": "soon"}, want: 0},
+		{name: "milliseconds", header: map[string]string{"retry-after-ms": "250"}, want: 250 * time.Millisecond},
+		{name: "milliseconds first", header: map[string]string{"retry-after-ms": "250", "Retry-After": "3"}, want: 250 * time.Millisecond},
+		{name: "invalid milliseconds", header: map[string]string{"retry-after-ms": "x", "Retry-After": "3"}, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			if got := parseRetryAfter(h, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	p := &CircuitBreakerPolicy{FailureThreshold: 2, OpenDuration: time.Minute}
+	cb := &circuitBreaker{}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	serverErr := apiError(http.StatusInternalServerError)
+
+	// Closed: errors caused by the request do not count.
+	cb.record(p, serverErr, now)
+	cb.record(p, apiError(http.StatusBadRequest), now)
+	if !cb.allow(now) {
+		t.Fatal("breaker opened below the threshold")
+	}
+	cb.record(p, serverErr, now)
+	if cb.allow(now) {
+		t.Fatal("breaker still closed after 2 consecutive server errors")
+	}
+	if cb.allow(now.Add(59 * time.Second)) {
+		t.Fatal("breaker allowed a call before OpenDuration passed")
+	}
+
+	// Half-open: one trial call, which fails and opens it again.
+	later := now.Add(time.Minute)
+	if !cb.allow(later) {
+		t.Fatal("breaker did not allow a trial call after OpenDuration")
+	}
+	if cb.allow(later) {
+		t.Fatal("breaker allowed a second call while the trial is in flight")
+	}
+	cb.record(p, serverErr, later)
+	if cb.allow(later.Add(59 * time.Second)) {
+		t.Fatal("failed trial did not open the breaker again")
+	}
+
+	// Half-open again: a cancelled trial lets another one through, a successful one closes it.
+	later = later.Add(time.Minute)
+	if !cb.allow(later) {
+		t.Fatal("breaker did not allow a trial call after OpenDuration")
+	}
+	cb.record(p, context.Canceled, later)
+	if !cb.allow(later) {
+		t.Fatal("breaker did not allow another trial after a cancelled one")
+	}
+	cb.record(p, nil, later)
+	if !cb.allow(later) || !cb.allow(later) {
+		t.Fatal("successful trial did not close the breaker")
+	}
+}
+
+func TestRetryCall(t *testing.T) {
+	fastPolicy := func(maxRetries int, cb *CircuitBreakerPolicy) RetryPolicy {
+		return RetryPolicy{MaxRetries: maxRetries, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Jitter: -1, CircuitBreaker: cb}.withDefaults()
+	}
+	serverErr := apiError(http.StatusInternalServerError)
+
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		errs          []error
+		wantCalls     int
+		wantErr       bool
+		wantExhausted bool
+	}{
+		{name: "recovers", policy: fastPolicy(2, nil), errs: []error{serverErr}, wantCalls: 2},
+		{name: "exhausted", policy: fastPolicy(2, nil), errs: []error{serverErr, serverErr, serverErr}, wantCalls: 3, wantErr: true, wantExhausted: true},
+		{name: "not retried", policy: fastPolicy(2, nil), errs: []error{apiError(http.StatusBadRequest)}, wantCalls: 1, wantErr: true},
+		{name: "no retries with circuit breaker", policy: fastPolicy(0, &CircuitBreakerPolicy{}), errs: []error{serverErr}, wantCalls: 1, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &stubChatModel{errs: tt.errs}
+			r := &retryChatModel{policy: tt.policy, baseURL: "http://retry-call-test/" + string(rune('a'+i)), c: m}
+			_, err := r.Generate(context.Background(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if IsRetryExhausted(err) != tt.wantExhausted {
+				t.Errorf("IsRetryExhausted(%v) = %v, want %v", err, IsRetryExhausted(err), tt.wantExhausted)
+			}
+			if m.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", m.calls, tt.wantCalls)
+			}
+		})
+	}
+}
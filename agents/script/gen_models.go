@@ -1,6 +1,6 @@
 //go:build ignore
 
-// Fetches https://models.dev/api.json and regenerates agents/models_gen.go.
+// Fetches https://models.dev/api.json and regenerates agents/models_gen.go and agents/models_price_gen.go.
 // Usage: go run agents/script/gen_models.go
 package main
 
@@ -23,6 +23,28 @@ type modelEntry struct {
 	Limit struct {
 		Context int `json:"context"`
 	} `json:"limit"`
+	Cost *struct {
+		Input     float64 `json:"input"`
+		Output    float64 `json:"output"`
+		CacheRead float64 `json:"cache_read"`
+	} `json:"cost"`
+}
+
+// rank orders the entries of a model listed by several providers: an entry with both a price and
+// a context window first, then one with a price, then one with a context window only.
+func (m modelEntry) rank() int {
+	r := 0
+	if m.Cost != nil && (m.Cost.Input > 0 || m.Cost.Output > 0) {
+		r += 2
+	}
+	if m.Limit.Context > 0 {
+		r++
+	}
+	return r
+}
+
+type price struct {
+	input, output, cacheRead float64
 }
 
 type provider struct {
@@ -54,20 +76,33 @@ func main() {
 		os.Exit(1)
 	}
 
-	entries := make(map[string]int)
-	for _, p := range providers {
-		for _, m := range p.Models {
-			if m.ID != "" && m.Limit.Context > 0 {
-				entries[m.ID] = m.Limit.Context
+	// A model listed by several providers takes its context window and price from the same entry:
+	// the best ranked one, the first by provider name among equals, like agents/models_fetch.go.
+	chosen := make(map[string]modelEntry)
+	for _, name := range sortedKeys(providers) {
+		models := providers[name].Models
+		for _, key := range sortedKeys(models) {
+			m := models[key]
+			if m.ID == "" || m.rank() == 0 {
+				continue
+			}
+			if c, ok := chosen[m.ID]; !ok || m.rank() > c.rank() {
+				chosen[m.ID] = m
 			}
 		}
 	}
-
-	keys := make([]string, 0, len(entries))
-	for k := range entries {
-		keys = append(keys, k)
+	entries := make(map[string]int)
+	prices := make(map[string]price)
+	for id, m := range chosen {
+		if m.Limit.Context > 0 {
+			entries[id] = m.Limit.Context
+		}
+		if m.rank() >= 2 {
+			prices[id] = price{input: m.Cost.Input, output: m.Cost.Output, cacheRead: m.Cost.CacheRead}
+		}
 	}
-	sort.Strings(keys)
+
+	keys := sortedKeys(entries)
 
 	var sb strings.Builder
 	sb.WriteString("// Code generated by script/gen_models.go. DO NOT EDIT.\n")
@@ -78,19 +113,50 @@ func main() {
 	sb.WriteString("// Used to auto-detect MaxTokens when not explicitly configured.\n")
 	sb.WriteString("var ModelContextWindow = map[string]int{\n")
 	for _, k := range keys {
-		escaped := strings.ReplaceAll(k, `\`, `\\`)
-		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
-		fmt.Fprintf(&sb, "\t\"%s\": %d,\n", escaped, entries[k])
+		fmt.Fprintf(&sb, "\t\"%s\": %d,\n", escapeKey(k), entries[k])
 	}
 	sb.WriteString("}\n")
+	writeOutput("models_gen.go", sb.String(), len(keys))
+
+	priceKeys := sortedKeys(prices)
+	sb.Reset()
+	sb.WriteString("// Code generated by script/gen_models.go. DO NOT EDIT.\n")
+	sb.WriteString("// To regenerate: go run agents/script/gen_models.go\n")
+	sb.WriteString("// Source: https://models.dev/api.json\n")
+	sb.WriteString("package agents\n\n")
+	sb.WriteString("// ModelPriceTable maps model IDs to their price in USD per million tokens.\n")
+	sb.WriteString("// Used to estimate TokenUsage.Cost when no price is explicitly configured.\n")
+	sb.WriteString("var ModelPriceTable = map[string]ModelPrice{\n")
+	for _, k := range priceKeys {
+		p := prices[k]
+		fmt.Fprintf(&sb, "\t\"%s\": {Input: %v, Output: %v, CacheRead: %v},\n", escapeKey(k), p.input, p.output, p.cacheRead)
+	}
+	sb.WriteString("}\n")
+	writeOutput("models_price_gen.go", sb.String(), len(priceKeys))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escapeKey(k string) string {
+	escaped := strings.ReplaceAll(k, `\`, `\\`)
+	return strings.ReplaceAll(escaped, `"`, `\"`)
+}
 
-	// resolve output path relative to this file's location
+// writeOutput writes content to agents/{name}, resolved relative to this file's location.
+func writeOutput(name, content string, n int) {
 	_, thisFile, _, _ := runtime.Caller(0)
-	outPath := filepath.Join(filepath.Dir(thisFile), "..", "models_gen.go")
+	outPath := filepath.Join(filepath.Dir(thisFile), "..", name)
 
-	if err := os.WriteFile(outPath, []byte(sb.String()), 0644); err != nil {
+	if err := os.WriteFile(outPath, []byte(content), 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "write %s: %v\n", outPath, err)
 		os.Exit(1)
 	}
-	fmt.Printf("wrote %d entries to %s\n", len(keys), outPath)
+	fmt.Printf("wrote %d entries to %s\n", n, outPath)
 }
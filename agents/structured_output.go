@@ -0,0 +1,35 @@
+package agents
+
+import (
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/eino-contrib/jsonschema"
+)
+
+// StructuredOutputModel is implemented by chat models that can constrain their answer to a JSON
+// schema sent as the response_format of the call. See [WithJSONSchemaResponseFormat].
+type StructuredOutputModel interface {
+	SupportsJSONSchema() bool
+}
+
+// SupportsJSONSchema reports whether m implements [StructuredOutputModel] and accepts a JSON schema.
+func SupportsJSONSchema(m model.BaseChatModel) bool {
+	so, ok := m.(StructuredOutputModel)
+	return ok && so.SupportsJSONSchema()
+}
+
+// WithJSONSchemaResponseFormat returns a call option for OpenAI-compatible models that asks the
+// model to answer with JSON matching schema. name identifies the schema, e.g. the Go type name.
+// Only use it with models whose [StructuredOutputModel.SupportsJSONSchema] is true.
+func WithJSONSchemaResponseFormat(name string, schema *jsonschema.Schema) model.Option {
+	return openai.WithExtraFields(map[string]any{
+		"response_format": map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   name,
+				"schema": schema,
+				"strict": false,
+			},
+		},
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"slices"
 	"time"
 
+	"github.com/curtisnewbie/miso-agent/agentloop"
 	"github.com/curtisnewbie/miso-agent/agents"
 	"github.com/curtisnewbie/miso/middleware/redis"
 	"github.com/curtisnewbie/miso/miso"
@@ -82,6 +83,7 @@ type TempMemory struct {
 	compactTokenThreshold int
 	longTermMemoryTTL     time.Duration
 	shortTermMemoryTTL    time.Duration
+	tokenizer             agentloop.Tokenizer
 }
 
 func (m *TempMemory) LoadLocked(rail miso.Rail) (_longTerm string, shortTerm []Conversation, _err error) {
@@ -135,17 +137,16 @@ func (m *TempMemory) LoadFormatted(rail miso.Rail, lock bool) (_longTerm string,
 	return longTerm, shortTermFmt.String(), nil
 }
 
-// countConversationTokens approximates the token count of a Conversation
-// using the same 4-chars-per-token heuristic as the agentloop Tokenizer.
-func countConversationTokens(c Conversation) int {
-	return (len(c.User) + len(c.Assistant)) / 4
+// countConversationTokens approximates the token count of a Conversation with the agentloop Tokenizer.
+func countConversationTokens(t agentloop.Tokenizer, c Conversation) int {
+	return t.CountTokens(c.User) + t.CountTokens(c.Assistant)
 }
 
 // totalTokens returns the total approximate token count across all conversations.
-func totalTokens(convs []Conversation) int {
+func (m *TempMemory) totalTokens(convs []Conversation) int {
 	total := 0
 	for _, c := range convs {
-		total += countConversationTokens(c)
+		total += countConversationTokens(m.tokenizer, c)
 	}
 	return total
 }
@@ -183,7 +184,7 @@ func (m *TempMemory) shouldCompact(shortTerm []Conversation) (int, bool) {
 	if len(shortTerm) < 3 {
 		return 0, false
 	}
-	tt := totalTokens(shortTerm)
+	tt := m.totalTokens(shortTerm)
 	if m.compactTokenThreshold > 0 {
 		return tt, tt >= m.compactTokenThreshold
 	}
@@ -222,7 +223,7 @@ func (m *TempMemory) compactMemory(rail miso.Rail) error {
 	}
 	if m.compactTokenThreshold > 0 {
 		rail.Infof("ShortTermMemory exceeds token threshold (%v), compacting memory: %v conversations, ~%v tokens",
-			m.compactTokenThreshold, len(shortTerm), totalTokens(shortTerm))
+			m.compactTokenThreshold, len(shortTerm), m.totalTokens(shortTerm))
 	} else {
 		rail.Infof("ShortTermMemory exceeds round threshold (%v), compacting memory: %v conversations",
 			m.compactThreshold, len(shortTerm))
@@ -299,6 +300,7 @@ type memoryConfig struct {
 	compactTokenThreshold int
 	longTermMemoryTTL     time.Duration
 	shortTermMemoryTTL    time.Duration
+	tokenizer             agentloop.Tokenizer
 }
 
 // WithCompactThreshold triggers memory compaction when the number of conversations
@@ -328,6 +330,16 @@ func WithCompactTokenThreshold(n int) memoryConfigFunc {
 	}
 }
 
+// WithTokenizer sets the tokenizer used for [WithCompactTokenThreshold], e.g. the one given to
+// agentloop.AgentConfig.Tokenizer. Default: agentloop.NewTokenizer().
+func WithTokenizer(t agentloop.Tokenizer) memoryConfigFunc {
+	return func(mc *memoryConfig) {
+		if t != nil {
+			mc.tokenizer = t
+		}
+	}
+}
+
 // Set long term memory TTL to v.
 func WithLongTermMemoryTTL(v time.Duration) memoryConfigFunc {
 	return func(mc *memoryConfig) {
@@ -359,6 +371,7 @@ func NewTempMemory(key string, agent *agents.MemorySummarizer, ops ...memoryConf
 		compactThreshold:      6,
 		longTermMemoryTTL:     time.Hour * 24 * 30,
 		shortTermMemoryTTL:    time.Hour * 24 * 30,
+		tokenizer:             agentloop.NewTokenizer(),
 	}
 	for _, op := range ops {
 		op(m)
@@ -374,5 +387,6 @@ func NewTempMemory(key string, agent *agents.MemorySummarizer, ops ...memoryConf
 		longTerm:              newLongTermTempMemory(),
 		longTermMemoryTTL:     m.longTermMemoryTTL,
 		shortTermMemoryTTL:    m.shortTermMemoryTTL,
+		tokenizer:             m.tokenizer,
 	}
 }
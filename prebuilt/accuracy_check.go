@@ -111,7 +111,6 @@ func NewAccuracyCheckAgent(chatModel model.ToolCallingChatModel, opts ...Accurac
 		MaxRunSteps:  5,
 		Language:     cfg.Language,
 		SystemPrompt: systemPrompt,
-		OutputCheck:  agentloop.JsonOutputCheck[scoreReasonResponse](2),
 	})
 	if err != nil {
 		return nil, errs.Wrapf(err, "failed to create AccuracyCheckAgent")
@@ -147,15 +146,15 @@ func (a *AccuracyCheckAgent) Check(rail flow.Rail, input AccuracyCheckInput) (Ac
 	})
 
 	return retry.GetOne(a.config.RetryCount, func() (AccuracyCheckResult, error) {
-		out, err := a.agent.Execute(rail, agentloop.AgentRequest{
+		parsed, _, err := agentloop.ExecuteTyped[scoreReasonResponse](a.agent, rail, agentloop.AgentRequest{
 			UserInput: userPrompt,
 		})
 		if err != nil {
 			return AccuracyCheckResult{}, errs.Wrapf(err, "AccuracyCheckAgent execution failed")
 		}
-		score, reason, err := parseScoreReason(out.Response)
+		score, reason, err := validateScoreReason(parsed)
 		if err != nil {
-			return AccuracyCheckResult{}, errs.Wrapf(err, "failed to parse AccuracyCheckAgent response")
+			return AccuracyCheckResult{}, errs.Wrapf(err, "invalid AccuracyCheckAgent response")
 		}
 		if reason == "" {
 			return AccuracyCheckResult{}, errs.NewErrf("missing Reason field in AccuracyCheckAgent response")
@@ -8,7 +8,6 @@ import (
 	"github.com/curtisnewbie/miso-agent/agentloop"
 	"github.com/curtisnewbie/miso/errs"
 	"github.com/curtisnewbie/miso/flow"
-	"github.com/curtisnewbie/miso/util/llm"
 	"github.com/curtisnewbie/miso/util/strutil"
 )
 
@@ -89,7 +88,6 @@ func NewCategoryAnalyzeAgent(chatModel model.ToolCallingChatModel, opts ...Categ
 		MaxRunSteps:  30,
 		Language:     cfg.Language,
 		SystemPrompt: categoryAnalyzeSystemPrompt,
-		OutputCheck:  agentloop.JsonOutputCheck[CategoryAnalysisResult](2),
 	})
 	if err != nil {
 		return nil, errs.Wrapf(err, "failed to create CategoryAnalyzeAgent")
@@ -112,15 +110,10 @@ func (a *CategoryAnalyzeAgent) Analyze(rail flow.Rail, input CategoryAnalyzeInpu
 		Subjects:        descStr,
 	})
 
-	out, err := a.agent.Execute(rail, agentloop.AgentRequest{UserInput: userPrompt})
+	result, _, err := agentloop.ExecuteTyped[CategoryAnalysisResult](a.agent, rail, agentloop.AgentRequest{UserInput: userPrompt})
 	if err != nil {
 		return CategoryAnalysisResult{}, errs.Wrapf(err, "CategoryAnalyzeAgent execution failed")
 	}
-	_, content := llm.ParseThink(out.Response)
-	result, err := llm.ParseLLMJsonAs[CategoryAnalysisResult](content)
-	if err != nil {
-		return CategoryAnalysisResult{}, errs.Wrapf(err, "failed to parse CategoryAnalyzeAgent response")
-	}
 	return result, nil
 }
 
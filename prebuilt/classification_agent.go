@@ -8,7 +8,6 @@ import (
 	"github.com/curtisnewbie/miso-agent/agentloop"
 	"github.com/curtisnewbie/miso/errs"
 	"github.com/curtisnewbie/miso/flow"
-	"github.com/curtisnewbie/miso/util/llm"
 	"github.com/curtisnewbie/miso/util/strutil"
 )
 
@@ -106,7 +105,6 @@ func NewClassificationAgent(chatModel model.ToolCallingChatModel, opts ...Classi
 		MaxRunSteps:  30,
 		Language:     cfg.Language,
 		SystemPrompt: systemPrompt,
-		OutputCheck:  agentloop.JsonOutputCheck[ClassificationOutput](2),
 	})
 	if err != nil {
 		return nil, errs.Wrapf(err, "failed to create ClassificationAgent")
@@ -130,15 +128,10 @@ func (a *ClassificationAgent) Classify(rail flow.Rail, input ClassificationInput
 		userPrompt = input.TaskExplanation + "\n\n" + userPrompt
 	}
 
-	out, err := a.agent.Execute(rail, agentloop.AgentRequest{UserInput: userPrompt})
+	result, _, err := agentloop.ExecuteTyped[ClassificationOutput](a.agent, rail, agentloop.AgentRequest{UserInput: userPrompt})
 	if err != nil {
 		return ClassificationOutput{}, errs.Wrapf(err, "ClassificationAgent execution failed")
 	}
-	_, content := llm.ParseThink(out.Response)
-	result, err := llm.ParseLLMJsonAs[ClassificationOutput](content)
-	if err != nil {
-		return ClassificationOutput{}, errs.Wrapf(err, "failed to parse ClassificationAgent response")
-	}
 	for i, r := range result.Results {
 		for _, c := range r.Categories {
 			if strings.EqualFold(c, "Unknown") {
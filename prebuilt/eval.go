@@ -10,8 +10,8 @@ import (
 // scoreReasonResponse is the JSON schema shared by evaluator agents (fact-check, accuracy-check,
 // relevance-check) that report a 1-5 score with a textual justification.
 type scoreReasonResponse struct {
-	Score  int    `json:"score"`
-	Reason string `json:"reason"`
+	Score  int    `json:"score" desc:"Score from 1 to 5"`
+	Reason string `json:"reason" desc:"Justification of the score"`
 }
 
 // parseScoreReason parses a `{"score": <1-5>, "reason": "..."}` JSON model response.
@@ -23,6 +23,11 @@ func parseScoreReason(content string) (score int, reason string, err error) {
 	if perr != nil {
 		return 0, "", errs.Wrapf(perr, "failed to parse JSON response")
 	}
+	return validateScoreReason(parsed)
+}
+
+// validateScoreReason checks that the score of a parsed response is in [1,5] and trims the reason.
+func validateScoreReason(parsed scoreReasonResponse) (score int, reason string, err error) {
 	if parsed.Score < 1 || parsed.Score > 5 {
 		return 0, "", errs.NewErrf("score out of range [1,5]: %d", parsed.Score)
 	}
@@ -111,7 +111,6 @@ func NewFactCheckAgent(chatModel model.ToolCallingChatModel, opts ...FactCheckOp
 		MaxRunSteps:  5,
 		Language:     cfg.Language,
 		SystemPrompt: systemPrompt,
-		OutputCheck:  agentloop.JsonOutputCheck[scoreReasonResponse](2),
 	})
 	if err != nil {
 		return nil, errs.Wrapf(err, "failed to create FactCheckAgent")
@@ -145,32 +144,23 @@ func (a *FactCheckAgent) Check(rail flow.Rail, input FactCheckInput) (FactCheckR
 	})
 
 	return retry.GetOne(a.config.RetryCount, func() (FactCheckResult, error) {
-		out, err := a.agent.Execute(rail, agentloop.AgentRequest{
+		parsed, _, err := agentloop.ExecuteTyped[scoreReasonResponse](a.agent, rail, agentloop.AgentRequest{
 			UserInput: userPrompt,
 		})
 		if err != nil {
 			return FactCheckResult{}, errs.Wrapf(err, "FactCheckAgent execution failed")
 		}
-		result, err := parseFactCheckResponse(out.Response)
+		score, reason, err := validateScoreReason(parsed)
 		if err != nil {
-			return FactCheckResult{}, errs.Wrapf(err, "failed to parse FactCheckAgent response")
+			return FactCheckResult{}, errs.Wrapf(err, "invalid FactCheckAgent response")
 		}
-		if result.Reason == "" {
+		if reason == "" {
 			return FactCheckResult{}, errs.NewErrf("missing Reason field in FactCheckAgent response")
 		}
-		return result, nil
+		return FactCheckResult{Score: score, Reason: reason}, nil
 	})
 }
 
-// parseFactCheckResponse parses the model response into a [FactCheckResult].
-func parseFactCheckResponse(content string) (FactCheckResult, error) {
-	score, reason, err := parseScoreReason(content)
-	if err != nil {
-		return FactCheckResult{}, err
-	}
-	return FactCheckResult{Score: score, Reason: reason}, nil
-}
-
 // factCheckSystemPrompt is the static system prompt: role, rules, score scale, CoT steps, examples.
 const factCheckSystemPrompt = `You are a fact-checking expert. Evaluate whether an LLM response is grounded in the provided knowledge context.
 
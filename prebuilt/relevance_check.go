@@ -107,7 +107,6 @@ func NewRelevanceCheckAgent(chatModel model.ToolCallingChatModel, opts ...Releva
 		MaxRunSteps:  5,
 		Language:     cfg.Language,
 		SystemPrompt: systemPrompt,
-		OutputCheck:  agentloop.JsonOutputCheck[scoreReasonResponse](2),
 	})
 	if err != nil {
 		return nil, errs.Wrapf(err, "failed to create RelevanceCheckAgent")
@@ -141,15 +140,15 @@ func (a *RelevanceCheckAgent) Check(rail flow.Rail, input RelevanceCheckInput) (
 	})
 
 	return retry.GetOne(a.config.RetryCount, func() (RelevanceCheckResult, error) {
-		out, err := a.agent.Execute(rail, agentloop.AgentRequest{
+		parsed, _, err := agentloop.ExecuteTyped[scoreReasonResponse](a.agent, rail, agentloop.AgentRequest{
 			UserInput: userPrompt,
 		})
 		if err != nil {
 			return RelevanceCheckResult{}, errs.Wrapf(err, "RelevanceCheckAgent execution failed")
 		}
-		score, reason, err := parseScoreReason(out.Response)
+		score, reason, err := validateScoreReason(parsed)
 		if err != nil {
-			return RelevanceCheckResult{}, errs.Wrapf(err, "failed to parse RelevanceCheckAgent response")
+			return RelevanceCheckResult{}, errs.Wrapf(err, "invalid RelevanceCheckAgent response")
 		}
 		if reason == "" {
 			return RelevanceCheckResult{}, errs.NewErrf("missing Reason field in RelevanceCheckAgent response")